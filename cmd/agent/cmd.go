@@ -21,6 +21,7 @@ import (
 var (
 	commonOptions = commonoptions.NewAgentOptions()
 	agentOption   = spoke.NewWorkloadAgentOptions()
+	codecOption   = newCodecOptions()
 )
 
 // by default uses 1M as the limit for state feedback
@@ -28,8 +29,8 @@ const maxJSONRawLength int32 = 1024 * 1024
 
 func NewAgentCommand() *cobra.Command {
 	agentOption.MaxJSONRawLength = maxJSONRawLength
-	agentOption.CloudEventsClientCodecs = []string{"manifest"}
-	cfg := spoke.NewWorkAgentConfig(commonOptions, agentOption)
+	agentOption.CloudEventsClientCodecs = []string{"manifest", "manifestbundle"}
+	cfg := &workAgentConfig{agentOptions: commonOptions, workOptions: agentOption, codecOptions: codecOption}
 	cmdConfig := commonOptions.CommonOpts.
 		NewControllerCommandConfig("agent", version.Get(), cfg.RunWorkloadAgent)
 
@@ -64,10 +65,20 @@ func NewAgentCommand() *cobra.Command {
 	return cmd
 }
 
-// addFlags overrides cluster name and leader leader election flags from the agentOption
+// addFlags overrides cluster name and leader leader election flags from the agentOption, and adds the codec flags
 func addFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&commonOptions.SpokeClusterName, "cluster-name",
 		commonOptions.SpokeClusterName, "Name of the cluster")
 	fs.BoolVar(&commonOptions.CommonOpts.CmdConfig.DisableLeaderElection, "disable-leader-election",
 		true, "Disable leader election.")
+	fs.StringVar(&codecOption.compression.Algorithm, "compression", "",
+		"Compression of the status event data, gzip or zstd, the data is not compressed if it's empty. "+
+			"The compressed spec events are always decompressed")
+	fs.IntVar(&codecOption.compression.Threshold, "compression-threshold", codecOption.compression.Threshold,
+		"Size of the status event data in bytes above which the data is compressed")
+	fs.StringVar(&codecOption.encryptionKeyring, "encryption-keyring", "",
+		"YAML or JSON keyring file of the private key of the cluster, the encrypted spec events are decrypted with it")
+	fs.StringVar(&codecOption.signatureKeyring, "signature-keyring", "",
+		"YAML or JSON keyring file of the signing key of the cluster and the verification keys of the source, the "+
+			"status events are signed and the spec events are verified if it's set")
 }
@@ -0,0 +1,138 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/morvencao/event-based-transport-demo/pkg/transport"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+	workclientset "open-cluster-management.io/api/client/work/clientset/versioned"
+	workv1client "open-cluster-management.io/api/client/work/clientset/versioned/typed/work/v1"
+	workv1alpha1client "open-cluster-management.io/api/client/work/clientset/versioned/typed/work/v1alpha1"
+	workv1 "open-cluster-management.io/api/work/v1"
+
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/types"
+	cloudeventswork "open-cluster-management.io/sdk-go/pkg/cloudevents/work"
+	agentclient "open-cluster-management.io/sdk-go/pkg/cloudevents/work/agent/client"
+	agentlister "open-cluster-management.io/sdk-go/pkg/cloudevents/work/agent/lister"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/work/store"
+)
+
+// httpDriver is the workload source driver of the CloudEvents HTTP transport, the sdk-go client holder doesn't
+// support it, so its work client is built here.
+const httpDriver = "http"
+
+// newHTTPWorkClient builds the work client of the HTTP transport, the status events are POSTed to the ingest URL of
+// the source and the spec events are received by a TLS server on the listen address. As with the sdk-go client
+// holder, the works are resynced after the store is initiated and once the client is reconnected.
+func (o *workAgentConfig) newHTTPWorkClient(
+	ctx context.Context,
+	codecs []generic.Codec[*workv1.ManifestWork],
+	watcherStore *store.AgentInformerWatcherStore,
+) (string, workclientset.Interface, error) {
+	config, err := transport.LoadHTTPAgentConfig(o.workOptions.WorkloadSourceConfig)
+	if err != nil {
+		return "", nil, err
+	}
+
+	httpOptions := config.HTTPOptions()
+	agentOptions, httpTransport, err := transport.NewHTTPAgentOptions(
+		httpOptions, config.IngestURL, o.agentOptions.SpokeClusterName, o.workOptions.CloudEventsClientID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(httpOptions.IngestPath, httpTransport.Handler())
+	server := &http.Server{
+		Addr:      config.ListenAddress,
+		Handler:   mux,
+		TLSConfig: transport.HTTPServerTLSConfig(),
+	}
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(context.Background())
+	}()
+	go func() {
+		if err := server.ListenAndServeTLS(config.TLSCertFile, config.TLSKeyFile); !errors.Is(err, http.ErrServerClosed) {
+			klog.Errorf("failed to serve the spec events on %s, %v", config.ListenAddress, err)
+		}
+	}()
+
+	cloudEventsClient, err := generic.NewCloudEventAgentClient[*workv1.ManifestWork](
+		ctx,
+		agentOptions,
+		agentlister.NewWatcherStoreLister(watcherStore),
+		cloudeventswork.ManifestWorkStatusHash,
+		codecs...,
+	)
+	if err != nil {
+		return "", nil, err
+	}
+	cloudEventsClient.Subscribe(ctx, watcherStore.HandleReceivedWork)
+
+	go func() {
+		if store.WaitForStoreInit(ctx, watcherStore.HasInitiated) {
+			if err := cloudEventsClient.Resync(ctx, types.SourceAll); err != nil {
+				klog.Errorf("failed to send resync request, %v", err)
+			}
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-cloudEventsClient.ReconnectedChan():
+				if err := cloudEventsClient.Resync(ctx, types.SourceAll); err != nil {
+					klog.Errorf("failed to send resync request, %v", err)
+				}
+			}
+		}
+	}()
+
+	manifestWorkClient := agentclient.NewManifestWorkAgentClient(cloudEventsClient, watcherStore, o.agentOptions.SpokeClusterName)
+	return config.IngestURL, &workClientSetWrapper{workV1: &workV1ClientWrapper{manifestWorkClient: manifestWorkClient}}, nil
+}
+
+// workClientSetWrapper wraps the manifestwork client of the agent to a work clientset, so the manifestwork informer
+// is built with the informer factory.
+type workClientSetWrapper struct {
+	workV1 *workV1ClientWrapper
+}
+
+var _ workclientset.Interface = &workClientSetWrapper{}
+
+func (c *workClientSetWrapper) WorkV1() workv1client.WorkV1Interface {
+	return c.workV1
+}
+
+func (c *workClientSetWrapper) WorkV1alpha1() workv1alpha1client.WorkV1alpha1Interface {
+	return nil
+}
+
+func (c *workClientSetWrapper) Discovery() discovery.DiscoveryInterface {
+	return nil
+}
+
+// workV1ClientWrapper wraps the manifestwork client of the agent to a WorkV1Interface.
+type workV1ClientWrapper struct {
+	manifestWorkClient *agentclient.ManifestWorkAgentClient
+}
+
+var _ workv1client.WorkV1Interface = &workV1ClientWrapper{}
+
+func (c *workV1ClientWrapper) ManifestWorks(namespace string) workv1client.ManifestWorkInterface {
+	c.manifestWorkClient.SetNamespace(namespace)
+	return c.manifestWorkClient
+}
+
+func (c *workV1ClientWrapper) AppliedManifestWorks() workv1client.AppliedManifestWorkInterface {
+	return nil
+}
+
+func (c *workV1ClientWrapper) RESTClient() rest.Interface {
+	return nil
+}
@@ -0,0 +1,340 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/morvencao/event-based-transport-demo/pkg/transport"
+	"github.com/openshift/library-go/pkg/controller/controllercmd"
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+	workclientset "open-cluster-management.io/api/client/work/clientset/versioned"
+	workv1client "open-cluster-management.io/api/client/work/clientset/versioned/typed/work/v1"
+	workinformers "open-cluster-management.io/api/client/work/informers/externalversions"
+	workv1informers "open-cluster-management.io/api/client/work/informers/externalversions/work/v1"
+	ocmfeature "open-cluster-management.io/api/feature"
+	workv1 "open-cluster-management.io/api/work/v1"
+	commonoptions "open-cluster-management.io/ocm/pkg/common/options"
+	"open-cluster-management.io/ocm/pkg/features"
+	"open-cluster-management.io/ocm/pkg/work/helper"
+	"open-cluster-management.io/ocm/pkg/work/spoke"
+	"open-cluster-management.io/ocm/pkg/work/spoke/auth"
+	"open-cluster-management.io/ocm/pkg/work/spoke/controllers/appliedmanifestcontroller"
+	"open-cluster-management.io/ocm/pkg/work/spoke/controllers/finalizercontroller"
+	"open-cluster-management.io/ocm/pkg/work/spoke/controllers/manifestcontroller"
+	"open-cluster-management.io/ocm/pkg/work/spoke/controllers/statuscontroller"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/types"
+	cloudeventswork "open-cluster-management.io/sdk-go/pkg/cloudevents/work"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/work/agent/codec"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/work/store"
+)
+
+const (
+	manifestCodecName       = "manifest"
+	manifestBundleCodecName = "manifestbundle"
+
+	appliedManifestWorkFinalizeControllerWorkers = 10
+	manifestWorkFinalizeControllerWorkers        = 10
+	availableStatusControllerWorkers             = 10
+)
+
+// codecOptions are the options of the transport codecs of the agent, they must match the options of the source.
+type codecOptions struct {
+	compression *transport.CompressionOptions
+	// encryptionKeyring is the keyring file of the private key of the cluster, the spec events are decrypted with it.
+	encryptionKeyring string
+	// signatureKeyring is the keyring file of the signing key of the cluster and the verification keys of the
+	// source, the status events are signed and the spec events are verified with it.
+	signatureKeyring string
+}
+
+func newCodecOptions() *codecOptions {
+	return &codecOptions{
+		compression: transport.NewCompressionOptions(),
+	}
+}
+
+// workAgentConfig runs the ocm work agent with its codecs wrapped by the transport codecs, the codecs of the ocm
+// work agent can't be extended, so its RunWorkloadAgent is kept here.
+type workAgentConfig struct {
+	agentOptions *commonoptions.AgentOptions
+	workOptions  *spoke.WorkloadAgentOptions
+	codecOptions *codecOptions
+}
+
+// RunWorkloadAgent starts the controllers on agent to process work from hub, it's the RunWorkloadAgent of the ocm
+// work agent with the codecs wrapped by the transport codecs.
+func (o *workAgentConfig) RunWorkloadAgent(ctx context.Context, controllerContext *controllercmd.ControllerContext) error {
+	// load spoke client config and create spoke clients,
+	// the work agent may not running in the spoke/managed cluster.
+	spokeRestConfig, err := o.agentOptions.SpokeKubeConfig(controllerContext.KubeConfig)
+	if err != nil {
+		return err
+	}
+
+	spokeDynamicClient, err := dynamic.NewForConfig(spokeRestConfig)
+	if err != nil {
+		return err
+	}
+	spokeKubeClient, err := kubernetes.NewForConfig(spokeRestConfig)
+	if err != nil {
+		return err
+	}
+	spokeAPIExtensionClient, err := apiextensionsclient.NewForConfig(spokeRestConfig)
+	if err != nil {
+		return err
+	}
+	spokeWorkClient, err := workclientset.NewForConfig(spokeRestConfig)
+	if err != nil {
+		return err
+	}
+	spokeWorkInformerFactory := workinformers.NewSharedInformerFactory(spokeWorkClient, 5*time.Minute)
+
+	httpClient, err := rest.HTTPClientFor(spokeRestConfig)
+	if err != nil {
+		return err
+	}
+	restMapper, err := apiutil.NewDynamicRESTMapper(spokeRestConfig, httpClient)
+	if err != nil {
+		return err
+	}
+
+	hubHost, hubWorkClient, hubWorkInformer, err := o.newHubWorkClientAndInformer(ctx, restMapper)
+	if err != nil {
+		return err
+	}
+
+	agentID := o.agentOptions.AgentID
+	hubHash := helper.HubHash(hubHost)
+	if len(agentID) == 0 {
+		agentID = hubHash
+	}
+
+	// create controllers
+	validator := auth.NewFactory(
+		spokeRestConfig,
+		spokeKubeClient,
+		hubWorkInformer,
+		o.agentOptions.SpokeClusterName,
+		controllerContext.EventRecorder,
+		restMapper,
+	).NewExecutorValidator(ctx, features.SpokeMutableFeatureGate.Enabled(ocmfeature.ExecutorValidatingCaches))
+
+	manifestWorkController := manifestcontroller.NewManifestWorkController(
+		controllerContext.EventRecorder,
+		spokeDynamicClient,
+		spokeKubeClient,
+		spokeAPIExtensionClient,
+		hubWorkClient,
+		hubWorkInformer,
+		hubWorkInformer.Lister().ManifestWorks(o.agentOptions.SpokeClusterName),
+		spokeWorkClient.WorkV1().AppliedManifestWorks(),
+		spokeWorkInformerFactory.Work().V1().AppliedManifestWorks(),
+		hubHash, agentID,
+		restMapper,
+		validator,
+	)
+	addFinalizerController := finalizercontroller.NewAddFinalizerController(
+		controllerContext.EventRecorder,
+		hubWorkClient,
+		hubWorkInformer,
+		hubWorkInformer.Lister().ManifestWorks(o.agentOptions.SpokeClusterName),
+	)
+	appliedManifestWorkFinalizeController := finalizercontroller.NewAppliedManifestWorkFinalizeController(
+		controllerContext.EventRecorder,
+		spokeDynamicClient,
+		spokeWorkClient.WorkV1().AppliedManifestWorks(),
+		spokeWorkInformerFactory.Work().V1().AppliedManifestWorks(),
+		agentID,
+	)
+	manifestWorkFinalizeController := finalizercontroller.NewManifestWorkFinalizeController(
+		controllerContext.EventRecorder,
+		hubWorkClient,
+		hubWorkInformer,
+		hubWorkInformer.Lister().ManifestWorks(o.agentOptions.SpokeClusterName),
+		spokeWorkClient.WorkV1().AppliedManifestWorks(),
+		spokeWorkInformerFactory.Work().V1().AppliedManifestWorks(),
+		hubHash,
+	)
+	unmanagedAppliedManifestWorkController := finalizercontroller.NewUnManagedAppliedWorkController(
+		controllerContext.EventRecorder,
+		hubWorkInformer,
+		hubWorkInformer.Lister().ManifestWorks(o.agentOptions.SpokeClusterName),
+		spokeWorkClient.WorkV1().AppliedManifestWorks(),
+		spokeWorkInformerFactory.Work().V1().AppliedManifestWorks(),
+		o.workOptions.AppliedManifestWorkEvictionGracePeriod,
+		hubHash, agentID,
+	)
+	appliedManifestWorkController := appliedmanifestcontroller.NewAppliedManifestWorkController(
+		controllerContext.EventRecorder,
+		spokeDynamicClient,
+		hubWorkInformer,
+		hubWorkInformer.Lister().ManifestWorks(o.agentOptions.SpokeClusterName),
+		spokeWorkClient.WorkV1().AppliedManifestWorks(),
+		spokeWorkInformerFactory.Work().V1().AppliedManifestWorks(),
+		hubHash,
+	)
+	availableStatusController := statuscontroller.NewAvailableStatusController(
+		controllerContext.EventRecorder,
+		spokeDynamicClient,
+		hubWorkClient,
+		hubWorkInformer,
+		hubWorkInformer.Lister().ManifestWorks(o.agentOptions.SpokeClusterName),
+		o.workOptions.MaxJSONRawLength,
+		o.workOptions.StatusSyncInterval,
+	)
+
+	go spokeWorkInformerFactory.Start(ctx.Done())
+	go hubWorkInformer.Informer().Run(ctx.Done())
+
+	go addFinalizerController.Run(ctx, 1)
+	go appliedManifestWorkFinalizeController.Run(ctx, appliedManifestWorkFinalizeControllerWorkers)
+	go unmanagedAppliedManifestWorkController.Run(ctx, 1)
+	go appliedManifestWorkController.Run(ctx, 1)
+	go manifestWorkController.Run(ctx, 1)
+	go manifestWorkFinalizeController.Run(ctx, manifestWorkFinalizeControllerWorkers)
+	go availableStatusController.Run(ctx, availableStatusControllerWorkers)
+
+	<-ctx.Done()
+
+	return nil
+}
+
+// buildCodecs builds the sdk-go codecs of the agent and wraps them with the transport codecs in the order of the
+// source codecs: the spec events are verified, decrypted and decompressed before they are decoded, and the status
+// events are compressed and signed.
+func (o *workAgentConfig) buildCodecs(restMapper meta.RESTMapper) ([]generic.Codec[*workv1.ManifestWork], error) {
+	if err := o.codecOptions.compression.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid compression options, %v", err)
+	}
+
+	var encryptionKeyring *transport.Keyring
+	if o.codecOptions.encryptionKeyring != "" {
+		keyring, err := transport.LoadKeyring(o.codecOptions.encryptionKeyring)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load encryption keyring, %v", err)
+		}
+		encryptionKeyring = keyring
+	}
+
+	var signatureKeyring *transport.Keyring
+	if o.codecOptions.signatureKeyring != "" {
+		keyring, err := transport.LoadKeyring(o.codecOptions.signatureKeyring)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load signature keyring, %v", err)
+		}
+		signatureKeyring = keyring
+	}
+
+	codecs := []generic.Codec[*workv1.ManifestWork]{}
+	for _, name := range o.workOptions.CloudEventsClientCodecs {
+		switch name {
+		case manifestBundleCodecName:
+			codecs = append(codecs, codec.NewManifestBundleCodec())
+		case manifestCodecName:
+			codecs = append(codecs, codec.NewManifestCodec(restMapper))
+		}
+	}
+
+	for i := range codecs {
+		codecs[i] = transport.NewCompressionCodec(codecs[i], o.codecOptions.compression)
+		if encryptionKeyring != nil {
+			codecs[i] = transport.NewEncryptionCodec(codecs[i], encryptionKeyring)
+		}
+		if signatureKeyring != nil {
+			codecs[i] = transport.NewSignatureCodec(codecs[i], signatureKeyring, auditRejectedEvent)
+		}
+	}
+	return codecs, nil
+}
+
+// auditRejectedEvent logs the spec event that is rejected by the signature verification.
+func auditRejectedEvent(evt cloudevents.Event, err error) {
+	extensions := evt.Extensions()
+	klog.Infof("AUDIT: rejected event id=%s type=%s source=%s cluster=%v resource=%v: %v",
+		evt.ID(), evt.Type(), evt.Source(), extensions[types.ExtensionClusterName], extensions[types.ExtensionResourceID], err)
+}
+
+func (o *workAgentConfig) newHubWorkClientAndInformer(
+	ctx context.Context,
+	restMapper meta.RESTMapper,
+) (string, workv1client.ManifestWorkInterface, workv1informers.ManifestWorkInformer, error) {
+	var workClient workclientset.Interface
+	var watcherStore *store.AgentInformerWatcherStore
+	var hubHost string
+
+	if o.workOptions.WorkloadSourceDriver == "kube" {
+		config, err := clientcmd.BuildConfigFromFlags("", o.workOptions.WorkloadSourceConfig)
+		if err != nil {
+			return "", nil, nil, err
+		}
+
+		workClient, err = workclientset.NewForConfig(config)
+		if err != nil {
+			return "", nil, nil, err
+		}
+
+		hubHost = config.Host
+	} else {
+		// For cloudevents drivers, we build ManifestWork client that implements the
+		// ManifestWorkInterface and ManifestWork informer based on different driver configuration.
+		// Refer to Event Based Manifestwork proposal in enhancements repo to get more details.
+
+		watcherStore = store.NewAgentInformerWatcherStore()
+
+		codecs, err := o.buildCodecs(restMapper)
+		if err != nil {
+			return "", nil, nil, err
+		}
+
+		if o.workOptions.WorkloadSourceDriver == httpDriver {
+			hubHost, workClient, err = o.newHTTPWorkClient(ctx, codecs, watcherStore)
+			if err != nil {
+				return "", nil, nil, err
+			}
+		} else {
+			serverHost, config, err := generic.NewConfigLoader(o.workOptions.WorkloadSourceDriver, o.workOptions.WorkloadSourceConfig).
+				LoadConfig()
+			if err != nil {
+				return "", nil, nil, err
+			}
+
+			clientHolder, err := cloudeventswork.NewClientHolderBuilder(config).
+				WithClientID(o.workOptions.CloudEventsClientID).
+				WithClusterName(o.agentOptions.SpokeClusterName).
+				WithCodecs(codecs...).
+				WithWorkClientWatcherStore(watcherStore).
+				NewAgentClientHolder(ctx)
+			if err != nil {
+				return "", nil, nil, err
+			}
+
+			hubHost = serverHost
+			workClient = clientHolder.WorkInterface()
+		}
+	}
+
+	factory := workinformers.NewSharedInformerFactoryWithOptions(
+		workClient,
+		5*time.Minute,
+		workinformers.WithNamespace(o.agentOptions.SpokeClusterName),
+	)
+	informer := factory.Work().V1().ManifestWorks()
+
+	// For cloudevents work client, we use the informer store as the client store
+	if watcherStore != nil {
+		watcherStore.SetStore(informer.Informer().GetStore())
+	}
+
+	return hubHost, workClient.WorkV1().ManifestWorks(o.agentOptions.SpokeClusterName), informer, nil
+}
@@ -0,0 +1,226 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/morvencao/event-based-transport-demo/pkg/api"
+	"github.com/morvencao/event-based-transport-demo/pkg/source"
+	"github.com/morvencao/event-based-transport-demo/pkg/transport"
+	"gopkg.in/yaml.v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubetypes "k8s.io/apimachinery/pkg/types"
+	workv1 "open-cluster-management.io/api/work/v1"
+	"open-cluster-management.io/ocm/pkg/work/spoke"
+
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/types"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/work/common"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/work/payload"
+)
+
+func TestBuildCodecs(t *testing.T) {
+	compression := transport.NewCompressionOptions()
+	compression.Algorithm = transport.CompressionZstd
+	compression.Threshold = 0
+
+	encryptionKey, err := transport.NewKeyringKey("cluster1-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sourceKeyringFile := writeTestKeyring(t, transport.KeyringConfig{
+		Clusters: map[string][]transport.KeyringKey{"cluster1": {{ID: encryptionKey.ID, PublicKey: encryptionKey.PublicKey}}},
+	})
+	sourceKeyring, err := transport.LoadKeyring(sourceKeyringFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agentKeyringFile := writeTestKeyring(t, transport.KeyringConfig{
+		Clusters: map[string][]transport.KeyringKey{"cluster1": {encryptionKey}},
+	})
+	sourceSigningKeyring, agentSigningKeyringFile := newTestSigningKeyrings(t)
+
+	cases := []struct {
+		name               string
+		sourceMiddlewares  []source.CodecMiddleware
+		codecOptions       func(options *codecOptions)
+		expectedExtensions []string
+	}{
+		{
+			name:               "compressed",
+			sourceMiddlewares:  []source.CodecMiddleware{source.CompressionMiddleware(compression)},
+			expectedExtensions: []string{transport.ExtensionContentEncoding},
+		},
+		{
+			name: "encrypted and compressed",
+			sourceMiddlewares: []source.CodecMiddleware{
+				source.EncryptionMiddleware(sourceKeyring), source.CompressionMiddleware(compression),
+			},
+			codecOptions: func(options *codecOptions) {
+				options.encryptionKeyring = agentKeyringFile
+			},
+			expectedExtensions: []string{transport.ExtensionContentEncoding, transport.ExtensionEncryptionKeyID},
+		},
+		{
+			name: "signed, encrypted and compressed",
+			sourceMiddlewares: []source.CodecMiddleware{
+				source.SignatureMiddleware(sourceSigningKeyring, nil), source.EncryptionMiddleware(sourceKeyring),
+				source.CompressionMiddleware(compression),
+			},
+			codecOptions: func(options *codecOptions) {
+				options.encryptionKeyring = agentKeyringFile
+				options.signatureKeyring = agentSigningKeyringFile
+			},
+			expectedExtensions: []string{
+				transport.ExtensionContentEncoding, transport.ExtensionEncryptionKeyID, transport.ExtensionSignature,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			workOptions := spoke.NewWorkloadAgentOptions()
+			workOptions.CloudEventsClientCodecs = []string{manifestCodecName, manifestBundleCodecName}
+			config := &workAgentConfig{workOptions: workOptions, codecOptions: newCodecOptions()}
+			if c.codecOptions != nil {
+				c.codecOptions(config.codecOptions)
+			}
+			codecs, err := config.buildCodecs(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var sourceCodec generic.Codec[*api.Resource] = &source.ResourceCodec{}
+			for i := len(c.sourceMiddlewares) - 1; i >= 0; i-- {
+				sourceCodec = c.sourceMiddlewares[i](sourceCodec)
+			}
+			resource := newTestResource()
+			evt, err := sourceCodec.Encode("source", types.CloudEventsType{
+				CloudEventsDataType: payload.ManifestEventDataType,
+				SubResource:         types.SubResourceSpec,
+				Action:              "create_request",
+			}, resource)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, extension := range c.expectedExtensions {
+				if _, ok := evt.Extensions()[extension]; !ok {
+					t.Fatalf("expected the %s extension of the spec event", extension)
+				}
+			}
+
+			// the spec event of the source is decoded by the agent
+			work, err := codecs[0].Decode(evt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(work.UID) != resource.ResourceID || len(work.Spec.Workload.Manifests) != 1 {
+				t.Errorf("expected the manifest work of resource %s, but got %v", resource.ResourceID, work)
+			}
+		})
+	}
+}
+
+func TestBuildCodecsSignStatus(t *testing.T) {
+	sourceSigningKeyring, agentSigningKeyringFile := newTestSigningKeyrings(t)
+
+	workOptions := spoke.NewWorkloadAgentOptions()
+	workOptions.CloudEventsClientCodecs = []string{manifestCodecName, manifestBundleCodecName}
+	config := &workAgentConfig{workOptions: workOptions, codecOptions: newCodecOptions()}
+	config.codecOptions.signatureKeyring = agentSigningKeyringFile
+	codecs, err := config.buildCodecs(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resource := newTestResource()
+	work := &workv1.ManifestWork{
+		ObjectMeta: metav1.ObjectMeta{
+			UID:             kubetypes.UID(resource.ResourceID),
+			Name:            resource.ResourceID,
+			Namespace:       resource.ClusterName,
+			ResourceVersion: "1",
+			Labels:          map[string]string{common.CloudEventsOriginalSourceLabelKey: resource.Source},
+		},
+		Spec: workv1.ManifestWorkSpec{Workload: workv1.ManifestsTemplate{Manifests: []workv1.Manifest{
+			{RawExtension: runtime.RawExtension{Object: resource.Spec}},
+		}}},
+	}
+	evt, err := codecs[0].Encode("cluster1-agent", types.CloudEventsType{
+		CloudEventsDataType: payload.ManifestEventDataType,
+		SubResource:         types.SubResourceStatus,
+		Action:              "update_request",
+	}, work)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the status event of the agent is verified by the source
+	sourceCodec := source.SignatureMiddleware(sourceSigningKeyring, nil)(&source.ResourceCodec{})
+	decoded, err := sourceCodec.Decode(evt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.ResourceID != resource.ResourceID {
+		t.Errorf("expected the status of resource %s, but got %s", resource.ResourceID, decoded.ResourceID)
+	}
+}
+
+// newTestSigningKeyrings returns the keyring of the source that signs as the source and verifies cluster1, and the
+// keyring file of the cluster1 agent that signs as cluster1 and verifies the source.
+func newTestSigningKeyrings(t *testing.T) (*transport.Keyring, string) {
+	sourceKey, err := transport.NewSigningKey("source-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clusterKey, err := transport.NewSigningKey("cluster1-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sourceKeyring, err := transport.LoadKeyring(writeTestKeyring(t, transport.KeyringConfig{
+		SigningKeys: []transport.KeyringKey{sourceKey},
+		VerificationKeys: map[string][]transport.KeyringKey{
+			"cluster1": {{ID: clusterKey.ID, PublicKey: clusterKey.PublicKey}},
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	agentKeyringFile := writeTestKeyring(t, transport.KeyringConfig{
+		SigningKeys: []transport.KeyringKey{clusterKey},
+		VerificationKeys: map[string][]transport.KeyringKey{
+			"source": {{ID: sourceKey.ID, PublicKey: sourceKey.PublicKey}},
+		},
+	})
+	return sourceKeyring, agentKeyringFile
+}
+
+func newTestResource() *api.Resource {
+	return &api.Resource{
+		Source:          "source",
+		ClusterName:     "cluster1",
+		ResourceID:      "2b2a1d5e-3d4f-5c6e-8a7b-9c0d1e2f3a4b",
+		ResourceVersion: 1,
+		Spec: &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": "demo", "namespace": "default"},
+		}},
+	}
+}
+
+func writeTestKeyring(t *testing.T, config transport.KeyringConfig) string {
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "keyring.yaml")
+	if err := os.WriteFile(file, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
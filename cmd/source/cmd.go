@@ -4,15 +4,20 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	cloudevents "github.com/cloudevents/sdk-go/v2"
 	"github.com/morvencao/event-based-transport-demo/pkg/source"
 	"github.com/morvencao/event-based-transport-demo/pkg/store"
+	"github.com/morvencao/event-based-transport-demo/pkg/transport"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
+	"go.opentelemetry.io/otel"
 	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/options"
 	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/options/mqtt"
 	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/types"
@@ -36,55 +41,351 @@ func NewSourceCommand() *cobra.Command {
 }
 
 type sourceOptions struct {
-	serverAddr    string
-	sourceID      string
-	transportType string
-	transportAddr string
+	serverAddr       string
+	serverTLSCert    string
+	serverTLSKey     string
+	sourceID         string
+	transportType    string
+	transportConfig  string
+	transportRoutes  string
+	maxRetries       int
+	handlerTimeout   time.Duration
+	drainGracePeriod time.Duration
+	eventStoreFile   string
+	storeFile        string
+	clusterQPS       float32
+	clusterBurst     int
+	eventPriorities  map[string]string
+	priorityWeights  map[string]int
+	mqttOptions      *transport.MQTTOptions
+	grpcOptions      *transport.GRPCOptions
+	kafkaOptions     *transport.KafkaOptions
+	httpOptions      *transport.HTTPOptions
+	connOptions      *source.ConnectionOptions
+	compression      *transport.CompressionOptions
+	keyringFile      string
+	signatureKeyring string
+	tolerantDecoding bool
+	quarantineSize   int
+	embeddedBroker   bool
+	brokerOptions    *transport.EmbeddedBrokerOptions
+	// ingestHandlers are the handlers of the HTTP transports that are served by the API server, keyed by the path
+	ingestHandlers map[string]http.Handler
 }
 
 func newSourceOptions() *sourceOptions {
-	return &sourceOptions{}
+	return &sourceOptions{
+		mqttOptions:    transport.NewMQTTOptions(),
+		grpcOptions:    transport.NewGRPCOptions(),
+		kafkaOptions:   transport.NewKafkaOptions(),
+		httpOptions:    transport.NewHTTPOptions(),
+		connOptions:    source.NewConnectionOptions(),
+		compression:    transport.NewCompressionOptions(),
+		brokerOptions:  transport.NewEmbeddedBrokerOptions(),
+		ingestHandlers: map[string]http.Handler{},
+	}
 }
 
 func (o *sourceOptions) addSourceFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&o.serverAddr, "server-addr", "localhost:8080", "Server address")
+	fs.StringVar(&o.serverTLSCert, "server-tls-cert-file", "",
+		"Cert file of the server, the server is served over TLS if it's set, it's required by the HTTP transport")
+	fs.StringVar(&o.serverTLSKey, "server-tls-key-file", "", "Key file of the server")
 	fs.StringVar(&o.sourceID, "source-id", "source", "Source ID")
-	fs.StringVar(&o.transportType, "transport-type", "mqtt", "Transport type")
-	fs.StringVar(&o.transportAddr, "transport-addr", "localhost:1883", "Transport address")
+	fs.StringVar(&o.transportType, "transport-type", "mqtt",
+		"Transport type, mqtt, grpc, kafka or http, kafka requires the binary built with the kafka build tag")
+	fs.StringVar(&o.transportConfig, "transport-config", "",
+		"YAML or JSON file of the transport config, it overrides the transport type and the flags of the transport")
+	fs.StringVar(&o.transportRoutes, "transport-routes", "",
+		"YAML or JSON file of the named transports and the cluster routing rules, it overrides the other transport flags")
+	fs.StringVar(&o.mqttOptions.BrokerHost, "transport-addr", o.mqttOptions.BrokerHost, "Address of the MQTT broker")
+	fs.DurationVar(&o.connOptions.Backoff.Duration, "reconnect-backoff", o.connOptions.Backoff.Duration,
+		"Initial backoff to connect a transport and to publish the buffered events, it's doubled on each failure")
+	fs.DurationVar(&o.connOptions.Backoff.Cap, "reconnect-max-backoff", o.connOptions.Backoff.Cap,
+		"Max backoff to connect a transport and to publish the buffered events")
+	fs.IntVar(&o.connOptions.BufferSize, "publish-buffer-size", o.connOptions.BufferSize,
+		"Max number of the events buffered while a transport is disconnected, 0 means the events are not buffered")
+	fs.IntVar(&o.connOptions.MaxFlushAttempts, "publish-max-attempts", o.connOptions.MaxFlushAttempts,
+		"Max attempts to publish a buffered event before it's handed back to the event controller, 0 means no limit")
+	fs.StringVar(&o.compression.Algorithm, "compression", "",
+		"Compression of the event data, gzip or zstd, the data is not compressed if it's empty")
+	fs.IntVar(&o.compression.Threshold, "compression-threshold", o.compression.Threshold,
+		"Size in bytes of the event data above which the data is compressed")
+	fs.IntVar(&o.compression.MaxPayloadSize, "max-payload-size", 0,
+		"Max size in bytes of the event data and extensions that the transport accepts as the event is sent, 0 means no limit")
+	fs.StringVar(&o.keyringFile, "encryption-keyring", "",
+		"YAML or JSON keyring file of the cluster public keys, the spec events are encrypted if it's set")
+	fs.StringVar(&o.signatureKeyring, "signature-keyring", "",
+		"YAML or JSON keyring file of the signing key and the cluster verification keys, the spec events are signed "+
+			"and the status events are verified if it's set. The agents must sign with the --signature-keyring of cmd/agent")
+	fs.BoolVar(&o.tolerantDecoding, "tolerant-decoding", false,
+		"Decode the malformed status events as far as possible and report the problems with the DecodeWarning condition")
+	fs.IntVar(&o.quarantineSize, "quarantine-size", 1000,
+		"Max number of the status events that fail to be decoded kept in the quarantine, 0 means no limit")
+	fs.IntVar(&o.maxRetries, "max-retries", 10, "Max retries of a failed event before it's moved to the dead-letter queue, 0 means retry forever")
+	fs.DurationVar(&o.handlerTimeout, "handler-timeout", 30*time.Second, "Timeout for handling an event, 0 means no timeout")
+	fs.DurationVar(&o.drainGracePeriod, "drain-grace-period", 30*time.Second, "Grace period for draining the events on shutdown")
+	fs.StringVar(&o.eventStoreFile, "event-store-file", "",
+		"File to persist the pending events, the pending events are kept in memory if it's empty. It requires --resource-store-file")
+	fs.StringVar(&o.storeFile, "resource-store-file", "",
+		"File to persist the resources, the resources are kept in memory if it's empty")
+	fs.Float32Var(&o.clusterQPS, "cluster-qps", 0, "Max QPS of handling events per cluster, 0 means no limit")
+	fs.IntVar(&o.clusterBurst, "cluster-burst", 10, "Max burst of handling events per cluster")
+	fs.StringToStringVar(&o.eventPriorities, "event-priorities", map[string]string{"delete_event": "high"},
+		"Default priority (high, normal or low) of the event types, e.g. delete_event=high,update_event=normal")
+	fs.StringToIntVar(&o.priorityWeights, "priority-weights", map[string]int{"high": 8, "normal": 4, "low": 1},
+		"Number of events of each priority served in a scheduling round, e.g. high=8,normal=4,low=1")
+	fs.StringVar(&o.mqttOptions.CAFile, "mqtt-ca-file", "", "CA file of the MQTT broker, TLS is enabled if it's set")
+	fs.StringVar(&o.mqttOptions.ClientCertFile, "mqtt-client-cert-file", "",
+		"Client cert file for MQTT mTLS, it's reloaded when it's rotated")
+	fs.StringVar(&o.mqttOptions.ClientKeyFile, "mqtt-client-key-file", "", "Client key file for MQTT mTLS")
+	fs.StringVar(&o.mqttOptions.Username, "mqtt-username", "", "Username to connect the MQTT broker")
+	fs.StringVar(&o.mqttOptions.Password, "mqtt-password", "", "Password to connect the MQTT broker")
+	fs.DurationVar(&o.mqttOptions.KeepAlive, "mqtt-keepalive", o.mqttOptions.KeepAlive, "Interval to ping the MQTT broker")
+	fs.IntVar(&o.mqttOptions.PubQoS, "mqtt-pub-qos", o.mqttOptions.PubQoS, "QoS to publish the MQTT messages")
+	fs.IntVar(&o.mqttOptions.SubQoS, "mqtt-sub-qos", o.mqttOptions.SubQoS, "QoS to subscribe the MQTT messages")
+	fs.DurationVar(&o.mqttOptions.DialTimeout, "mqtt-dial-timeout", o.mqttOptions.DialTimeout,
+		"Timeout to connect the MQTT broker")
+	fs.StringVar(&o.mqttOptions.Topics.SourceEvents, "mqtt-source-events-topic", o.mqttOptions.Topics.SourceEvents,
+		"Template of the MQTT topic to publish the spec events, {{.SourceID}} is replaced with the source ID")
+	fs.StringVar(&o.mqttOptions.Topics.AgentEvents, "mqtt-agent-events-topic", o.mqttOptions.Topics.AgentEvents,
+		"Template of the MQTT topic to subscribe the agent events, {{.SourceID}} is replaced with the source ID")
+	fs.StringVar(&o.mqttOptions.SharedSubscriptionGroup, "mqtt-shared-subscription-group", "",
+		"MQTT v5 shared subscription group of the agent events, the source replicas in the group load-balance the agent events")
+	fs.StringVar(&o.grpcOptions.Address, "grpc-addr", o.grpcOptions.Address, "Address of the gRPC broker")
+	fs.StringVar(&o.grpcOptions.CAFile, "grpc-ca-file", "", "CA file of the gRPC broker, TLS is enabled if it's set")
+	fs.StringVar(&o.grpcOptions.ClientCertFile, "grpc-client-cert-file", "", "Client cert file for gRPC mTLS")
+	fs.StringVar(&o.grpcOptions.ClientKeyFile, "grpc-client-key-file", "", "Client key file for gRPC mTLS")
+	fs.StringVar(&o.grpcOptions.ServerName, "grpc-server-name", "", "Server name to verify the gRPC broker certificate")
+	fs.DurationVar(&o.grpcOptions.KeepAliveTime, "grpc-keepalive-time", o.grpcOptions.KeepAliveTime,
+		"Interval to ping the gRPC broker if there is no activity")
+	fs.DurationVar(&o.grpcOptions.KeepAliveTimeout, "grpc-keepalive-timeout", o.grpcOptions.KeepAliveTimeout,
+		"Timeout to wait for the gRPC keepalive ping ack")
+	fs.BoolVar(&o.grpcOptions.KeepAlivePermitWithoutStream, "grpc-keepalive-permit-without-stream", false,
+		"Ping the gRPC broker even if there is no active stream")
+	fs.StringVar(&o.kafkaOptions.BootstrapServers, "kafka-bootstrap-servers", o.kafkaOptions.BootstrapServers,
+		"Comma separated list of the Kafka brokers")
+	fs.StringVar(&o.kafkaOptions.GroupID, "kafka-group-id", "", "Kafka consumer group, the source ID is used if it's empty")
+	fs.StringVar(&o.kafkaOptions.CAFile, "kafka-ca-file", "", "CA file of the Kafka brokers, TLS is enabled if it's set")
+	fs.StringVar(&o.kafkaOptions.ClientCertFile, "kafka-client-cert-file", "", "Client cert file for Kafka mTLS")
+	fs.StringVar(&o.kafkaOptions.ClientKeyFile, "kafka-client-key-file", "", "Client key file for Kafka mTLS")
+	fs.StringVar(&o.kafkaOptions.SASLMechanism, "kafka-sasl-mechanism", "",
+		"Kafka SASL mechanism, PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512, SASL is disabled if it's empty")
+	fs.StringVar(&o.kafkaOptions.SASLUsername, "kafka-sasl-username", "", "Kafka SASL username")
+	fs.StringVar(&o.kafkaOptions.SASLPassword, "kafka-sasl-password", "", "Kafka SASL password")
+	fs.StringToStringVar(&o.httpOptions.Endpoints, "http-endpoints", nil,
+		"Endpoints that the spec events of the clusters are POSTed to, e.g. cluster1=https://cluster1.example.com/cloudevents")
+	fs.StringVar(&o.httpOptions.EndpointTemplate, "http-endpoint-template", "",
+		"Template of the endpoint of the clusters that are not in the endpoints, {{.ClusterName}} is replaced with the cluster name")
+	fs.StringVar(&o.httpOptions.CAFile, "http-ca-file", "", "CA file of the HTTP endpoints")
+	fs.StringVar(&o.httpOptions.ClientCertFile, "http-client-cert-file", "", "Client cert file for HTTP mTLS")
+	fs.StringVar(&o.httpOptions.ClientKeyFile, "http-client-key-file", "", "Client key file for HTTP mTLS")
+	fs.StringVar(&o.httpOptions.TokenFile, "http-token-file", "", "Bearer token file that is sent with the spec events")
+	fs.StringVar(&o.httpOptions.ContentMode, "http-content-mode", o.httpOptions.ContentMode,
+		"CloudEvents content mode of the spec events, binary or structured")
+	fs.DurationVar(&o.httpOptions.Timeout, "http-timeout", o.httpOptions.Timeout, "Timeout of posting a spec event")
+	fs.StringVar(&o.httpOptions.IngestPath, "http-ingest-path", o.httpOptions.IngestPath,
+		"Path of the server route that receives the status events")
+	fs.StringVar(&o.httpOptions.IngestTokenFile, "http-ingest-token-file", "",
+		"Bearer token file that the agents must send with the status events")
+	fs.StringVar(&o.httpOptions.IngestClientCAFile, "http-ingest-client-ca-file", "",
+		"CA file of the agent client certs, the common name of a client cert must be the cluster name of its status events")
+	fs.Int64Var(&o.httpOptions.MaxBodySize, "http-max-body-size", o.httpOptions.MaxBodySize,
+		"Max size of a status event request body in bytes")
+	fs.BoolVar(&o.embeddedBroker, "embedded-broker", false,
+		"Start an in-process MQTT broker and connect the source to it, the transport address is ignored")
+	fs.StringVar(&o.brokerOptions.Address, "embedded-broker-addr", o.brokerOptions.Address,
+		"Address that the embedded MQTT broker listens on")
+	fs.StringVar(&o.brokerOptions.TLSCertFile, "embedded-broker-tls-cert-file", "",
+		"Cert file of the embedded MQTT broker, TLS is enabled if it's set")
+	fs.StringVar(&o.brokerOptions.TLSKeyFile, "embedded-broker-tls-key-file", "", "Key file of the embedded MQTT broker")
+	fs.StringVar(&o.brokerOptions.CredentialsFile, "embedded-broker-credentials-file", "",
+		"YAML or JSON file of the cluster name to password map, all clients are allowed if it's empty")
 }
 
 func (o *sourceOptions) runSource(cmd *cobra.Command, args []string) {
 	ctx, cancel := context.WithCancel(context.Background())
-	var ceSourceOptions *options.CloudEventsSourceOptions
-	switch o.transportType {
-	case "mqtt":
-		mqttOptions := &mqtt.MQTTOptions{
-			KeepAlive: 60,
-			PubQoS:    1,
-			SubQoS:    1,
-			Topics: types.Topics{
-				SourceEvents: fmt.Sprintf("sources/%s/clusters/+/sourceevents", o.sourceID),
-				AgentEvents:  fmt.Sprintf("sources/%s/clusters/+/agentevents", o.sourceID),
-			},
-			Dialer: &mqtt.MQTTDialer{
-				BrokerHost: o.transportAddr,
-				Timeout:    5 * time.Second,
-			},
-		}
-		ceSourceOptions = mqtt.NewSourceOptions(mqttOptions, fmt.Sprintf("%s-client", o.sourceID), o.sourceID)
-	default:
-		log.Fatalf("Unsupported transport type: %s", o.transportType)
+	if o.transportConfig != "" {
+		transportConfig, err := transport.LoadTransportConfig(o.transportConfig)
+		if err != nil {
+			log.Fatalf("Failed to load transport config: %v", err)
+		}
+		o.transportType = transportConfig.Type
+		transportConfig.ApplyMQTT(o.mqttOptions)
+		transportConfig.ApplyGRPC(o.grpcOptions)
+		transportConfig.ApplyKafka(o.kafkaOptions)
+		transportConfig.ApplyHTTP(o.httpOptions)
 	}
 
-	store := store.NewMemoryStore()
-	eventController := source.NewEventController()
+	if o.embeddedBroker && (o.transportType != "mqtt" || o.transportRoutes != "") {
+		log.Fatalf("The embedded broker requires the mqtt transport type without transport routes")
+	}
+
+	var broker *transport.EmbeddedBroker
+	if o.embeddedBroker {
+		if err := o.brokerOptions.Validate(); err != nil {
+			log.Fatalf("Invalid embedded broker options: %v", err)
+		}
+		// the ACL of the broker is derived from the topics of the source
+		topics, err := o.mqttOptions.SourceTopics(o.sourceID)
+		if err != nil {
+			log.Fatalf("Invalid MQTT topics: %v", err)
+		}
+		embeddedBroker, err := transport.NewEmbeddedBroker(o.brokerOptions, o.sourceID, topics)
+		if err != nil {
+			log.Fatalf("Failed to create embedded broker: %v", err)
+		}
+		if err := embeddedBroker.Start(); err != nil {
+			log.Fatalf("Failed to start embedded broker: %v", err)
+		}
+		defer embeddedBroker.Stop()
+		broker = embeddedBroker
+	}
+
+	transports := map[string]*options.CloudEventsSourceOptions{}
+	router := &source.ClusterRouter{Default: source.DefaultTransport}
+	if o.transportRoutes != "" {
+		routingConfig, err := source.LoadRoutingConfig(o.transportRoutes)
+		if err != nil {
+			log.Fatalf("Failed to load transport routes: %v", err)
+		}
+		for name, configFile := range routingConfig.Transports {
+			transportConfig, err := transport.LoadTransportConfig(configFile)
+			if err != nil {
+				log.Fatalf("Failed to load transport config of %s: %v", name, err)
+			}
+			mqttOptions, grpcOptions, kafkaOptions := transport.NewMQTTOptions(), transport.NewGRPCOptions(), transport.NewKafkaOptions()
+			httpOptions := transport.NewHTTPOptions()
+			transportConfig.ApplyMQTT(mqttOptions)
+			transportConfig.ApplyGRPC(grpcOptions)
+			transportConfig.ApplyKafka(kafkaOptions)
+			transportConfig.ApplyHTTP(httpOptions)
+			transports[name], err = o.newCloudEventsSourceOptions(ctx,
+				transportConfig.Type, mqttOptions, grpcOptions, kafkaOptions, httpOptions, nil)
+			if err != nil {
+				log.Fatalf("Invalid transport %s: %v", name, err)
+			}
+		}
+		router = &routingConfig.ClusterRouter
+	} else {
+		ceSourceOptions, err := o.newCloudEventsSourceOptions(ctx,
+			o.transportType, o.mqttOptions, o.grpcOptions, o.kafkaOptions, o.httpOptions, broker)
+		if err != nil {
+			log.Fatalf("Invalid transport: %v", err)
+		}
+		transports[source.DefaultTransport] = ceSourceOptions
+	}
+
+	if err := o.compression.Validate(); err != nil {
+		log.Fatalf("Invalid compression options: %v", err)
+	}
+
+	// the reloaded pending events refer to the resources of the last run, so they must be persisted as well
+	if o.eventStoreFile != "" && o.storeFile == "" {
+		log.Fatalf("The event store file requires the resource store file to reload the resources of the pending events")
+	}
+	store, err := newResourceStore(o.storeFile)
+	if err != nil {
+		log.Fatalf("Failed to load resource store: %v", err)
+	}
+	eventControllerOptions := source.NewEventControllerOptions()
+	eventControllerOptions.MaxRetries = o.maxRetries
+	eventControllerOptions.HandlerTimeout = o.handlerTimeout
+	eventControllerOptions.DrainGracePeriod = o.drainGracePeriod
+	eventControllerOptions.MetricsProvider = source.NewQueueMetricsProvider(prometheus.DefaultRegisterer)
+	eventControllerOptions.EventPriorities = map[source.EventType]source.EventPriority{}
+	for eventType, p := range o.eventPriorities {
+		priority, err := source.ParseEventPriority(p)
+		if err != nil {
+			log.Fatalf("Invalid event priority of %s: %v", eventType, err)
+		}
+		eventControllerOptions.EventPriorities[source.EventType(eventType)] = priority
+	}
+	eventControllerOptions.PriorityWeights = map[source.EventPriority]int{}
+	for p, weight := range o.priorityWeights {
+		priority, err := source.ParseEventPriority(p)
+		if err != nil {
+			log.Fatalf("Invalid priority weight: %v", err)
+		}
+		eventControllerOptions.PriorityWeights[priority] = weight
+	}
+	if o.eventStoreFile != "" {
+		eventStore, err := source.NewFileEventStore(o.eventStoreFile)
+		if err != nil {
+			log.Fatalf("Failed to load event store: %v", err)
+		}
+		eventControllerOptions.EventStore = eventStore
+	}
+	eventController := source.NewEventController(eventControllerOptions)
 	apiServer := source.NewAPIServer(o.serverAddr, o.sourceID, store, eventController)
+	if (o.serverTLSCert == "") != (o.serverTLSKey == "") {
+		log.Fatalf("Either both or none of --server-tls-cert-file and --server-tls-key-file must be set")
+	}
+	if o.serverTLSCert != "" {
+		apiServer.SetTLS(o.serverTLSCert, o.serverTLSKey)
+	}
+	if len(o.ingestHandlers) != 0 && o.serverTLSCert == "" {
+		log.Fatalf("The HTTP transport requires --server-tls-cert-file and --server-tls-key-file " +
+			"to receive the status events")
+	}
+	for path, handler := range o.ingestHandlers {
+		apiServer.AddIngestHandler(path, handler)
+	}
+	quarantine := source.NewQuarantine(o.quarantineSize)
+	apiServer.SetQuarantine(quarantine)
 
-	// Start the source client
-	resourceSourceClient, err := source.StartResourceSourceClient(ctx, ceSourceOptions, store)
+	// Start the source client, the transports that are not available are connected in the background
+	o.connOptions.OnStateChange = func(transport string, state source.ConnectionState, err error) {
+		if err != nil {
+			log.Printf("Transport %s is %s: %v", transport, state, err)
+			return
+		}
+		log.Printf("Transport %s is %s", transport, state)
+	}
+	// the data is compressed before it's encrypted, and the event is signed as it's sent. The status events that
+	// fail to be decoded are quarantined with their decrypted and decompressed data
+	codecMiddlewares := []source.CodecMiddleware{}
+	if o.signatureKeyring != "" {
+		keyring, err := transport.LoadKeyring(o.signatureKeyring)
+		if err != nil {
+			log.Fatalf("Failed to load signature keyring: %v", err)
+		}
+		codecMiddlewares = append(codecMiddlewares, source.SignatureMiddleware(keyring, auditRejectedEvent))
+	}
+	if o.keyringFile != "" {
+		keyring, err := transport.LoadKeyring(o.keyringFile)
+		if err != nil {
+			log.Fatalf("Failed to load encryption keyring: %v", err)
+		}
+		codecMiddlewares = append(codecMiddlewares, source.EncryptionMiddleware(keyring))
+	}
+	codecMiddlewares = append(codecMiddlewares, source.CompressionMiddleware(o.compression), source.QuarantineMiddleware(quarantine))
+	if o.tolerantDecoding {
+		codecMiddlewares = append(codecMiddlewares, source.TolerantDecodeMiddleware())
+	}
+	resourceSourceClient, err := source.StartRoutedResourceSourceClient(ctx, transports, router, o.connOptions, store,
+		codecMiddlewares...)
 	if err != nil {
 		log.Fatalf("Failed to start source client: %v", err)
 	}
+	apiServer.SetPayloadLimit(resourceSourceClient, o.compression.MaxPayloadSize)
+
+	// Add event handler middlewares
+	eventController.Use(
+		source.RecoveryMiddleware(),
+		source.LoggingMiddleware(),
+		source.MetricsMiddleware(prometheus.DefaultRegisterer),
+		source.TracingMiddleware(otel.Tracer("event-controller")),
+	)
+	if o.clusterQPS > 0 {
+		eventController.Use(source.ClusterRateLimitMiddleware(func(id string) (string, error) {
+			resource, err := store.Get(id)
+			if err != nil {
+				return "", err
+			}
+			return resource.ClusterName, nil
+		}, o.clusterQPS, o.clusterBurst))
+	}
 
 	// Add event handlers
 	eventController.AddEventHandler(source.CreateEvent, resourceSourceClient.OnCreate)
@@ -99,10 +400,80 @@ func (o *sourceOptions) runSource(cmd *cobra.Command, args []string) {
 		<-stopCh
 	}()
 
-	// Start the event controller
-	go eventController.Run(ctx)
 	// Start the API server
 	go apiServer.Start(ctx)
+	// Run the event controller, it returns after the events are drained on shutdown
+	eventController.Run(ctx)
+}
 
-	<-ctx.Done()
+// newResourceStore returns a store that persists the resources to the file, the resources are kept in memory if the
+// file is empty.
+func newResourceStore(file string) (store.Store, error) {
+	if file == "" {
+		return store.NewMemoryStore(), nil
+	}
+	return store.NewFileStore(file)
+}
+
+// auditRejectedEvent logs the status event that is rejected by the signature verification.
+func auditRejectedEvent(evt cloudevents.Event, err error) {
+	extensions := evt.Extensions()
+	log.Printf("AUDIT: rejected event id=%s type=%s source=%s cluster=%v resource=%v: %v",
+		evt.ID(), evt.Type(), evt.Source(), extensions[types.ExtensionClusterName], extensions[types.ExtensionResourceID], err)
+}
+
+// newCloudEventsSourceOptions builds the CloudEvents source options of the transport type, the MQTT transport
+// connects to the embedded broker if it's given, and the ingest handler of the HTTP transport is recorded to be
+// served by the API server.
+func (o *sourceOptions) newCloudEventsSourceOptions(
+	ctx context.Context,
+	transportType string,
+	mqttOptions *transport.MQTTOptions,
+	grpcOptions *transport.GRPCOptions,
+	kafkaOptions *transport.KafkaOptions,
+	httpOptions *transport.HTTPOptions,
+	broker *transport.EmbeddedBroker,
+) (*options.CloudEventsSourceOptions, error) {
+	switch transportType {
+	case "mqtt":
+		if err := mqttOptions.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid MQTT options: %v", err)
+		}
+		sdkMQTTOptions, err := mqttOptions.BuildMQTTOptions(ctx, o.sourceID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build MQTT options: %v", err)
+		}
+		if broker != nil {
+			// connect to the embedded broker in place of the configured broker
+			sdkMQTTOptions.Dialer = broker.Dialer()
+			sdkMQTTOptions.Dialer.Timeout = mqttOptions.DialTimeout
+			sdkMQTTOptions.Username, sdkMQTTOptions.Password = broker.SourceUsername, broker.SourcePassword
+		}
+		return mqtt.NewSourceOptions(sdkMQTTOptions, mqttOptions.ClientID(o.sourceID), o.sourceID), nil
+	case "grpc":
+		if err := grpcOptions.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid gRPC options: %v", err)
+		}
+		return transport.NewGRPCSourceOptions(grpcOptions, o.sourceID), nil
+	case "kafka":
+		if err := kafkaOptions.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid Kafka options: %v", err)
+		}
+		return transport.NewKafkaSourceOptions(kafkaOptions, o.sourceID)
+	case "http":
+		if err := httpOptions.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid HTTP options: %v", err)
+		}
+		if _, ok := o.ingestHandlers[httpOptions.IngestPath]; ok {
+			return nil, fmt.Errorf("the HTTP ingest path %s is used by another transport", httpOptions.IngestPath)
+		}
+		ceSourceOptions, httpTransport, err := transport.NewHTTPSourceOptions(httpOptions, o.sourceID)
+		if err != nil {
+			return nil, err
+		}
+		o.ingestHandlers[httpOptions.IngestPath] = httpTransport.Handler()
+		return ceSourceOptions, nil
+	default:
+		return nil, fmt.Errorf("unsupported transport type: %s", transportType)
+	}
 }
@@ -10,13 +10,42 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	kubetypes "k8s.io/apimachinery/pkg/types"
+	workv1 "open-cluster-management.io/api/work/v1"
 
 	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic"
 )
 
+// ResourceType is the type of a resource, a resource of the manifest type has one manifest in its spec, and a
+// resource of the manifest bundle type has a list of manifests that are applied and deleted together.
+type ResourceType string
+
+const (
+	ResourceTypeManifest       ResourceType = "manifest"
+	ResourceTypeManifestBundle ResourceType = "manifestbundle"
+)
+
 type ResourceStatus struct {
-	ReconcileStatus *ReconcileStatus       `json:"reconcileStatus"`
-	ContentStatus   map[string]interface{} `json:"contentStatus"`
+	// ObservedResourceVersion is the resource version of the spec that the status is reported on, the status doesn't
+	// reflect the latest spec yet if it's less than the resource version.
+	ObservedResourceVersion int64                  `json:"observedResourceVersion"`
+	ReconcileStatus         *ReconcileStatus       `json:"reconcileStatus"`
+	ContentStatus           map[string]interface{} `json:"contentStatus"`
+	// Feedbacks are the status feedback values of the feedback rules by their names, the value is an int64, a
+	// string, a bool or a decoded JSON value. An object value named `status` is set to the content status instead.
+	Feedbacks map[string]interface{} `json:"feedbacks,omitempty"`
+	// ManifestStatuses are the statuses of the manifests of a manifest bundle.
+	ManifestStatuses []ManifestStatus `json:"manifestStatuses,omitempty"`
+	// StatusHash is the hash of the ManifestWork status that the agent reported, it's sent back in the status
+	// resync requests.
+	StatusHash string `json:"statusHash,omitempty"`
+}
+
+// ManifestStatus is the status of a manifest of a manifest bundle.
+type ManifestStatus struct {
+	ResourceMeta  workv1.ManifestResourceMeta `json:"resourceMeta"`
+	Conditions    []metav1.Condition          `json:"conditions"`
+	ContentStatus map[string]interface{}      `json:"contentStatus,omitempty"`
+	Feedbacks     map[string]interface{}      `json:"feedbacks,omitempty"`
 }
 
 type ReconcileStatus struct {
@@ -25,13 +54,25 @@ type ReconcileStatus struct {
 }
 
 type Resource struct {
+	// Type is the resource type, it's manifest if it's empty.
+	Type              ResourceType               `json:"type,omitempty"`
 	Source            string                     `json:"source"`
 	ClusterName       string                     `json:"clusterName"`
 	ResourceID        string                     `json:"resourceID"`
 	ResourceVersion   int64                      `json:"resourceVersion"`
 	DeletionTimestamp time.Time                  `json:"deletionTimestamp"`
 	Spec              *unstructured.Unstructured `json:"spec"`
-	Status            *ResourceStatus            `json:"status"`
+	// Manifests are the manifests of a manifest bundle.
+	Manifests []unstructured.Unstructured `json:"manifests,omitempty"`
+	// FeedbackRules are the rules of the status that the agent feeds back, the whole `.status` is fed back as the
+	// content status if it's empty.
+	FeedbackRules []workv1.FeedbackRule `json:"feedbackRules,omitempty"`
+	// UpdateStrategy is the strategy that the agent updates the resource with, it's ServerSideApply if it's not set.
+	UpdateStrategy *workv1.UpdateStrategy `json:"updateStrategy,omitempty"`
+	// DeleteOption is the deletion propagation of the resource when it's deleted from the source, it's Foreground
+	// if it's not set.
+	DeleteOption *workv1.DeleteOption `json:"deleteOption,omitempty"`
+	Status       *ResourceStatus      `json:"status"`
 }
 
 var _ generic.ResourceObject = &Resource{}
@@ -51,6 +92,11 @@ func NewResource(name, clusterName string, resourceVersion int64, objectJSON str
 	}, nil
 }
 
+// IsBundle returns true if the resource is a manifest bundle.
+func (r *Resource) IsBundle() bool {
+	return r.Type == ResourceTypeManifestBundle
+}
+
 func (r *Resource) GetUID() kubetypes.UID {
 	return kubetypes.UID(r.ResourceID)
 }
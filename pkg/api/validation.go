@@ -0,0 +1,151 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	workv1 "open-cluster-management.io/api/work/v1"
+)
+
+// Validate validates the fields of the resource that are set by the users.
+func (r *Resource) Validate() error {
+	var errs []error
+	switch r.Type {
+	case "", ResourceTypeManifest:
+		if r.Spec == nil {
+			errs = append(errs, fmt.Errorf("spec is required"))
+		}
+		if len(r.Manifests) != 0 {
+			errs = append(errs, fmt.Errorf("manifests can't be set for the %s type", ResourceTypeManifest))
+		}
+	case ResourceTypeManifestBundle:
+		if r.Spec != nil {
+			errs = append(errs, fmt.Errorf("spec can't be set for the %s type, use manifests", ResourceTypeManifestBundle))
+		}
+		if len(r.Manifests) == 0 {
+			errs = append(errs, fmt.Errorf("manifests are required for the %s type", ResourceTypeManifestBundle))
+		}
+		for i, manifest := range r.Manifests {
+			if manifest.GetKind() == "" || manifest.GetAPIVersion() == "" || manifest.GetName() == "" {
+				errs = append(errs, fmt.Errorf("manifests[%d]: apiVersion, kind and name are required", i))
+			}
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unsupported type %q, it should be %s or %s",
+			r.Type, ResourceTypeManifest, ResourceTypeManifestBundle))
+	}
+
+	if err := ValidateFeedbackRules(r.FeedbackRules); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := ValidateUpdateStrategy(r.UpdateStrategy); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := ValidateDeleteOption(r.DeleteOption); err != nil {
+		errs = append(errs, err)
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// ValidateFeedbackRules validates the feedback rules, the names of the JSON paths must be unique since the values
+// are reported by their names.
+func ValidateFeedbackRules(rules []workv1.FeedbackRule) error {
+	var errs []error
+	names := map[string]bool{}
+	for i, rule := range rules {
+		switch rule.Type {
+		case workv1.WellKnownStatusType:
+			if len(rule.JsonPaths) != 0 {
+				errs = append(errs, fmt.Errorf("feedbackRules[%d]: jsonPaths can't be set for the %s type", i, rule.Type))
+			}
+		case workv1.JSONPathsType:
+			if len(rule.JsonPaths) == 0 {
+				errs = append(errs, fmt.Errorf("feedbackRules[%d]: jsonPaths are required for the %s type", i, rule.Type))
+			}
+			for j, path := range rule.JsonPaths {
+				switch {
+				case path.Name == "":
+					errs = append(errs, fmt.Errorf("feedbackRules[%d].jsonPaths[%d]: name is required", i, j))
+				case names[path.Name]:
+					errs = append(errs, fmt.Errorf("feedbackRules[%d].jsonPaths[%d]: duplicated name %s", i, j, path.Name))
+				}
+				names[path.Name] = true
+
+				if path.Path == "" {
+					errs = append(errs, fmt.Errorf("feedbackRules[%d].jsonPaths[%d]: path is required", i, j))
+				}
+			}
+		default:
+			errs = append(errs, fmt.Errorf("feedbackRules[%d]: unsupported type %q, it should be %s or %s",
+				i, rule.Type, workv1.WellKnownStatusType, workv1.JSONPathsType))
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// ValidateUpdateStrategy validates the update strategy, the server side apply config is only allowed with the
+// ServerSideApply type, and its field manager must have the work-agent prefix as the agent requires.
+func ValidateUpdateStrategy(strategy *workv1.UpdateStrategy) error {
+	if strategy == nil {
+		return nil
+	}
+
+	var errs []error
+	switch strategy.Type {
+	case workv1.UpdateStrategyTypeUpdate, workv1.UpdateStrategyTypeCreateOnly, workv1.UpdateStrategyTypeReadOnly:
+		if strategy.ServerSideApply != nil {
+			errs = append(errs, fmt.Errorf("updateStrategy: serverSideApply can't be set for the %s type", strategy.Type))
+		}
+	case workv1.UpdateStrategyTypeServerSideApply:
+		if strategy.ServerSideApply != nil && strategy.ServerSideApply.FieldManager != "" &&
+			!strings.HasPrefix(strategy.ServerSideApply.FieldManager, workv1.DefaultFieldManager) {
+			errs = append(errs, fmt.Errorf("updateStrategy.serverSideApply: fieldManager %q should have the prefix %s",
+				strategy.ServerSideApply.FieldManager, workv1.DefaultFieldManager))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("updateStrategy: unsupported type %q, it should be %s, %s, %s or %s",
+			strategy.Type, workv1.UpdateStrategyTypeUpdate, workv1.UpdateStrategyTypeCreateOnly,
+			workv1.UpdateStrategyTypeReadOnly, workv1.UpdateStrategyTypeServerSideApply))
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// ValidateDeleteOption validates the delete option, the orphaning rules are required by and only allowed with
+// the SelectivelyOrphan propagation policy.
+func ValidateDeleteOption(option *workv1.DeleteOption) error {
+	if option == nil {
+		return nil
+	}
+
+	var errs []error
+	switch option.PropagationPolicy {
+	case workv1.DeletePropagationPolicyTypeForeground, workv1.DeletePropagationPolicyTypeOrphan:
+		if option.SelectivelyOrphan != nil {
+			errs = append(errs, fmt.Errorf("deleteOption: selectivelyOrphans can't be set for the %s policy",
+				option.PropagationPolicy))
+		}
+	case workv1.DeletePropagationPolicyTypeSelectivelyOrphan:
+		if option.SelectivelyOrphan == nil || len(option.SelectivelyOrphan.OrphaningRules) == 0 {
+			errs = append(errs, fmt.Errorf("deleteOption: selectivelyOrphans are required for the %s policy",
+				option.PropagationPolicy))
+			break
+		}
+		for i, rule := range option.SelectivelyOrphan.OrphaningRules {
+			if rule.Resource == "" || rule.Name == "" {
+				errs = append(errs, fmt.Errorf("deleteOption.selectivelyOrphans.orphaningRules[%d]: resource and name are required", i))
+			}
+		}
+	default:
+		errs = append(errs, fmt.Errorf("deleteOption: unsupported propagationPolicy %q, it should be %s, %s or %s",
+			option.PropagationPolicy, workv1.DeletePropagationPolicyTypeForeground,
+			workv1.DeletePropagationPolicyTypeOrphan, workv1.DeletePropagationPolicyTypeSelectivelyOrphan))
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
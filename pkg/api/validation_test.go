@@ -0,0 +1,144 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	workv1 "open-cluster-management.io/api/work/v1"
+)
+
+func TestValidate(t *testing.T) {
+	deployment := unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "nginx", "namespace": "default"},
+	}}
+
+	cases := []struct {
+		name        string
+		resource    *Resource
+		expectedErr string
+	}{
+		{
+			name:     "manifest",
+			resource: &Resource{Spec: &deployment},
+		},
+		{
+			name:        "manifest without spec",
+			resource:    &Resource{Type: ResourceTypeManifest},
+			expectedErr: "spec is required",
+		},
+		{
+			name:     "manifest bundle",
+			resource: &Resource{Type: ResourceTypeManifestBundle, Manifests: []unstructured.Unstructured{deployment}},
+		},
+		{
+			name: "manifest bundle with invalid manifest",
+			resource: &Resource{Type: ResourceTypeManifestBundle, Manifests: []unstructured.Unstructured{
+				deployment, {Object: map[string]interface{}{"kind": "ConfigMap"}}}},
+			expectedErr: "manifests[1]: apiVersion, kind and name are required",
+		},
+		{
+			name:        "unsupported type",
+			resource:    &Resource{Type: "chart", Spec: &deployment},
+			expectedErr: `unsupported type "chart", it should be manifest or manifestbundle`,
+		},
+		{
+			name: "server side apply with work-agent field manager",
+			resource: &Resource{Spec: &deployment, UpdateStrategy: &workv1.UpdateStrategy{
+				Type:            workv1.UpdateStrategyTypeServerSideApply,
+				ServerSideApply: &workv1.ServerSideApplyConfig{FieldManager: "work-agent-nginx"},
+			}},
+		},
+		{
+			name: "server side apply with another field manager",
+			resource: &Resource{Spec: &deployment, UpdateStrategy: &workv1.UpdateStrategy{
+				Type:            workv1.UpdateStrategyTypeServerSideApply,
+				ServerSideApply: &workv1.ServerSideApplyConfig{FieldManager: "kubectl"},
+			}},
+			expectedErr: `updateStrategy.serverSideApply: fieldManager "kubectl" should have the prefix work-agent`,
+		},
+		{
+			name: "server side apply config of the update type",
+			resource: &Resource{Spec: &deployment, UpdateStrategy: &workv1.UpdateStrategy{
+				Type:            workv1.UpdateStrategyTypeUpdate,
+				ServerSideApply: &workv1.ServerSideApplyConfig{},
+			}},
+			expectedErr: "updateStrategy: serverSideApply can't be set for the Update type",
+		},
+		{
+			name:        "unsupported update strategy",
+			resource:    &Resource{Spec: &deployment, UpdateStrategy: &workv1.UpdateStrategy{Type: "Replace"}},
+			expectedErr: `updateStrategy: unsupported type "Replace"`,
+		},
+		{
+			name: "selectively orphan",
+			resource: &Resource{Spec: &deployment, DeleteOption: &workv1.DeleteOption{
+				PropagationPolicy: workv1.DeletePropagationPolicyTypeSelectivelyOrphan,
+				SelectivelyOrphan: &workv1.SelectivelyOrphan{OrphaningRules: []workv1.OrphaningRule{
+					{Group: "apps", Resource: "deployments", Namespace: "default", Name: "nginx"}}},
+			}},
+		},
+		{
+			name: "selectively orphan without rules",
+			resource: &Resource{Spec: &deployment, DeleteOption: &workv1.DeleteOption{
+				PropagationPolicy: workv1.DeletePropagationPolicyTypeSelectivelyOrphan,
+			}},
+			expectedErr: "deleteOption: selectivelyOrphans are required for the SelectivelyOrphan policy",
+		},
+		{
+			name: "selectively orphan with incomplete rule",
+			resource: &Resource{Spec: &deployment, DeleteOption: &workv1.DeleteOption{
+				PropagationPolicy: workv1.DeletePropagationPolicyTypeSelectivelyOrphan,
+				SelectivelyOrphan: &workv1.SelectivelyOrphan{OrphaningRules: []workv1.OrphaningRule{{Resource: "deployments"}}},
+			}},
+			expectedErr: "deleteOption.selectivelyOrphans.orphaningRules[0]: resource and name are required",
+		},
+		{
+			name: "orphaning rules of the foreground policy",
+			resource: &Resource{Spec: &deployment, DeleteOption: &workv1.DeleteOption{
+				PropagationPolicy: workv1.DeletePropagationPolicyTypeForeground,
+				SelectivelyOrphan: &workv1.SelectivelyOrphan{},
+			}},
+			expectedErr: "deleteOption: selectivelyOrphans can't be set for the Foreground policy",
+		},
+		{
+			name:        "unsupported propagation policy",
+			resource:    &Resource{Spec: &deployment, DeleteOption: &workv1.DeleteOption{PropagationPolicy: "Background"}},
+			expectedErr: `deleteOption: unsupported propagationPolicy "Background"`,
+		},
+		{
+			name: "duplicated feedback names",
+			resource: &Resource{Spec: &deployment, FeedbackRules: []workv1.FeedbackRule{{
+				Type: workv1.JSONPathsType,
+				JsonPaths: []workv1.JsonPath{
+					{Name: "replicas", Path: ".status.replicas"},
+					{Name: "replicas", Path: ".status.readyReplicas"},
+				},
+			}}},
+			expectedErr: "feedbackRules[0].jsonPaths[1]: duplicated name replicas",
+		},
+		{
+			name: "all errors are reported",
+			resource: &Resource{
+				UpdateStrategy: &workv1.UpdateStrategy{Type: "Replace"},
+				DeleteOption:   &workv1.DeleteOption{PropagationPolicy: workv1.DeletePropagationPolicyTypeSelectivelyOrphan},
+			},
+			expectedErr: `[spec is required, updateStrategy: unsupported type "Replace", it should be Update, CreateOnly, ` +
+				`ReadOnly or ServerSideApply, deleteOption: selectivelyOrphans are required for the SelectivelyOrphan policy]`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.resource.Validate()
+			switch {
+			case c.expectedErr == "" && err != nil:
+				t.Fatalf("unexpected error %v", err)
+			case c.expectedErr != "" && (err == nil || !strings.Contains(err.Error(), c.expectedErr)):
+				t.Fatalf("expected error %q, but got %v", c.expectedErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package conformance_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/morvencao/event-based-transport-demo/pkg/api"
+	"github.com/morvencao/event-based-transport-demo/pkg/source"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	kubetypes "k8s.io/apimachinery/pkg/types"
+	workv1 "open-cluster-management.io/api/work/v1"
+
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/types"
+	cloudeventswork "open-cluster-management.io/sdk-go/pkg/cloudevents/work"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/work/agent/codec"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/work/payload"
+)
+
+var (
+	bundleSpecEventType   = withDataType(specEventType, payload.ManifestBundleEventDataType)
+	bundleStatusEventType = withDataType(statusEventType, payload.ManifestBundleEventDataType)
+)
+
+// The bundle conformance tests check the ResourceBundleCodec of the source works with the sdk-go agent
+// ManifestBundleCodec in the same way as the manifest conformance tests.
+
+func TestBundleSpecRoundTrip(t *testing.T) {
+	for name, fixture := range bundleSpecFixtures() {
+		t.Run(name, func(t *testing.T) {
+			if err := checkBundleSpecRoundTrip(fixture.resource, fixture.expectedIdentifiers); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestBundleStatusRoundTrip(t *testing.T) {
+	for name, fixture := range bundleStatusFixtures() {
+		t.Run(name, func(t *testing.T) {
+			if err := checkBundleStatusRoundTrip(fixture.work, fixture.expected); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// checkBundleSpecRoundTrip encodes the bundle with the source codec and decodes the spec event with the agent
+// codec, then checks the manifest work has the manifests of the bundle, and each manifest is configured by the
+// expected resource identifier, the source guesses the resource of a manifest from its kind.
+func checkBundleSpecRoundTrip(resource *api.Resource, expectedIdentifiers []workv1.ResourceIdentifier) error {
+	evt, err := (&source.ResourceBundleCodec{}).Encode(sourceID, bundleSpecEventType, resource)
+	if err != nil {
+		return fmt.Errorf("failed to encode resource, %v", err)
+	}
+
+	work, err := codec.NewManifestBundleCodec().Decode(evt)
+	if err != nil {
+		return fmt.Errorf("failed to decode spec event with the agent codec, %v", err)
+	}
+
+	if work.UID != kubetypes.UID(resource.ResourceID) {
+		return fmt.Errorf("expected uid %s, but got %s", resource.ResourceID, work.UID)
+	}
+	if work.ResourceVersion != resource.GetResourceVersion() {
+		return fmt.Errorf("expected resource version %s, but got %s", resource.GetResourceVersion(), work.ResourceVersion)
+	}
+	if work.Namespace != resource.ClusterName {
+		return fmt.Errorf("expected namespace %s, but got %s", resource.ClusterName, work.Namespace)
+	}
+
+	if !resource.DeletionTimestamp.IsZero() {
+		if work.DeletionTimestamp == nil || !work.DeletionTimestamp.Time.Equal(resource.DeletionTimestamp) {
+			return fmt.Errorf("expected deletion timestamp %v, but got %v", resource.DeletionTimestamp, work.DeletionTimestamp)
+		}
+		return nil
+	}
+
+	if len(work.Spec.Workload.Manifests) != len(resource.Manifests) {
+		return fmt.Errorf("expected %d manifests, but got %d", len(resource.Manifests), len(work.Spec.Workload.Manifests))
+	}
+	for i, manifest := range resource.Manifests {
+		if err := compareJSON(fmt.Sprintf("manifest %d", i), manifest.Object, work.Spec.Workload.Manifests[i].Raw); err != nil {
+			return err
+		}
+	}
+
+	expectedDeleteOption := resource.DeleteOption
+	if expectedDeleteOption == nil {
+		expectedDeleteOption = &workv1.DeleteOption{PropagationPolicy: workv1.DeletePropagationPolicyTypeForeground}
+	}
+	if !equality.Semantic.DeepEqual(work.Spec.DeleteOption, expectedDeleteOption) {
+		return fmt.Errorf("expected delete option %v, but got %v", expectedDeleteOption, work.Spec.DeleteOption)
+	}
+
+	if len(work.Spec.ManifestConfigs) != len(expectedIdentifiers) {
+		return fmt.Errorf("expected %d manifest configs, but got %d", len(expectedIdentifiers), len(work.Spec.ManifestConfigs))
+	}
+	for i, config := range work.Spec.ManifestConfigs {
+		if config.ResourceIdentifier != expectedIdentifiers[i] {
+			return fmt.Errorf("expected resource identifier %v of manifest %d, but got %v",
+				expectedIdentifiers[i], i, config.ResourceIdentifier)
+		}
+		if resource.UpdateStrategy != nil && !equality.Semantic.DeepEqual(config.UpdateStrategy, resource.UpdateStrategy) {
+			return fmt.Errorf("expected update strategy %v, but got %v", resource.UpdateStrategy, config.UpdateStrategy)
+		}
+	}
+
+	return nil
+}
+
+// checkBundleStatusRoundTrip encodes the status of the manifest work with the agent codec and decodes the status
+// event with the source codec, then checks the status of the bundle is the expected status.
+func checkBundleStatusRoundTrip(work *workv1.ManifestWork, expected *api.ResourceStatus) error {
+	evt, err := codec.NewManifestBundleCodec().Encode(clusterName+"-agent", bundleStatusEventType, work)
+	if err != nil {
+		return fmt.Errorf("failed to encode status with the agent codec, %v", err)
+	}
+
+	resource, err := (&source.ResourceBundleCodec{}).Decode(evt)
+	if err != nil {
+		return fmt.Errorf("failed to decode status event, %v", err)
+	}
+
+	if resource.ResourceID != string(work.UID) {
+		return fmt.Errorf("expected resource id %s, but got %s", work.UID, resource.ResourceID)
+	}
+	if resource.Type != api.ResourceTypeManifestBundle {
+		return fmt.Errorf("expected resource type %s, but got %s", api.ResourceTypeManifestBundle, resource.Type)
+	}
+	if resource.Status == nil || resource.Status.ReconcileStatus == nil {
+		return fmt.Errorf("expected the reconcile status, but got none")
+	}
+	if resource.Status.ReconcileStatus.SequenceID == "" {
+		return fmt.Errorf("expected the sequence id, but got none")
+	}
+
+	workStatusHash, err := cloudeventswork.ManifestWorkStatusHash(work)
+	if err != nil {
+		return err
+	}
+	if resource.Status.StatusHash != workStatusHash {
+		return fmt.Errorf("expected status hash %s, but got %s", workStatusHash, resource.Status.StatusHash)
+	}
+
+	status := *resource.Status
+	reconcileStatus := *resource.Status.ReconcileStatus
+	reconcileStatus.SequenceID = ""
+	status.ReconcileStatus = &reconcileStatus
+	status.StatusHash = ""
+	if !equality.Semantic.DeepEqual(&status, expected) {
+		actualJSON, _ := json.Marshal(&status)
+		expectedJSON, _ := json.Marshal(expected)
+		return fmt.Errorf("expected status %s, but got %s", expectedJSON, actualJSON)
+	}
+
+	return nil
+}
+
+type bundleSpecFixture struct {
+	resource            *api.Resource
+	expectedIdentifiers []workv1.ResourceIdentifier
+}
+
+func bundleSpecFixtures() map[string]bundleSpecFixture {
+	deployment := map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "nginx", "namespace": "default"},
+	}
+	networkPolicy := map[string]interface{}{
+		"apiVersion": "networking.k8s.io/v1",
+		"kind":       "NetworkPolicy",
+		"metadata":   map[string]interface{}{"name": "deny-all", "namespace": "default"},
+	}
+	clusterRole := map[string]interface{}{
+		"apiVersion": "rbac.authorization.k8s.io/v1",
+		"kind":       "ClusterRole",
+		"metadata":   map[string]interface{}{"name": "reader"},
+	}
+
+	bundle := newBundle(configMap(), deployment, networkPolicy, clusterRole)
+	bundle.UpdateStrategy = &workv1.UpdateStrategy{Type: workv1.UpdateStrategyTypeServerSideApply}
+	bundle.DeleteOption = &workv1.DeleteOption{PropagationPolicy: workv1.DeletePropagationPolicyTypeOrphan}
+
+	deleted := newBundle(configMap())
+	deleted.DeletionTimestamp = time.Date(2024, 10, 1, 8, 30, 15, 0, time.UTC)
+
+	return map[string]bundleSpecFixture{
+		"manifests": {
+			resource: bundle,
+			expectedIdentifiers: []workv1.ResourceIdentifier{
+				{Resource: "configmaps", Name: "demo", Namespace: "default"},
+				{Group: "apps", Resource: "deployments", Name: "nginx", Namespace: "default"},
+				{Group: "networking.k8s.io", Resource: "networkpolicies", Name: "deny-all", Namespace: "default"},
+				{Group: "rbac.authorization.k8s.io", Resource: "clusterroles", Name: "reader"},
+			},
+		},
+		"deletion": {resource: deleted},
+	}
+}
+
+type bundleStatusFixture struct {
+	work     *workv1.ManifestWork
+	expected *api.ResourceStatus
+}
+
+func bundleStatusFixtures() map[string]bundleStatusFixture {
+	applied := metav1.Condition{
+		Type:               workv1.WorkApplied,
+		Status:             metav1.ConditionTrue,
+		Reason:             "AppliedManifestComplete",
+		LastTransitionTime: metav1.NewTime(time.Date(2024, 10, 1, 8, 30, 15, 0, time.UTC)),
+	}
+	available := metav1.Condition{
+		Type:               workv1.WorkAvailable,
+		Status:             metav1.ConditionTrue,
+		Reason:             "ResourcesAvailable",
+		LastTransitionTime: metav1.NewTime(time.Date(2024, 10, 1, 8, 30, 20, 0, time.UTC)),
+	}
+	replicas := int64(2)
+	contentStatus := `{"readyReplicas":2}`
+	configMapMeta := workv1.ManifestResourceMeta{
+		Ordinal: 0, Version: "v1", Kind: "ConfigMap", Resource: "configmaps", Name: "demo", Namespace: "default"}
+	deploymentMeta := workv1.ManifestResourceMeta{
+		Ordinal: 1, Group: "apps", Version: "v1", Kind: "Deployment", Resource: "deployments", Name: "nginx",
+		Namespace: "default"}
+
+	work := newWork()
+	work.Status.Conditions = []metav1.Condition{applied, available}
+	work.Status.ResourceStatus.Manifests = []workv1.ManifestCondition{
+		{ResourceMeta: configMapMeta, Conditions: []metav1.Condition{applied}},
+		{
+			ResourceMeta: deploymentMeta,
+			Conditions:   []metav1.Condition{applied, available},
+			StatusFeedbacks: workv1.StatusFeedbackResult{
+				Values: []workv1.FeedbackValue{
+					{Name: "status", Value: workv1.FieldValue{Type: workv1.JsonRaw, JsonRaw: &contentStatus}},
+					{Name: "replicas", Value: workv1.FieldValue{Type: workv1.Integer, Integer: &replicas}},
+				},
+			},
+		},
+	}
+
+	return map[string]bundleStatusFixture{
+		"manifest-statuses": {
+			work: work,
+			expected: &api.ResourceStatus{
+				ObservedResourceVersion: 3,
+				ReconcileStatus: &api.ReconcileStatus{
+					Conditions: []metav1.Condition{applied, available},
+				},
+				// the manifest statuses keep the ordinals of the manifests in the bundle
+				ManifestStatuses: []api.ManifestStatus{
+					{ResourceMeta: configMapMeta, Conditions: []metav1.Condition{applied}},
+					{
+						ResourceMeta:  deploymentMeta,
+						Conditions:    []metav1.Condition{applied, available},
+						ContentStatus: map[string]interface{}{"readyReplicas": float64(2)},
+						Feedbacks:     map[string]interface{}{"replicas": int64(2)},
+					},
+				},
+			},
+		},
+	}
+}
+
+func newBundle(objects ...map[string]interface{}) *api.Resource {
+	resource := newResource(nil)
+	resource.Type = api.ResourceTypeManifestBundle
+	resource.Spec = nil
+	for _, object := range objects {
+		resource.Manifests = append(resource.Manifests, unstructured.Unstructured{Object: object})
+	}
+	return resource
+}
+
+func withDataType(eventType types.CloudEventsType, dataType types.CloudEventsDataType) types.CloudEventsType {
+	eventType.CloudEventsDataType = dataType
+	return eventType
+}
@@ -0,0 +1,458 @@
+package conformance_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/morvencao/event-based-transport-demo/pkg/api"
+	"github.com/morvencao/event-based-transport-demo/pkg/source"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubetypes "k8s.io/apimachinery/pkg/types"
+	workv1 "open-cluster-management.io/api/work/v1"
+
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/types"
+	cloudeventswork "open-cluster-management.io/sdk-go/pkg/cloudevents/work"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/work/agent/codec"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/work/common"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/work/payload"
+)
+
+const (
+	sourceID    = "source"
+	clusterName = "cluster1"
+	resourceID  = "2b2a1d5e-3d4f-5c6e-8a7b-9c0d1e2f3a4b"
+)
+
+var (
+	specEventType = types.CloudEventsType{
+		CloudEventsDataType: payload.ManifestEventDataType,
+		SubResource:         types.SubResourceSpec,
+		Action:              "update_request",
+	}
+	statusEventType = types.CloudEventsType{
+		CloudEventsDataType: payload.ManifestEventDataType,
+		SubResource:         types.SubResourceStatus,
+		Action:              "update_request",
+	}
+)
+
+// The conformance tests check that the resource codecs of the source work with the sdk-go agent codecs, so a
+// mismatch between the source and the agent is found without a live cluster. The spec events are encoded by the
+// source codec and decoded by the agent codec, and the status events are encoded by the agent codec and decoded by
+// the source codec.
+
+func TestSpecRoundTrip(t *testing.T) {
+	for name, resource := range specFixtures() {
+		t.Run(name, func(t *testing.T) {
+			if err := checkSpecRoundTrip(resource); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestStatusRoundTrip(t *testing.T) {
+	for name, fixture := range statusFixtures() {
+		t.Run(name, func(t *testing.T) {
+			if err := checkStatusRoundTrip(fixture.work, fixture.expected); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	for name, fixture := range errorFixtures() {
+		t.Run(name, func(t *testing.T) {
+			if err := checkDecodeError(fixture); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// checkSpecRoundTrip encodes the resource with the source codec and decodes the spec event with the agent codec,
+// then checks the manifest work has the manifest and the options of the resource.
+func checkSpecRoundTrip(resource *api.Resource) error {
+	evt, err := (&source.ResourceCodec{}).Encode(sourceID, specEventType, resource)
+	if err != nil {
+		return fmt.Errorf("failed to encode resource, %v", err)
+	}
+
+	work, err := codec.NewManifestCodec(nil).Decode(evt)
+	if err != nil {
+		return fmt.Errorf("failed to decode spec event with the agent codec, %v", err)
+	}
+
+	if work.UID != kubetypes.UID(resource.ResourceID) {
+		return fmt.Errorf("expected uid %s, but got %s", resource.ResourceID, work.UID)
+	}
+	if work.ResourceVersion != resource.GetResourceVersion() {
+		return fmt.Errorf("expected resource version %s, but got %s", resource.GetResourceVersion(), work.ResourceVersion)
+	}
+	if work.Namespace != resource.ClusterName {
+		return fmt.Errorf("expected namespace %s, but got %s", resource.ClusterName, work.Namespace)
+	}
+	if work.Labels[common.CloudEventsOriginalSourceLabelKey] != resource.Source {
+		return fmt.Errorf("expected original source %s, but got %s",
+			resource.Source, work.Labels[common.CloudEventsOriginalSourceLabelKey])
+	}
+
+	if !resource.DeletionTimestamp.IsZero() {
+		if work.DeletionTimestamp == nil || !work.DeletionTimestamp.Time.Equal(resource.DeletionTimestamp) {
+			return fmt.Errorf("expected deletion timestamp %v, but got %v", resource.DeletionTimestamp, work.DeletionTimestamp)
+		}
+		return nil
+	}
+	if work.DeletionTimestamp != nil {
+		return fmt.Errorf("expected no deletion timestamp, but got %v", work.DeletionTimestamp)
+	}
+
+	if len(work.Spec.Workload.Manifests) != 1 {
+		return fmt.Errorf("expected 1 manifest, but got %d", len(work.Spec.Workload.Manifests))
+	}
+	if err := compareJSON("manifest", resource.Spec.Object, work.Spec.Workload.Manifests[0].Raw); err != nil {
+		return err
+	}
+
+	expectedDeleteOption := resource.DeleteOption
+	if expectedDeleteOption == nil {
+		expectedDeleteOption = &workv1.DeleteOption{PropagationPolicy: workv1.DeletePropagationPolicyTypeForeground}
+	}
+	if !equality.Semantic.DeepEqual(work.Spec.DeleteOption, expectedDeleteOption) {
+		return fmt.Errorf("expected delete option %v, but got %v", expectedDeleteOption, work.Spec.DeleteOption)
+	}
+
+	if len(work.Spec.ManifestConfigs) != 1 {
+		return fmt.Errorf("expected 1 manifest config, but got %d", len(work.Spec.ManifestConfigs))
+	}
+	config := work.Spec.ManifestConfigs[0]
+	if config.ResourceIdentifier.Name != resource.Spec.GetName() ||
+		config.ResourceIdentifier.Namespace != resource.Spec.GetNamespace() {
+		return fmt.Errorf("expected manifest config of %s/%s, but got %s/%s", resource.Spec.GetNamespace(),
+			resource.Spec.GetName(), config.ResourceIdentifier.Namespace, config.ResourceIdentifier.Name)
+	}
+	if len(resource.FeedbackRules) != 0 && !equality.Semantic.DeepEqual(config.FeedbackRules, resource.FeedbackRules) {
+		return fmt.Errorf("expected feedback rules %v, but got %v", resource.FeedbackRules, config.FeedbackRules)
+	}
+	if len(resource.FeedbackRules) == 0 && len(config.FeedbackRules) == 0 {
+		return fmt.Errorf("expected the default feedback rule of the status, but got none")
+	}
+	if resource.UpdateStrategy != nil && !equality.Semantic.DeepEqual(config.UpdateStrategy, resource.UpdateStrategy) {
+		return fmt.Errorf("expected update strategy %v, but got %v", resource.UpdateStrategy, config.UpdateStrategy)
+	}
+
+	return nil
+}
+
+// checkStatusRoundTrip encodes the status of the manifest work with the agent codec and decodes the status event
+// with the source codec, then checks the status of the resource is the expected status. The sequence ID is
+// generated by the agent codec, so it's only checked to be set.
+func checkStatusRoundTrip(work *workv1.ManifestWork, expected *api.ResourceStatus) error {
+	evt, err := codec.NewManifestCodec(nil).Encode(clusterName+"-agent", statusEventType, work)
+	if err != nil {
+		return fmt.Errorf("failed to encode status with the agent codec, %v", err)
+	}
+
+	resource, err := (&source.ResourceCodec{}).Decode(evt)
+	if err != nil {
+		return fmt.Errorf("failed to decode status event, %v", err)
+	}
+
+	if resource.ResourceID != string(work.UID) {
+		return fmt.Errorf("expected resource id %s, but got %s", work.UID, resource.ResourceID)
+	}
+	if resource.GetResourceVersion() != work.ResourceVersion {
+		return fmt.Errorf("expected resource version %s, but got %d", work.ResourceVersion, resource.ResourceVersion)
+	}
+	if resource.ClusterName != work.Namespace {
+		return fmt.Errorf("expected cluster name %s, but got %s", work.Namespace, resource.ClusterName)
+	}
+	if resource.Type != api.ResourceTypeManifest {
+		return fmt.Errorf("expected resource type %s, but got %s", api.ResourceTypeManifest, resource.Type)
+	}
+	if resource.Status == nil || resource.Status.ReconcileStatus == nil {
+		return fmt.Errorf("expected the reconcile status, but got none")
+	}
+	if resource.Status.ReconcileStatus.SequenceID == "" {
+		return fmt.Errorf("expected the sequence id, but got none")
+	}
+
+	// the status hash is the hash of the work status, so the agent doesn't resend the status on a status resync
+	workStatusHash, err := cloudeventswork.ManifestWorkStatusHash(work)
+	if err != nil {
+		return err
+	}
+	if resource.Status.StatusHash != workStatusHash {
+		return fmt.Errorf("expected status hash %s, but got %s", workStatusHash, resource.Status.StatusHash)
+	}
+
+	status := *resource.Status
+	reconcileStatus := *resource.Status.ReconcileStatus
+	reconcileStatus.SequenceID = ""
+	status.ReconcileStatus = &reconcileStatus
+	status.StatusHash = ""
+	if !equality.Semantic.DeepEqual(&status, expected) {
+		actualJSON, _ := json.Marshal(&status)
+		expectedJSON, _ := json.Marshal(expected)
+		return fmt.Errorf("expected status %s, but got %s", expectedJSON, actualJSON)
+	}
+
+	return nil
+}
+
+// errorFixture is a status event that the source codec fails to decode in the strict mode. The tolerant codec
+// decodes it with a decode warning if it's tolerated.
+type errorFixture struct {
+	evt       *cloudevents.Event
+	tolerated bool
+}
+
+func checkDecodeError(fixture errorFixture) error {
+	if _, err := (&source.ResourceCodec{}).Decode(fixture.evt); err == nil {
+		return fmt.Errorf("expected the strict codec to fail, but it succeeded")
+	}
+
+	resource, err := (&source.ResourceCodec{Tolerant: true}).Decode(fixture.evt)
+	if !fixture.tolerated {
+		if err == nil {
+			return fmt.Errorf("expected the tolerant codec to fail, but it succeeded")
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("expected the tolerant codec to succeed, but got %v", err)
+	}
+	if !hasCondition(resource, source.ConditionDecodeWarning) {
+		return fmt.Errorf("expected the %s condition, but got none", source.ConditionDecodeWarning)
+	}
+	return nil
+}
+
+func specFixtures() map[string]*api.Resource {
+	deployment := newResource(map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "nginx", "namespace": "default"},
+		"spec": map[string]interface{}{
+			"replicas": int64(2),
+			"selector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "nginx"}},
+		},
+	})
+	deployment.FeedbackRules = []workv1.FeedbackRule{
+		{Type: workv1.WellKnownStatusType},
+		{Type: workv1.JSONPathsType, JsonPaths: []workv1.JsonPath{{Name: "replicas", Path: ".status.replicas"}}},
+	}
+	deployment.UpdateStrategy = &workv1.UpdateStrategy{Type: workv1.UpdateStrategyTypeCreateOnly}
+	deployment.DeleteOption = &workv1.DeleteOption{PropagationPolicy: workv1.DeletePropagationPolicyTypeOrphan}
+
+	deleted := newResource(configMap())
+	deleted.DeletionTimestamp = time.Date(2024, 10, 1, 8, 30, 15, 0, time.UTC)
+
+	return map[string]*api.Resource{
+		"default-options": newResource(configMap()),
+		"options":         deployment,
+		"deletion":        deleted,
+	}
+}
+
+type statusFixture struct {
+	work     *workv1.ManifestWork
+	expected *api.ResourceStatus
+}
+
+func statusFixtures() map[string]statusFixture {
+	applied := metav1.Condition{
+		Type:               workv1.WorkApplied,
+		Status:             metav1.ConditionTrue,
+		Reason:             "AppliedManifestComplete",
+		LastTransitionTime: metav1.NewTime(time.Date(2024, 10, 1, 8, 30, 15, 0, time.UTC)),
+	}
+	replicas, ready, image := int64(2), true, "nginx:1.27"
+	contentStatus := `{"replicas":2,"conditions":[{"type":"Available","status":"True"}]}`
+	images := `["nginx:1.27","busybox"]`
+
+	feedbackWork := newWork()
+	feedbackWork.Status.ResourceStatus.Manifests = []workv1.ManifestCondition{
+		{
+			Conditions: []metav1.Condition{applied},
+			StatusFeedbacks: workv1.StatusFeedbackResult{
+				Values: []workv1.FeedbackValue{
+					{Name: "status", Value: workv1.FieldValue{Type: workv1.JsonRaw, JsonRaw: &contentStatus}},
+					{Name: "replicas", Value: workv1.FieldValue{Type: workv1.Integer, Integer: &replicas}},
+					{Name: "ready", Value: workv1.FieldValue{Type: workv1.Boolean, Boolean: &ready}},
+					{Name: "image", Value: workv1.FieldValue{Type: workv1.String, String: &image}},
+					{Name: "images", Value: workv1.FieldValue{Type: workv1.JsonRaw, JsonRaw: &images}},
+				},
+			},
+		},
+	}
+
+	deletedWork := newWork()
+	deletedWork.Spec.Workload.Manifests = nil
+	deletedWork.Status.Conditions = []metav1.Condition{
+		{Type: common.ManifestsDeleted, Status: metav1.ConditionTrue, Reason: "ManifestsDeleted"},
+	}
+
+	return map[string]statusFixture{
+		"feedbacks": {
+			work: feedbackWork,
+			expected: &api.ResourceStatus{
+				ObservedResourceVersion: 3,
+				ReconcileStatus: &api.ReconcileStatus{
+					Conditions: []metav1.Condition{applied},
+				},
+				ContentStatus: map[string]interface{}{
+					"replicas":   float64(2),
+					"conditions": []interface{}{map[string]interface{}{"type": "Available", "status": "True"}},
+				},
+				Feedbacks: map[string]interface{}{
+					"replicas": int64(2),
+					"ready":    true,
+					"image":    "nginx:1.27",
+					"images":   []interface{}{"nginx:1.27", "busybox"},
+				},
+			},
+		},
+		"deleted": {
+			work: deletedWork,
+			expected: &api.ResourceStatus{
+				ObservedResourceVersion: 3,
+				ReconcileStatus: &api.ReconcileStatus{
+					Conditions: []metav1.Condition{{Type: common.ManifestsDeleted, Status: metav1.ConditionTrue}},
+				},
+			},
+		},
+	}
+}
+
+func errorFixtures() map[string]errorFixture {
+	invalidFeedback := "{invalid"
+	feedbackWork := newWork()
+	feedbackWork.Status.ResourceStatus.Manifests = []workv1.ManifestCondition{
+		{
+			StatusFeedbacks: workv1.StatusFeedbackResult{
+				Values: []workv1.FeedbackValue{
+					{Name: "status", Value: workv1.FieldValue{Type: workv1.JsonRaw, JsonRaw: &invalidFeedback}},
+				},
+			},
+		},
+	}
+
+	bundleType := statusEventType
+	bundleType.CloudEventsDataType = payload.ManifestBundleEventDataType
+
+	return map[string]errorFixture{
+		"missing-resourceid":      {evt: withoutExtension(types.ExtensionResourceID)},
+		"missing-clustername":     {evt: withoutExtension(types.ExtensionClusterName)},
+		"missing-resourceversion": {evt: withoutExtension(types.ExtensionResourceVersion), tolerated: true},
+		"missing-sequenceid":      {evt: withoutExtension(types.ExtensionStatusUpdateSequenceID), tolerated: true},
+		"invalid-feedback":        {evt: mustEncodeStatus(feedbackWork), tolerated: true},
+		"malformed-status":        {evt: withData(`{"status":"malformed"}`), tolerated: true},
+		"non-object-data":         {evt: withData(`["malformed"]`)},
+		"invalid-type": {evt: func() *cloudevents.Event {
+			evt := mustEncodeStatus(newWork())
+			evt.SetType("invalid")
+			return evt
+		}()},
+		"bundle-type": {evt: func() *cloudevents.Event {
+			evt := mustEncodeStatus(newWork())
+			evt.SetType(bundleType.String())
+			return evt
+		}()},
+	}
+}
+
+func configMap() map[string]interface{} {
+	return map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "demo", "namespace": "default"},
+		"data":       map[string]interface{}{"key": "value"},
+	}
+}
+
+func newResource(object map[string]interface{}) *api.Resource {
+	return &api.Resource{
+		Source:          sourceID,
+		ClusterName:     clusterName,
+		ResourceID:      resourceID,
+		ResourceVersion: 3,
+		Spec:            &unstructured.Unstructured{Object: object},
+	}
+}
+
+func newWork() *workv1.ManifestWork {
+	raw, _ := json.Marshal(configMap())
+	return &workv1.ManifestWork{
+		ObjectMeta: metav1.ObjectMeta{
+			UID:             kubetypes.UID(resourceID),
+			Name:            resourceID,
+			Namespace:       clusterName,
+			ResourceVersion: "3",
+			Labels:          map[string]string{common.CloudEventsOriginalSourceLabelKey: sourceID},
+		},
+		Spec: workv1.ManifestWorkSpec{
+			Workload: workv1.ManifestsTemplate{
+				Manifests: []workv1.Manifest{{RawExtension: runtime.RawExtension{Raw: raw}}},
+			},
+		},
+	}
+}
+
+func mustEncodeStatus(work *workv1.ManifestWork) *cloudevents.Event {
+	evt, err := codec.NewManifestCodec(nil).Encode(clusterName+"-agent", statusEventType, work)
+	if err != nil {
+		panic(fmt.Sprintf("failed to encode the status fixture, %v", err))
+	}
+	return evt
+}
+
+func withoutExtension(name string) *cloudevents.Event {
+	evt := mustEncodeStatus(newWork())
+	evt.SetExtension(name, nil)
+	return evt
+}
+
+func withData(data string) *cloudevents.Event {
+	evt := mustEncodeStatus(newWork())
+	if err := evt.SetData(cloudevents.ApplicationJSON, json.RawMessage(data)); err != nil {
+		panic(fmt.Sprintf("failed to set the data of the fixture, %v", err))
+	}
+	return evt
+}
+
+func hasCondition(resource *api.Resource, conditionType string) bool {
+	for _, condition := range resource.Status.ReconcileStatus.Conditions {
+		if condition.Type == conditionType {
+			return true
+		}
+	}
+	return false
+}
+
+// compareJSON compares an object with its JSON form after both are normalized by JSON.
+func compareJSON(name string, expected interface{}, actualJSON []byte) error {
+	expectedJSON, err := json.Marshal(expected)
+	if err != nil {
+		return fmt.Errorf("failed to marshal expected %s, %v", name, err)
+	}
+
+	var expectedObj, actualObj interface{}
+	if err := json.Unmarshal(expectedJSON, &expectedObj); err != nil {
+		return fmt.Errorf("failed to unmarshal expected %s, %v", name, err)
+	}
+	if err := json.Unmarshal(actualJSON, &actualObj); err != nil {
+		return fmt.Errorf("failed to unmarshal %s, %v", name, err)
+	}
+	if !equality.Semantic.DeepEqual(expectedObj, actualObj) {
+		return fmt.Errorf("expected %s %s, but got %s", name, expectedJSON, actualJSON)
+	}
+	return nil
+}
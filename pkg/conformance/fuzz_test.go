@@ -0,0 +1,154 @@
+package conformance_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/morvencao/event-based-transport-demo/pkg/api"
+	"github.com/morvencao/event-based-transport-demo/pkg/source"
+
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/types"
+)
+
+// fuzzInput is the input of a status event to fuzz the source codec with. An empty resource ID, cluster name or
+// sequence ID, or a negative resource version, omits the extension from the event.
+type fuzzInput struct {
+	Data            []byte
+	ResourceID      string
+	ClusterName     string
+	ResourceVersion int64
+	SequenceID      string
+}
+
+// FuzzDecode fuzzes the source codec with the status events. The corpus is seeded with the status events that the
+// agent codec encodes for the conformance fixtures.
+func FuzzDecode(f *testing.F) {
+	for _, seed := range fuzzSeeds() {
+		f.Add(seed.Data, seed.ResourceID, seed.ClusterName, seed.ResourceVersion, seed.SequenceID)
+	}
+	f.Fuzz(func(t *testing.T, data []byte, resourceID, clusterName string, resourceVersion int64, sequenceID string) {
+		if err := checkDecode(fuzzInput{data, resourceID, clusterName, resourceVersion, sequenceID}); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// fuzzSeeds returns the status events of the conformance fixtures and a status event without data.
+func fuzzSeeds() []fuzzInput {
+	seeds := []fuzzInput{}
+	for _, fixture := range statusFixtures() {
+		evt := mustEncodeStatus(fixture.work)
+		seeds = append(seeds, fuzzInput{
+			Data:            evt.Data(),
+			ResourceID:      string(fixture.work.UID),
+			ClusterName:     fixture.work.Namespace,
+			ResourceVersion: 3,
+			SequenceID:      "1846253427366735872",
+		})
+	}
+	seeds = append(seeds, fuzzInput{Data: []byte(`{}`), ResourceID: resourceID, ClusterName: clusterName})
+	return seeds
+}
+
+// checkDecode decodes the status event of the input with the source codec in the strict and the tolerant modes, and
+// returns an error if the codec panics or breaks its invariants: a decoded resource is of the resource ID and the
+// cluster name of the event and has a reconcile status, the tolerant mode decodes whatever the strict mode decodes
+// to the same resource, and the strict mode never decodes with a decode warning.
+func checkDecode(input fuzzInput) error {
+	evt := cloudevents.NewEvent()
+	evt.SetID("fuzz")
+	evt.SetSource(clusterName + "-agent")
+	evt.SetType(statusEventType.String())
+	if input.ResourceID != "" {
+		evt.SetExtension(types.ExtensionResourceID, input.ResourceID)
+	}
+	if input.ClusterName != "" {
+		evt.SetExtension(types.ExtensionClusterName, input.ClusterName)
+	}
+	if input.ResourceVersion >= 0 {
+		evt.SetExtension(types.ExtensionResourceVersion, input.ResourceVersion)
+	}
+	if input.SequenceID != "" {
+		evt.SetExtension(types.ExtensionStatusUpdateSequenceID, input.SequenceID)
+	}
+	if json.Valid(input.Data) {
+		if err := evt.SetData(cloudevents.ApplicationJSON, json.RawMessage(input.Data)); err != nil {
+			return fmt.Errorf("failed to set the event data, %v", err)
+		}
+	} else {
+		evt.DataEncoded = input.Data
+		evt.SetDataContentType(cloudevents.ApplicationJSON)
+	}
+
+	strict, strictErr := safeDecode(&source.ResourceCodec{}, &evt)
+	if strictErr != nil && isPanic(strictErr) {
+		return strictErr
+	}
+	tolerant, tolerantErr := safeDecode(&source.ResourceCodec{Tolerant: true}, &evt)
+	if tolerantErr != nil && isPanic(tolerantErr) {
+		return tolerantErr
+	}
+
+	if strictErr == nil {
+		if err := checkDecoded(strict, input); err != nil {
+			return fmt.Errorf("strict mode: %v", err)
+		}
+		if hasCondition(strict, source.ConditionDecodeWarning) {
+			return fmt.Errorf("strict mode: decoded with the %s condition", source.ConditionDecodeWarning)
+		}
+		if tolerantErr != nil {
+			return fmt.Errorf("the tolerant mode fails to decode the event that the strict mode decodes, %v", tolerantErr)
+		}
+		if !reflect.DeepEqual(strict, tolerant) {
+			return fmt.Errorf("the tolerant mode decodes the event to %v, but the strict mode decodes it to %v", tolerant, strict)
+		}
+	}
+
+	if tolerantErr == nil {
+		if err := checkDecoded(tolerant, input); err != nil {
+			return fmt.Errorf("tolerant mode: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// decodePanic is the error of a codec that panics.
+type decodePanic struct {
+	recovered interface{}
+}
+
+func (p *decodePanic) Error() string {
+	return fmt.Sprintf("the codec panics, %v", p.recovered)
+}
+
+func isPanic(err error) bool {
+	_, ok := err.(*decodePanic)
+	return ok
+}
+
+func safeDecode(codec *source.ResourceCodec, evt *cloudevents.Event) (resource *api.Resource, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			resource, err = nil, &decodePanic{recovered: r}
+		}
+	}()
+
+	return codec.Decode(evt)
+}
+
+func checkDecoded(resource *api.Resource, input fuzzInput) error {
+	if resource == nil || resource.Status == nil || resource.Status.ReconcileStatus == nil {
+		return fmt.Errorf("decoded without the reconcile status")
+	}
+	if resource.ResourceID != input.ResourceID {
+		return fmt.Errorf("decoded with resource id %q, but the event is of %q", resource.ResourceID, input.ResourceID)
+	}
+	if resource.ClusterName != input.ClusterName {
+		return fmt.Errorf("decoded with cluster name %q, but the event is of %q", resource.ClusterName, input.ClusterName)
+	}
+	return nil
+}
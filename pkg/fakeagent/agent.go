@@ -0,0 +1,371 @@
+package fakeagent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/morvencao/event-based-transport-demo/pkg/transport"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	kubetypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"open-cluster-management.io/api/utils/work/v1/utils"
+	workv1 "open-cluster-management.io/api/work/v1"
+
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/options"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/types"
+	cloudeventswork "open-cluster-management.io/sdk-go/pkg/cloudevents/work"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/work/agent/codec"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/work/common"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/work/payload"
+)
+
+var statusUpdate = types.CloudEventsType{
+	CloudEventsDataType: payload.ManifestEventDataType,
+	SubResource:         types.SubResourceStatus,
+	Action:              "update_request",
+}
+
+// StatusFunc returns the live status of an applied manifest, the status feedback is evaluated against it.
+type StatusFunc func(manifest *unstructured.Unstructured) map[string]interface{}
+
+// FakeAgent is an agent that receives the spec events with the sdk-go agent client and codec, and simulates the
+// work agent: a created or updated manifest is applied right away, a deleted manifest is removed right away, and
+// the status is sent back with the applied and available conditions and the status feedback.
+type FakeAgent struct {
+	sync.RWMutex
+
+	clusterName string
+	client      *generic.CloudEventAgentClient[*workv1.ManifestWork]
+	works       map[kubetypes.UID]*workv1.ManifestWork
+	status      StatusFunc
+	compression *transport.CompressionOptions
+	keyring     *transport.Keyring
+	signing     *transport.Keyring
+}
+
+type Option func(*FakeAgent)
+
+// WithStatus sets the function that simulates the live status of the applied manifests, by default the status of
+// a manifest is its own `status` field.
+func WithStatus(status StatusFunc) Option {
+	return func(a *FakeAgent) {
+		a.status = status
+	}
+}
+
+// WithCompression decompresses the spec events and compresses the status events like the source does.
+func WithCompression(options *transport.CompressionOptions) Option {
+	return func(a *FakeAgent) {
+		a.compression = options
+	}
+}
+
+// WithKeyring decrypts the spec events with the private key of the cluster in the keyring.
+func WithKeyring(keyring *transport.Keyring) Option {
+	return func(a *FakeAgent) {
+		a.keyring = keyring
+	}
+}
+
+// WithSignatureKeyring signs the status events with the signing key of the cluster and verifies the spec events
+// with the keys of the source in the keyring.
+func WithSignatureKeyring(keyring *transport.Keyring) Option {
+	return func(a *FakeAgent) {
+		a.signing = keyring
+	}
+}
+
+func StartFakeAgent(ctx context.Context, agentOptions *options.CloudEventsAgentOptions, opts ...Option) (*FakeAgent, error) {
+	agent := &FakeAgent{
+		clusterName: agentOptions.ClusterName,
+		works:       make(map[kubetypes.UID]*workv1.ManifestWork),
+		status: func(manifest *unstructured.Unstructured) map[string]interface{} {
+			status, _, _ := unstructured.NestedMap(manifest.Object, "status")
+			return status
+		},
+	}
+	for _, opt := range opts {
+		opt(agent)
+	}
+
+	codecs := []generic.Codec[*workv1.ManifestWork]{codec.NewManifestCodec(nil), codec.NewManifestBundleCodec()}
+	for i := range codecs {
+		// the signature is verified first, then the data is decrypted and decompressed
+		if agent.compression != nil {
+			codecs[i] = transport.NewCompressionCodec(codecs[i], agent.compression)
+		}
+		if agent.keyring != nil {
+			codecs[i] = transport.NewEncryptionCodec(codecs[i], agent.keyring)
+		}
+		if agent.signing != nil {
+			codecs[i] = transport.NewSignatureCodec(codecs[i], agent.signing, nil)
+		}
+	}
+
+	client, err := generic.NewCloudEventAgentClient[*workv1.ManifestWork](
+		ctx,
+		agentOptions,
+		agent,
+		cloudeventswork.ManifestWorkStatusHash,
+		codecs...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	agent.client = client
+
+	client.Subscribe(ctx, func(action types.ResourceAction, work *workv1.ManifestWork) error {
+		if !work.DeletionTimestamp.IsZero() {
+			return agent.delete(ctx, work)
+		}
+
+		switch action {
+		case types.Added, types.Modified:
+			return agent.apply(ctx, work)
+		}
+		return nil
+	})
+
+	return agent, nil
+}
+
+// List implements the generic.Lister, it lists the applied works of the given source.
+func (a *FakeAgent) List(listOpts types.ListOptions) ([]*workv1.ManifestWork, error) {
+	a.RLock()
+	defer a.RUnlock()
+
+	works := []*workv1.ManifestWork{}
+	for _, work := range a.works {
+		if listOpts.Source != types.SourceAll && listOpts.Source != "" &&
+			work.Labels[common.CloudEventsOriginalSourceLabelKey] != listOpts.Source {
+			continue
+		}
+		works = append(works, work.DeepCopy())
+	}
+	return works, nil
+}
+
+// Get returns the applied work of the given resource ID.
+func (a *FakeAgent) Get(resourceID string) (*workv1.ManifestWork, bool) {
+	a.RLock()
+	defer a.RUnlock()
+
+	work, ok := a.works[kubetypes.UID(resourceID)]
+	if !ok {
+		return nil, false
+	}
+	return work.DeepCopy(), true
+}
+
+// Resync sends a spec resync request to the given source.
+func (a *FakeAgent) Resync(ctx context.Context, source string) error {
+	return a.client.Resync(ctx, source)
+}
+
+// Refresh evaluates the status feedback of an applied work again and sends the status if it's changed, it's used
+// to simulate a status change of the live resource.
+func (a *FakeAgent) Refresh(ctx context.Context, resourceID string) error {
+	work, ok := a.Get(resourceID)
+	if !ok {
+		return fmt.Errorf("the resource %s is not found", resourceID)
+	}
+	return a.apply(ctx, work)
+}
+
+func (a *FakeAgent) apply(ctx context.Context, work *workv1.ManifestWork) error {
+	if len(work.Spec.Workload.Manifests) == 0 {
+		return fmt.Errorf("the work %s should have at least one manifest", work.UID)
+	}
+
+	last, exists := a.Get(string(work.UID))
+	if exists {
+		// keep the transition time of the conditions that are not changed
+		work.Status.Conditions = last.Status.Conditions
+	}
+
+	conditions := []metav1.Condition{
+		{Type: workv1.WorkApplied, Status: metav1.ConditionTrue, Reason: "AppliedManifestComplete"},
+		{Type: workv1.WorkAvailable, Status: metav1.ConditionTrue, Reason: "ResourceAvailable"},
+	}
+	manifestConditions := []workv1.ManifestCondition{}
+	for i, raw := range work.Spec.Workload.Manifests {
+		manifest := &unstructured.Unstructured{}
+		if err := manifest.UnmarshalJSON(raw.Raw); err != nil {
+			return fmt.Errorf("failed to unmarshal the manifest %d of the work %s, %v", i, work.UID, err)
+		}
+
+		resourceMeta, _, err := utils.BuildResourceMeta(i, manifest, nil)
+		if err != nil {
+			return fmt.Errorf("failed to build the resource meta of the manifest %d of the work %s, %v", i, work.UID, err)
+		}
+		// simulate the rest mapper of the agent
+		gvr, _ := meta.UnsafeGuessKindToResource(manifest.GroupVersionKind())
+		resourceMeta.Resource = gvr.Resource
+
+		feedbacks, err := a.feedbacks(work, resourceMeta, manifest)
+		if err != nil {
+			return err
+		}
+
+		manifestCondition := workv1.ManifestCondition{
+			ResourceMeta:    resourceMeta,
+			StatusFeedbacks: workv1.StatusFeedbackResult{Values: feedbacks},
+		}
+		if exists && i < len(last.Status.ResourceStatus.Manifests) {
+			manifestCondition.Conditions = last.Status.ResourceStatus.Manifests[i].Conditions
+		}
+		for _, condition := range conditions {
+			meta.SetStatusCondition(&manifestCondition.Conditions, condition)
+		}
+		if len(feedbacks) != 0 {
+			meta.SetStatusCondition(&manifestCondition.Conditions, metav1.Condition{
+				Type:   "StatusFeedbackSynced",
+				Status: metav1.ConditionTrue,
+				Reason: "StatusFeedbackSynced",
+			})
+		}
+		manifestConditions = append(manifestConditions, manifestCondition)
+	}
+	for _, condition := range conditions {
+		meta.SetStatusCondition(&work.Status.Conditions, condition)
+	}
+	work.Status.ResourceStatus.Manifests = manifestConditions
+
+	a.Lock()
+	a.works[work.UID] = work.DeepCopy()
+	a.Unlock()
+
+	if exists {
+		lastHash, _ := cloudeventswork.ManifestWorkStatusHash(last)
+		hash, _ := cloudeventswork.ManifestWorkStatusHash(work)
+		if lastHash == hash && last.ResourceVersion == work.ResourceVersion {
+			// the status is not changed
+			return nil
+		}
+	}
+
+	return a.publishStatus(ctx, work)
+}
+
+func (a *FakeAgent) delete(ctx context.Context, work *workv1.ManifestWork) error {
+	a.Lock()
+	delete(a.works, work.UID)
+	a.Unlock()
+
+	meta.SetStatusCondition(&work.Status.Conditions, metav1.Condition{
+		Type:   common.ManifestsDeleted,
+		Status: metav1.ConditionTrue,
+		Reason: "ManifestsDeleted",
+	})
+	return a.publishStatus(ctx, work)
+}
+
+// publishStatus sends the status of the work with the data type of its spec, so the manifest bundles are replied
+// with the bundle status.
+func (a *FakeAgent) publishStatus(ctx context.Context, work *workv1.ManifestWork) error {
+	eventType := statusUpdate
+	if dataType, ok := work.Annotations[common.CloudEventsDataTypeAnnotationKey]; ok {
+		parsed, err := types.ParseCloudEventsDataType(dataType)
+		if err != nil {
+			return fmt.Errorf("failed to parse the data type of the work %s, %v", work.UID, err)
+		}
+		eventType.CloudEventsDataType = *parsed
+	}
+	return a.client.Publish(ctx, eventType, work)
+}
+
+// feedbacks evaluates the JSON paths of the feedback rules against the live status of the manifest. A scalar value
+// is returned as its own type, other values are returned as raw JSON strings like the agent does with the
+// RawFeedbackJsonString feature.
+func (a *FakeAgent) feedbacks(
+	work *workv1.ManifestWork,
+	resourceMeta workv1.ManifestResourceMeta,
+	manifest *unstructured.Unstructured,
+) ([]workv1.FeedbackValue, error) {
+	config := manifestConfig(work, resourceMeta)
+	if config == nil {
+		return nil, nil
+	}
+
+	live := manifest.DeepCopy()
+	if status := a.status(manifest); status != nil {
+		live.Object["status"] = status
+	}
+
+	values := []workv1.FeedbackValue{}
+	for _, rule := range config.FeedbackRules {
+		paths := rule.JsonPaths
+		if rule.Type == workv1.WellKnownStatusType {
+			paths = wellKnownStatus[live.GroupVersionKind().GroupKind()]
+		}
+
+		for _, path := range paths {
+			fields := strings.Split(strings.Trim(path.Path, "."), ".")
+			value, found, err := unstructured.NestedFieldNoCopy(live.Object, fields...)
+			if err != nil || !found {
+				continue
+			}
+
+			fieldValue, err := fieldValue(value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get the feedback %s of the work %s, %v", path.Name, work.UID, err)
+			}
+			values = append(values, workv1.FeedbackValue{Name: path.Name, Value: fieldValue})
+		}
+	}
+	return values, nil
+}
+
+// manifestConfig returns the config of the manifest that matches its resource identifier. The manifest codec
+// decodes the config without a rest mapper, so an identifier without resource is matched by name and namespace.
+func manifestConfig(work *workv1.ManifestWork, resourceMeta workv1.ManifestResourceMeta) *workv1.ManifestConfigOption {
+	for i, config := range work.Spec.ManifestConfigs {
+		id := config.ResourceIdentifier
+		if id.Name != resourceMeta.Name || id.Namespace != resourceMeta.Namespace {
+			continue
+		}
+		if id.Resource == "" || (id.Group == resourceMeta.Group && id.Resource == resourceMeta.Resource) {
+			return &work.Spec.ManifestConfigs[i]
+		}
+	}
+	return nil
+}
+
+// wellKnownStatus are the status fields that the work agent feeds back for the WellKnownStatus rules, only the
+// replicas of the common workloads are simulated.
+var wellKnownStatus = map[schema.GroupKind][]workv1.JsonPath{
+	{Group: "apps", Kind: "Deployment"}: {
+		{Name: "ReadyReplicas", Path: ".status.readyReplicas"},
+		{Name: "Replicas", Path: ".status.replicas"},
+		{Name: "AvailableReplicas", Path: ".status.availableReplicas"},
+	},
+	{Group: "apps", Kind: "StatefulSet"}: {
+		{Name: "ReadyReplicas", Path: ".status.readyReplicas"},
+		{Name: "Replicas", Path: ".status.replicas"},
+		{Name: "AvailableReplicas", Path: ".status.availableReplicas"},
+	},
+}
+
+func fieldValue(value interface{}) (workv1.FieldValue, error) {
+	switch v := value.(type) {
+	case int64:
+		return workv1.FieldValue{Type: workv1.Integer, Integer: ptr.To(v)}, nil
+	case string:
+		return workv1.FieldValue{Type: workv1.String, String: ptr.To(v)}, nil
+	case bool:
+		return workv1.FieldValue{Type: workv1.Boolean, Boolean: ptr.To(v)}, nil
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return workv1.FieldValue{}, err
+	}
+	return workv1.FieldValue{Type: workv1.JsonRaw, JsonRaw: ptr.To(string(raw))}, nil
+}
@@ -0,0 +1,147 @@
+package source
+
+import (
+	"fmt"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/morvencao/event-based-transport-demo/pkg/api"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	workv1 "open-cluster-management.io/api/work/v1"
+
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/types"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/work/common"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/work/payload"
+)
+
+// ResourceBundleCodec encodes the manifest bundle resources with the ManifestBundle data type, the manifests of a
+// bundle are applied by the agent as one manifest work. Its status events are decoded in the tolerant mode like the
+// ResourceCodec.
+type ResourceBundleCodec struct {
+	Tolerant bool
+}
+
+var _ generic.Codec[*api.Resource] = &ResourceBundleCodec{}
+
+func (c *ResourceBundleCodec) EventDataType() types.CloudEventsDataType {
+	return payload.ManifestBundleEventDataType
+}
+
+func (c *ResourceBundleCodec) Encode(source string, eventType types.CloudEventsType, resource *api.Resource) (*cloudevents.Event, error) {
+	if resource.Source != "" {
+		source = resource.Source
+	}
+
+	if eventType.CloudEventsDataType != payload.ManifestBundleEventDataType {
+		return nil, fmt.Errorf("unsupported cloudevents data type %s", eventType.CloudEventsDataType)
+	}
+
+	if !resource.IsBundle() {
+		eventType.CloudEventsDataType = payload.ManifestEventDataType
+		return (&ResourceCodec{}).Encode(source, eventType, resource)
+	}
+
+	eventBuilder := types.NewEventBuilder(source, eventType).
+		WithResourceID(resource.ResourceID).
+		WithResourceVersion(resource.ResourceVersion).
+		WithClusterName(resource.ClusterName)
+
+	if !resource.GetDeletionTimestamp().IsZero() {
+		evt := eventBuilder.WithDeletionTimestamp(resource.GetDeletionTimestamp().Time).NewEvent()
+		return &evt, nil
+	}
+
+	evt := eventBuilder.NewEvent()
+
+	eventPayload := &payload.ManifestBundle{
+		DeleteOption: deleteOption(resource),
+	}
+	for i, manifest := range resource.Manifests {
+		raw, err := manifest.MarshalJSON()
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal manifest %d of resource %s, %v", i, resource.ResourceID, err)
+		}
+		eventPayload.Manifests = append(eventPayload.Manifests, workv1.Manifest{
+			RawExtension: runtime.RawExtension{Raw: raw},
+		})
+
+		// the agent matches the config of a manifest by its resource identifier, the source has no rest mapper, so
+		// the resource is guessed from the kind
+		gvr, _ := meta.UnsafeGuessKindToResource(manifest.GroupVersionKind())
+		eventPayload.ManifestConfigs = append(eventPayload.ManifestConfigs, workv1.ManifestConfigOption{
+			ResourceIdentifier: workv1.ResourceIdentifier{
+				Group:     gvr.Group,
+				Resource:  gvr.Resource,
+				Name:      manifest.GetName(),
+				Namespace: manifest.GetNamespace(),
+			},
+			FeedbackRules:  feedbackRules(resource),
+			UpdateStrategy: updateStrategy(resource),
+		})
+	}
+
+	if err := evt.SetData(cloudevents.ApplicationJSON, eventPayload); err != nil {
+		return nil, fmt.Errorf("failed to encode manifest bundle to cloud event: %v", err)
+	}
+
+	return &evt, nil
+}
+
+func (c *ResourceBundleCodec) Decode(evt *cloudevents.Event) (*api.Resource, error) {
+	eventType, err := types.ParseCloudEventsType(evt.Type())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse cloud event type %s, %v", evt.Type(), err)
+	}
+
+	if eventType.CloudEventsDataType != payload.ManifestBundleEventDataType {
+		return nil, fmt.Errorf("unsupported cloudevents data type %s", eventType.CloudEventsDataType)
+	}
+
+	warnings := &decodeWarnings{tolerant: c.Tolerant}
+	resource, err := decodeStatusResource(evt, warnings)
+	if err != nil {
+		return nil, err
+	}
+	resource.Type = api.ResourceTypeManifestBundle
+
+	bundleStatus := &payload.ManifestBundleStatus{}
+	if err := evt.DataAs(bundleStatus); err != nil {
+		conditions, err := salvageConditions(evt, err, warnings)
+		if err != nil {
+			return nil, err
+		}
+		bundleStatus = &payload.ManifestBundleStatus{Conditions: conditions}
+	} else {
+		if resource.Status.StatusHash, err = workStatusHash(bundleStatus.Conditions, bundleStatus.ResourceStatus); err != nil {
+			return nil, err
+		}
+	}
+
+	// set deleted condition if the bundle is deleted from agent
+	if meta.IsStatusConditionTrue(bundleStatus.Conditions, common.ManifestsDeleted) {
+		resource.Status.ReconcileStatus.Conditions = append(resource.Status.ReconcileStatus.Conditions, metav1.Condition{
+			Type:   common.ManifestsDeleted,
+			Status: metav1.ConditionTrue})
+		return resource, nil
+	}
+
+	resource.Status.ReconcileStatus.Conditions = append(resource.Status.ReconcileStatus.Conditions, bundleStatus.Conditions...)
+	for _, manifestCondition := range bundleStatus.ResourceStatus {
+		contentStatus, feedbacks, err := decodeFeedbacks(manifestCondition.StatusFeedbacks.Values, warnings)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode the status of manifest %d, %v", manifestCondition.ResourceMeta.Ordinal, err)
+		}
+
+		resource.Status.ManifestStatuses = append(resource.Status.ManifestStatuses, api.ManifestStatus{
+			ResourceMeta:  manifestCondition.ResourceMeta,
+			Conditions:    manifestCondition.Conditions,
+			ContentStatus: contentStatus,
+			Feedbacks:     feedbacks,
+		})
+	}
+
+	warnings.setCondition(resource.Status)
+	return resource, nil
+}
@@ -2,10 +2,17 @@ package source
 
 import (
 	"context"
+	"fmt"
+	"log"
+	"sync"
 
+	cloudevents "github.com/cloudevents/sdk-go/v2"
 	"github.com/morvencao/event-based-transport-demo/pkg/api"
 	"github.com/morvencao/event-based-transport-demo/pkg/store"
+	"github.com/morvencao/event-based-transport-demo/pkg/transport"
 	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
 
 	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic"
 	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/options"
@@ -32,62 +39,283 @@ var (
 	}
 )
 
+// DefaultTransport is the transport name of a source client with a single transport.
+const DefaultTransport = "default"
+
+// CodecMiddleware wraps the codec of the resources, e.g. to compress the event data.
+type CodecMiddleware func(codec generic.Codec[*api.Resource]) generic.Codec[*api.Resource]
+
+// SignatureMiddleware signs the spec events and verifies the status events with the keys of the clusters in the
+// keyring, the rejected status events are reported to the onRejected function.
+func SignatureMiddleware(keyring *transport.Keyring, onRejected transport.SignatureRejectedFunc) CodecMiddleware {
+	return func(codec generic.Codec[*api.Resource]) generic.Codec[*api.Resource] {
+		return transport.NewSignatureCodec(codec, keyring, onRejected)
+	}
+}
+
+// EncryptionMiddleware encrypts the data of the spec events with the keys of the clusters in the keyring.
+func EncryptionMiddleware(keyring *transport.Keyring) CodecMiddleware {
+	return func(codec generic.Codec[*api.Resource]) generic.Codec[*api.Resource] {
+		return transport.NewEncryptionCodec(codec, keyring)
+	}
+}
+
+// CompressionMiddleware compresses the data of the spec events and decompresses the data of the status events.
+func CompressionMiddleware(options *transport.CompressionOptions) CodecMiddleware {
+	return func(codec generic.Codec[*api.Resource]) generic.Codec[*api.Resource] {
+		return transport.NewCompressionCodec(codec, options)
+	}
+}
+
+// ResourceSourceClient publishes the resources to the agents, it runs one CloudEvents client per transport and
+// routes the events of a cluster to the transport of the cluster.
 type ResourceSourceClient struct {
-	client generic.CloudEventsClient[*api.Resource]
-	store  store.Store
+	connections map[string]*transportConnection
+	router      *ClusterRouter
+	store       store.Store
+	codecs      []generic.Codec[*api.Resource]
+	statusHash  generic.StatusHashGetter[*api.Resource]
+	statusLock  sync.Mutex
 }
 
 func StartResourceSourceClient(
 	ctx context.Context,
-	options *options.CloudEventsSourceOptions,
+	sourceOptions *options.CloudEventsSourceOptions,
 	store store.Store,
 ) (*ResourceSourceClient, error) {
-	client, err := generic.NewCloudEventSourceClient[*api.Resource](
+	return StartRoutedResourceSourceClient(
 		ctx,
-		options,
-		&ResourceLister{store: store},
-		StatusHashGetter,
-		&ResourceCodec{},
+		map[string]*options.CloudEventsSourceOptions{DefaultTransport: sourceOptions},
+		&ClusterRouter{Default: DefaultTransport},
+		NewConnectionOptions(),
+		store,
 	)
-	if err != nil {
+}
+
+// StartRoutedResourceSourceClient starts a client for each of the named transports, the status events that are
+// received from all the transports are merged into the store. A transport that is not available is connected in
+// the background, and the events of its clusters are buffered until it's connected. The codecs are wrapped by the
+// middlewares in order, the first middleware is the outermost.
+func StartRoutedResourceSourceClient(
+	ctx context.Context,
+	transports map[string]*options.CloudEventsSourceOptions,
+	router *ClusterRouter,
+	connectionOptions *ConnectionOptions,
+	store store.Store,
+	middlewares ...CodecMiddleware,
+) (*ResourceSourceClient, error) {
+	names := []string{}
+	for name := range transports {
+		names = append(names, name)
+	}
+	if err := router.Validate(names); err != nil {
 		return nil, err
 	}
 
-	client.Subscribe(ctx, func(action types.ResourceAction, resource *api.Resource) error {
-		if meta.IsStatusConditionTrue(resource.Status.ReconcileStatus.Conditions, common.ManifestsDeleted) {
-			// Delete the resource if agent reports it's deleted
-			store.Delete(resource.ResourceID)
-			return nil
+	c := &ResourceSourceClient{
+		connections: map[string]*transportConnection{},
+		router:      router,
+		store:       store,
+		codecs:      []generic.Codec[*api.Resource]{&ResourceCodec{}, &ResourceBundleCodec{}},
+		statusHash:  connectionOptions.StatusHashGetter,
+	}
+	if c.statusHash == nil {
+		c.statusHash = StatusHashGetter
+	}
+	for i := range c.codecs {
+		for j := len(middlewares) - 1; j >= 0; j-- {
+			c.codecs[i] = middlewares[j](c.codecs[i])
 		}
-		return store.UpdateStatus(resource)
-	})
+	}
+	for name, sourceOptions := range transports {
+		name := name
+		connection := &transportConnection{
+			name:          name,
+			options:       connectionOptions,
+			sourceOptions: sourceOptions,
+			newClient:     c.newClient,
+			resourceByID:  store.Get,
+			encode:        c.encodeSpec,
+			onReconnected: func(ctx context.Context) {
+				c.resyncTransport(ctx, name)
+			},
+		}
+		connection.start(ctx)
+		c.connections[name] = connection
+	}
 
-	return &ResourceSourceClient{client: client, store: store}, nil
+	return c, nil
 }
 
 func (c *ResourceSourceClient) OnCreate(ctx context.Context, id string) error {
-	resource, err := c.store.Get(id)
+	return c.publish(ctx, createRequest, id)
+}
+
+func (c *ResourceSourceClient) OnUpdate(ctx context.Context, id string) error {
+	return c.publish(ctx, updateRequest, id)
+}
+
+func (c *ResourceSourceClient) OnDelete(ctx context.Context, id string) error {
+	return c.publish(ctx, deleteRequest, id)
+}
+
+// Resync sends a status resync request to the agents of the given cluster.
+func (c *ResourceSourceClient) Resync(ctx context.Context, clusterName string) error {
+	connection, err := c.connection(clusterName)
 	if err != nil {
 		return err
 	}
 
-	return c.client.Publish(ctx, createRequest, resource)
+	return connection.resync(ctx, clusterName)
 }
 
-func (c *ResourceSourceClient) OnUpdate(ctx context.Context, id string) error {
+// ConnectionStates returns the connection states of the transports.
+func (c *ResourceSourceClient) ConnectionStates() map[string]ConnectionState {
+	states := map[string]ConnectionState{}
+	for name, connection := range c.connections {
+		states[name] = connection.connectionState()
+	}
+	return states
+}
+
+func (c *ResourceSourceClient) publish(ctx context.Context, eventType types.CloudEventsType, id string) error {
 	resource, err := c.store.Get(id)
 	if err != nil {
 		return err
 	}
 
-	return c.client.Publish(ctx, updateRequest, resource)
+	connection, err := c.connection(resource.ClusterName)
+	if err != nil {
+		return err
+	}
+
+	if resource.IsBundle() {
+		eventType.CloudEventsDataType = payload.ManifestBundleEventDataType
+	}
+
+	return connection.publish(ctx, eventType, resource)
 }
 
-func (c *ResourceSourceClient) OnDelete(ctx context.Context, id string) error {
-	resource, err := c.store.Get(id)
+// encodeSpec encodes the spec event of the resource with the codecs of the client as it's published.
+func (c *ResourceSourceClient) encodeSpec(sourceID string, resource *api.Resource) (*cloudevents.Event, error) {
+	eventType, codec := updateRequest, c.codecs[0]
+	if resource.IsBundle() {
+		eventType.CloudEventsDataType = payload.ManifestBundleEventDataType
+		codec = c.codecs[1]
+	}
+
+	return codec.Encode(sourceID, eventType, resource)
+}
+
+// newClient connects a CloudEvents client to the transport and subscribes the status events.
+func (c *ResourceSourceClient) newClient(
+	ctx context.Context,
+	sourceOptions *options.CloudEventsSourceOptions,
+) (*generic.CloudEventSourceClient[*api.Resource], error) {
+	client, err := generic.NewCloudEventSourceClient[*api.Resource](
+		ctx,
+		sourceOptions,
+		&ResourceLister{store: c.store},
+		c.statusHash,
+		c.codecs...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	client.Subscribe(ctx, func(action types.ResourceAction, resource *api.Resource) error {
+		return c.handleStatus(resource)
+	})
+
+	return client, nil
+}
+
+// handleStatus updates the status of the resource in the store, or deletes the resource if the agent reports it's
+// deleted. The status events are handled concurrently, the status is compared with the stored status and updated
+// under the lock.
+func (c *ResourceSourceClient) handleStatus(resource *api.Resource) error {
+	c.statusLock.Lock()
+	defer c.statusLock.Unlock()
+
+	deleted := meta.IsStatusConditionTrue(resource.Status.ReconcileStatus.Conditions, common.ManifestsDeleted)
+	last, err := c.store.Get(resource.ResourceID)
 	if err != nil {
+		if deleted {
+			// the resource is already deleted
+			return nil
+		}
 		return err
 	}
 
-	return c.client.Publish(ctx, deleteRequest, resource)
+	// an agent can only report the status of the resources of its own cluster
+	if last.ClusterName != resource.ClusterName {
+		return fmt.Errorf("the status of resource %s is reported by cluster %s, but it belongs to cluster %s",
+			resource.ResourceID, resource.ClusterName, last.ClusterName)
+	}
+
+	// a status resync request is responded with all the resources of the cluster for each data type, only
+	// the status of the resource's own data type is kept
+	if last.IsBundle() != resource.IsBundle() {
+		return nil
+	}
+
+	// the out-of-order and superseded status is discarded, including a stale deleted status
+	if err := checkStatusOrder(last, resource); err != nil {
+		log.Printf("Discarded the status of resource %s: %v", resource.ResourceID, err)
+		return nil
+	}
+
+	if deleted {
+		// the deletion is only honoured if the source requested it, so a replayed or forged deleted status
+		// can't remove a resource
+		if last.DeletionTimestamp.IsZero() {
+			log.Printf("Discarded the deleted status of resource %s, its deletion is not requested",
+				resource.ResourceID)
+			return nil
+		}
+
+		// Delete the resource if agent reports it's deleted
+		c.store.Delete(resource.ResourceID)
+		return nil
+	}
+	if resource.Status.ObservedResourceVersion == 0 && last.Status != nil {
+		// the resource version is unknown, the status is still of the last observed resource version
+		resource.Status.ObservedResourceVersion = last.Status.ObservedResourceVersion
+	}
+	return c.store.UpdateStatus(resource)
+}
+
+// resyncTransport sends a status resync request to each cluster of the transport that has resources, so the
+// status changes that are missed while the transport is disconnected are sent again. The clusters are resynced
+// one by one since not all the transports have a broadcast topic.
+func (c *ResourceSourceClient) resyncTransport(ctx context.Context, transport string) {
+	clusters := sets.New[string]()
+	for _, resource := range c.store.ListAll() {
+		clusters.Insert(resource.ClusterName)
+	}
+
+	for _, clusterName := range sets.List(clusters) {
+		if routed, err := c.router.Route(clusterName); err != nil || routed != transport {
+			continue
+		}
+
+		if err := c.connections[transport].resync(ctx, clusterName); err != nil {
+			runtime.HandleError(fmt.Errorf("failed to resync cluster %s, %v", clusterName, err))
+		}
+	}
+}
+
+// connection returns the connection of the transport that the cluster is routed to.
+func (c *ResourceSourceClient) connection(clusterName string) (*transportConnection, error) {
+	transport, err := c.router.Route(clusterName)
+	if err != nil {
+		return nil, err
+	}
+
+	connection, ok := c.connections[transport]
+	if !ok {
+		return nil, fmt.Errorf("the transport %s of cluster %s is not found", transport, clusterName)
+	}
+
+	return connection, nil
 }
@@ -0,0 +1,170 @@
+package source
+
+import (
+	"context"
+	"testing"
+
+	"github.com/morvencao/event-based-transport-demo/pkg/api"
+	"github.com/morvencao/event-based-transport-demo/pkg/fakeagent"
+	"github.com/morvencao/event-based-transport-demo/pkg/store"
+	"github.com/morvencao/event-based-transport-demo/pkg/transport"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	workv1 "open-cluster-management.io/api/work/v1"
+
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/work/common"
+)
+
+func TestResourceSourceClientWithFakeAgent(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	broker := transport.NewLoopbackBroker()
+	resourceStore := store.NewMemoryStore()
+	client, err := StartResourceSourceClient(ctx, transport.NewLoopbackSourceOptions(broker, "source"), resourceStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent, err := fakeagent.StartFakeAgent(ctx, transport.NewLoopbackAgentOptions(broker, "cluster1", "cluster1-agent"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := waitFor(func() bool {
+		return client.ConnectionStates()[DefaultTransport] == ConnectionStateConnected
+	}); err != nil {
+		t.Fatalf("expected the transport is connected")
+	}
+
+	// create
+	resource := newTestResource("source", "cluster1", "nginx")
+	resourceStore.Add(resource)
+	if err := client.OnCreate(ctx, resource.ResourceID); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitFor(func() bool {
+		return replicas(agent, resource.ResourceID) == 1 && observedVersion(resourceStore, resource.ResourceID) == 1
+	}); err != nil {
+		t.Fatalf("expected the resource is applied and its status is received")
+	}
+
+	// update
+	updated := newTestResource("source", "cluster1", "nginx")
+	updated.ResourceVersion = 2
+	updated.Spec.Object["spec"] = map[string]interface{}{"replicas": int64(2)}
+	if err := resourceStore.Update(updated); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.OnUpdate(ctx, resource.ResourceID); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitFor(func() bool {
+		return replicas(agent, resource.ResourceID) == 2 && observedVersion(resourceStore, resource.ResourceID) == 2
+	}); err != nil {
+		t.Fatalf("expected the resource is updated and its status is received")
+	}
+
+	// status resync, the agent sends the status that the source doesn't have
+	lost := newTestResource("source", "cluster1", "nginx")
+	lost.ResourceVersion = 2
+	lost.Spec.Object["spec"] = map[string]interface{}{"replicas": int64(2)}
+	resourceStore.UpSert(lost)
+	if err := client.Resync(ctx, "cluster1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitFor(func() bool {
+		return observedVersion(resourceStore, resource.ResourceID) == 2
+	}); err != nil {
+		t.Fatalf("expected the status is received by the status resync")
+	}
+
+	// spec resync, a new agent of the cluster gets the resources from the source
+	restarted, err := fakeagent.StartFakeAgent(ctx, transport.NewLoopbackAgentOptions(broker, "cluster1", "cluster1-agent"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := restarted.Resync(ctx, "source"); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitFor(func() bool {
+		return replicas(restarted, resource.ResourceID) == 2
+	}); err != nil {
+		t.Fatalf("expected the resource is received by the spec resync")
+	}
+
+	// delete
+	resourceStore.MarkAsDeleting(resource.ResourceID)
+	if err := client.OnDelete(ctx, resource.ResourceID); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitFor(func() bool {
+		_, applied := agent.Get(resource.ResourceID)
+		_, err := resourceStore.Get(resource.ResourceID)
+		return !applied && err != nil
+	}); err != nil {
+		t.Fatalf("expected the resource is deleted from the agent and the store")
+	}
+}
+
+// replicas returns the replicas of the applied deployment, it's 0 if the resource is not applied.
+func replicas(agent *fakeagent.FakeAgent, resourceID string) int64 {
+	work, ok := agent.Get(resourceID)
+	if !ok || len(work.Spec.Workload.Manifests) == 0 {
+		return 0
+	}
+
+	manifest := &unstructured.Unstructured{}
+	if err := manifest.UnmarshalJSON(work.Spec.Workload.Manifests[0].Raw); err != nil {
+		return 0
+	}
+	replicas, _, _ := unstructured.NestedInt64(manifest.Object, "spec", "replicas")
+	return replicas
+}
+
+// observedVersion returns the resource version of the applied status of the resource, it's 0 if the resource
+// isn't applied.
+func observedVersion(resourceStore store.Store, resourceID string) int64 {
+	resource, err := resourceStore.Get(resourceID)
+	if err != nil || !applied(resource) {
+		return 0
+	}
+	return resource.Status.ObservedResourceVersion
+}
+
+func applied(resource *api.Resource) bool {
+	return resource.Status != nil && resource.Status.ReconcileStatus != nil &&
+		meta.IsStatusConditionTrue(resource.Status.ReconcileStatus.Conditions, workv1.WorkApplied)
+}
+
+func TestHandleStatusDeletesRequestedDeletionOnly(t *testing.T) {
+	resourceStore := store.NewMemoryStore()
+	client := &ResourceSourceClient{store: resourceStore}
+	resource := newTestResource("source", "cluster1", "nginx")
+	resourceStore.Add(resource)
+
+	deleted := newTestResource("source", "cluster1", "nginx")
+	deleted.Status = &api.ResourceStatus{
+		ReconcileStatus: &api.ReconcileStatus{
+			Conditions: []metav1.Condition{
+				{Type: common.ManifestsDeleted, Status: metav1.ConditionTrue, Reason: "ManifestsDeleted"},
+			},
+		},
+	}
+
+	// the deleted status is discarded if the deletion is not requested
+	if err := client.handleStatus(deleted); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := resourceStore.Get(resource.ResourceID); err != nil {
+		t.Errorf("expected the resource is kept, but got %v", err)
+	}
+
+	resourceStore.MarkAsDeleting(resource.ResourceID)
+	if err := client.handleStatus(deleted); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := resourceStore.Get(resource.ResourceID); err == nil {
+		t.Errorf("expected the resource is deleted")
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 
 	cloudevents "github.com/cloudevents/sdk-go/v2"
-	cloudeventstypes "github.com/cloudevents/sdk-go/v2/types"
 	"github.com/morvencao/event-based-transport-demo/pkg/api"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -17,7 +16,16 @@ import (
 	"open-cluster-management.io/sdk-go/pkg/cloudevents/work/payload"
 )
 
-type ResourceCodec struct{}
+// contentStatusFeedback is the name of the status feedback that is decoded into the content status if it's an
+// object.
+const contentStatusFeedback = "status"
+
+// ResourceCodec encodes the resources with the Manifest data type. In the tolerant mode, the problems of a status
+// event that don't prevent it from being matched to its resource, e.g. a missing sequence ID or a malformed status
+// feedback, are reported by the decode warning condition instead of failing the event.
+type ResourceCodec struct {
+	Tolerant bool
+}
 
 var _ generic.Codec[*api.Resource] = &ResourceCodec{}
 
@@ -34,6 +42,13 @@ func (c *ResourceCodec) Encode(source string, eventType types.CloudEventsType, r
 		return nil, fmt.Errorf("unsupported cloudevents data type %s", eventType.CloudEventsDataType)
 	}
 
+	// a spec resync request is responded with all the resources of the cluster regardless of its data type, so
+	// the bundles are sent with their own data type
+	if resource.IsBundle() {
+		eventType.CloudEventsDataType = payload.ManifestBundleEventDataType
+		return (&ResourceBundleCodec{}).Encode(source, eventType, resource)
+	}
+
 	eventBuilder := types.NewEventBuilder(source, eventType).
 		WithResourceID(resource.ResourceID).
 		WithResourceVersion(resource.ResourceVersion).
@@ -47,25 +62,11 @@ func (c *ResourceCodec) Encode(source string, eventType types.CloudEventsType, r
 	evt := eventBuilder.NewEvent()
 
 	eventPayload := &payload.Manifest{
-		Manifest: *resource.Spec,
-		DeleteOption: &workv1.DeleteOption{
-			PropagationPolicy: workv1.DeletePropagationPolicyTypeForeground,
-		},
+		Manifest:     *resource.Spec,
+		DeleteOption: deleteOption(resource),
 		ConfigOption: &payload.ManifestConfigOption{
-			FeedbackRules: []workv1.FeedbackRule{
-				{
-					Type: workv1.JSONPathsType,
-					JsonPaths: []workv1.JsonPath{
-						{
-							Name: "status",
-							Path: ".status",
-						},
-					},
-				},
-			},
-			UpdateStrategy: &workv1.UpdateStrategy{
-				Type: workv1.UpdateStrategyTypeServerSideApply,
-			},
+			FeedbackRules:  feedbackRules(resource),
+			UpdateStrategy: updateStrategy(resource),
 		},
 	}
 
@@ -76,52 +77,81 @@ func (c *ResourceCodec) Encode(source string, eventType types.CloudEventsType, r
 	return &evt, nil
 }
 
-func (c *ResourceCodec) Decode(evt *cloudevents.Event) (*api.Resource, error) {
-	eventType, err := types.ParseCloudEventsType(evt.Type())
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse cloud event type %s, %v", evt.Type(), err)
+// deleteOption returns the delete option of the resource, the resource is deleted in the foreground by default.
+func deleteOption(resource *api.Resource) *workv1.DeleteOption {
+	if resource.DeleteOption != nil {
+		return resource.DeleteOption
 	}
 
-	if eventType.CloudEventsDataType != payload.ManifestEventDataType {
-		return nil, fmt.Errorf("unsupported cloudevents data type %s", eventType.CloudEventsDataType)
+	return &workv1.DeleteOption{
+		PropagationPolicy: workv1.DeletePropagationPolicyTypeForeground,
 	}
+}
 
-	evtExtensions := evt.Context.GetExtensions()
+// updateStrategy returns the update strategy of the resource, the resource is applied with server side apply by
+// default.
+func updateStrategy(resource *api.Resource) *workv1.UpdateStrategy {
+	if resource.UpdateStrategy != nil {
+		return resource.UpdateStrategy
+	}
 
-	resourceID, err := cloudeventstypes.ToString(evtExtensions[types.ExtensionResourceID])
-	if err != nil {
-		return nil, fmt.Errorf("failed to get resourceid extension: %v", err)
+	return &workv1.UpdateStrategy{
+		Type: workv1.UpdateStrategyTypeServerSideApply,
 	}
+}
 
-	resourceVersion, err := cloudeventstypes.ToInteger(evtExtensions[types.ExtensionResourceVersion])
-	if err != nil {
-		return nil, fmt.Errorf("failed to get resourceversion extension: %v", err)
+// feedbackRules returns the feedback rules of the resource, the whole status is fed back as the content status
+// if the resource has no feedback rules.
+func feedbackRules(resource *api.Resource) []workv1.FeedbackRule {
+	if len(resource.FeedbackRules) != 0 {
+		return resource.FeedbackRules
 	}
 
-	clusterName, err := cloudeventstypes.ToString(evtExtensions[types.ExtensionClusterName])
+	return []workv1.FeedbackRule{
+		{
+			Type: workv1.JSONPathsType,
+			JsonPaths: []workv1.JsonPath{
+				{
+					Name: contentStatusFeedback,
+					Path: ".status",
+				},
+			},
+		},
+	}
+}
+
+func (c *ResourceCodec) Decode(evt *cloudevents.Event) (*api.Resource, error) {
+	eventType, err := types.ParseCloudEventsType(evt.Type())
 	if err != nil {
-		return nil, fmt.Errorf("failed to get clustername extension: %v", err)
+		return nil, fmt.Errorf("failed to parse cloud event type %s, %v", evt.Type(), err)
 	}
 
-	sequenceID, err := cloudeventstypes.ToString(evtExtensions[types.ExtensionStatusUpdateSequenceID])
+	if eventType.CloudEventsDataType != payload.ManifestEventDataType {
+		return nil, fmt.Errorf("unsupported cloudevents data type %s", eventType.CloudEventsDataType)
+	}
+
+	warnings := &decodeWarnings{tolerant: c.Tolerant}
+	resource, err := decodeStatusResource(evt, warnings)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get sequenceid extension: %v", err)
+		return nil, err
 	}
+	resource.Type = api.ResourceTypeManifest
 
 	manifestStatus := &payload.ManifestStatus{}
 	if err := evt.DataAs(manifestStatus); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal event data %s, %v", string(evt.Data()), err)
-	}
-
-	resource := &api.Resource{
-		ResourceID:      resourceID,
-		ResourceVersion: int64(resourceVersion),
-		ClusterName:     clusterName,
-		Status: &api.ResourceStatus{
-			ReconcileStatus: &api.ReconcileStatus{
-				SequenceID: sequenceID,
-			},
-		},
+		conditions, err := salvageConditions(evt, err, warnings)
+		if err != nil {
+			return nil, err
+		}
+		manifestStatus = &payload.ManifestStatus{Conditions: conditions}
+	} else {
+		var manifests []workv1.ManifestCondition
+		if manifestStatus.Status != nil {
+			manifests = []workv1.ManifestCondition{*manifestStatus.Status}
+		}
+		if resource.Status.StatusHash, err = workStatusHash(manifestStatus.Conditions, manifests); err != nil {
+			return nil, err
+		}
 	}
 
 	// set deleted condition if manifest is deleted from agent
@@ -133,16 +163,67 @@ func (c *ResourceCodec) Decode(evt *cloudevents.Event) (*api.Resource, error) {
 
 	if manifestStatus.Status != nil {
 		resource.Status.ReconcileStatus.Conditions = append(resource.Status.ReconcileStatus.Conditions, manifestStatus.Status.Conditions...)
-		for _, value := range manifestStatus.Status.StatusFeedbacks.Values {
-			if value.Name == "status" {
-				contentStatus := make(map[string]interface{})
-				if err := json.Unmarshal([]byte(*value.Value.JsonRaw), &contentStatus); err != nil {
-					return nil, fmt.Errorf("failed to convert status feedback value to content status: %v", err)
-				}
-				resource.Status.ContentStatus = contentStatus
-			}
+		resource.Status.ContentStatus, resource.Status.Feedbacks, err = decodeFeedbacks(
+			manifestStatus.Status.StatusFeedbacks.Values, warnings)
+		if err != nil {
+			return nil, err
 		}
 	}
 
+	warnings.setCondition(resource.Status)
 	return resource, nil
 }
+
+// decodeFeedbacks decodes the status feedback values by their names, the `status` object is returned as the
+// content status. A value that can't be decoded is skipped, and a `status` that isn't an object is returned as a
+// feedback, if it's tolerated.
+func decodeFeedbacks(values []workv1.FeedbackValue, warnings *decodeWarnings) (map[string]interface{}, map[string]interface{}, error) {
+	var contentStatus, feedbacks map[string]interface{}
+	for _, value := range values {
+		feedback, err := feedbackValue(value.Value)
+		if err != nil {
+			if err := warnings.tolerate(fmt.Errorf("failed to decode status feedback %s, %v", value.Name, err)); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		if value.Name == contentStatusFeedback {
+			if status, ok := feedback.(map[string]interface{}); ok {
+				contentStatus = status
+				continue
+			}
+			// the tolerant decoding keeps the value as a feedback
+			if err := warnings.tolerate(fmt.Errorf("the status feedback %s is not a JSON object", value.Name)); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		if feedbacks == nil {
+			feedbacks = map[string]interface{}{}
+		}
+		feedbacks[value.Name] = feedback
+	}
+
+	return contentStatus, feedbacks, nil
+}
+
+// feedbackValue decodes a status feedback value to an int64, a string, a bool or a decoded JSON value.
+func feedbackValue(value workv1.FieldValue) (interface{}, error) {
+	switch {
+	case value.Type == workv1.Integer && value.Integer != nil:
+		return *value.Integer, nil
+	case value.Type == workv1.String && value.String != nil:
+		return *value.String, nil
+	case value.Type == workv1.Boolean && value.Boolean != nil:
+		return *value.Boolean, nil
+	case value.Type == workv1.JsonRaw && value.JsonRaw != nil:
+		var raw interface{}
+		if err := json.Unmarshal([]byte(*value.JsonRaw), &raw); err != nil {
+			return nil, err
+		}
+		return raw, nil
+	}
+
+	return nil, fmt.Errorf("the %s value is not set", value.Type)
+}
@@ -0,0 +1,340 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/morvencao/event-based-transport-demo/pkg/api"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/options"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/types"
+)
+
+// ConnectionState is the state of the connection between the source and a transport.
+type ConnectionState string
+
+const (
+	// ConnectionStateConnecting is the state before the first connection is established.
+	ConnectionStateConnecting ConnectionState = "Connecting"
+	// ConnectionStateConnected is the state when the client is connected.
+	ConnectionStateConnected ConnectionState = "Connected"
+	// ConnectionStateDisconnected is the state when the connection fails or is broken, the client reconnects with
+	// backoff.
+	ConnectionStateDisconnected ConnectionState = "Disconnected"
+)
+
+// ConnectionStateFunc is called when the connection state of a transport changes, the err is the cause of the
+// disconnection.
+type ConnectionStateFunc func(transport string, state ConnectionState, err error)
+
+// ConnectionOptions are the options of the connections of the source client.
+type ConnectionOptions struct {
+	// Backoff is the exponential backoff to connect to the transports until the first connection is established,
+	// and to publish the buffered events. Once connected, the sdk-go client reconnects with its own backoff.
+	Backoff wait.Backoff
+
+	// BufferSize is the max number of the events that are buffered while a transport is disconnected, the events
+	// are published in order once the transport is connected. A buffered event is requeued by the event controller
+	// until it's published, so it's kept in the event store. If the buffer is full, the publish fails and the
+	// event is retried by the event controller. If it's less than or equal to zero, the events are not buffered.
+	BufferSize int
+
+	// MaxFlushAttempts is the max number of attempts to publish a buffered event. Once they are exhausted, or the
+	// event fails to be encoded, the event is dropped from the buffer and its publish fails, so it counts as an
+	// attempt of the event controller. It's not limited if it's less than or equal to zero.
+	MaxFlushAttempts int
+
+	// OnStateChange is called when the connection state of a transport changes.
+	OnStateChange ConnectionStateFunc
+
+	// StatusHashGetter hashes the statuses that are sent in the status resync requests, the agents resend the
+	// statuses whose hashes don't match their own. It's StatusHashGetter if it's nil.
+	StatusHashGetter generic.StatusHashGetter[*api.Resource]
+}
+
+func NewConnectionOptions() *ConnectionOptions {
+	return &ConnectionOptions{
+		Backoff: wait.Backoff{
+			Duration: time.Second,
+			Factor:   2.0,
+			Jitter:   0.1,
+			Steps:    math.MaxInt32,
+			Cap:      time.Minute,
+		},
+		BufferSize:       1000,
+		MaxFlushAttempts: 5,
+	}
+}
+
+// bufferedEvent is an event that is published once the transport is connected, the resource is read from the
+// store when it's published, so the latest spec is sent.
+type bufferedEvent struct {
+	eventType  types.CloudEventsType
+	resourceID string
+}
+
+// transportConnection connects a CloudEvents client to a transport. It keeps retrying if the transport is not
+// available at startup, tracks the connection state and buffers the events that are published while the
+// transport is disconnected.
+type transportConnection struct {
+	name          string
+	options       *ConnectionOptions
+	sourceOptions *options.CloudEventsSourceOptions
+	newClient     func(ctx context.Context, sourceOptions *options.CloudEventsSourceOptions) (*generic.CloudEventSourceClient[*api.Resource], error)
+	resourceByID  func(id string) (*api.Resource, error)
+	encode        func(sourceID string, resource *api.Resource) (*cloudevents.Event, error)
+	onReconnected func(ctx context.Context)
+
+	lock   sync.Mutex
+	client *generic.CloudEventSourceClient[*api.Resource]
+	state  ConnectionState
+	buffer []bufferedEvent
+	// buffered are the events in the buffer
+	buffered map[bufferedEvent]bool
+	// flushed are the resource versions of the buffered events that are published, the events are handled once
+	// they are requeued
+	flushed map[bufferedEvent]int64
+	// dropped are the errors of the buffered events that fail to be published, the errors are returned once the
+	// events are requeued
+	dropped map[bufferedEvent]error
+	flush   chan struct{}
+}
+
+// start connects the client, if the first attempt fails, the client is connected in the background.
+func (c *transportConnection) start(ctx context.Context) {
+	c.state = ConnectionStateConnecting
+	c.buffered = make(map[bufferedEvent]bool)
+	c.flushed = make(map[bufferedEvent]int64)
+	c.dropped = make(map[bufferedEvent]error)
+	c.flush = make(chan struct{}, 1)
+	reportingOptions := &stateReportingOptions{
+		CloudEventsOptions: c.sourceOptions.CloudEventsOptions,
+		connection:         c,
+		errorChan:          make(chan error),
+	}
+	go reportingOptions.forwardErrors(ctx)
+	c.sourceOptions = &options.CloudEventsSourceOptions{
+		CloudEventsOptions: reportingOptions,
+		SourceID:           c.sourceOptions.SourceID,
+		EventRateLimit:     c.sourceOptions.EventRateLimit,
+	}
+
+	client, err := c.newClient(ctx, c.sourceOptions)
+	if err != nil {
+		c.setState(ConnectionStateDisconnected, err)
+	}
+
+	go c.run(ctx, client)
+}
+
+func (c *transportConnection) run(ctx context.Context, client *generic.CloudEventSourceClient[*api.Resource]) {
+	// the status events that are sent before a delayed first connection are missed, so they are resynced
+	delayed := client == nil
+	backoff := c.options.Backoff
+	for client == nil {
+		select {
+		case <-time.After(backoff.Step()):
+		case <-ctx.Done():
+			return
+		}
+
+		var err error
+		if client, err = c.newClient(ctx, c.sourceOptions); err != nil {
+			c.setState(ConnectionStateDisconnected, err)
+		}
+	}
+
+	c.lock.Lock()
+	c.client = client
+	c.lock.Unlock()
+	c.setState(ConnectionStateConnected, nil)
+	c.triggerFlush()
+	if delayed {
+		c.onReconnected(ctx)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-client.ReconnectedChan():
+			c.setState(ConnectionStateConnected, nil)
+			c.triggerFlush()
+			c.onReconnected(ctx)
+		case <-c.flush:
+			c.flushBuffer(ctx)
+		}
+	}
+}
+
+// publish sends the event if the transport is connected, otherwise the event is buffered. The events are buffered
+// until the buffer is flushed even if the transport is connected, so they are sent in order. A buffered event is
+// requeued until the flush publishes it, so it's not forgotten by the event controller before it's sent.
+func (c *transportConnection) publish(ctx context.Context, eventType types.CloudEventsType, resource *api.Resource) error {
+	evt := bufferedEvent{eventType: eventType, resourceID: resource.ResourceID}
+
+	c.lock.Lock()
+	if err, ok := c.dropped[evt]; ok {
+		// the event is dropped by the flush
+		delete(c.dropped, evt)
+		c.lock.Unlock()
+		return err
+	}
+	if version, ok := c.flushed[evt]; ok {
+		delete(c.flushed, evt)
+		if version == resource.ResourceVersion {
+			// the event is published by the flush
+			c.lock.Unlock()
+			return nil
+		}
+	}
+
+	if c.state != ConnectionStateConnected || len(c.buffer) != 0 {
+		defer c.lock.Unlock()
+		if !c.buffered[evt] {
+			if len(c.buffer) >= c.options.BufferSize {
+				return fmt.Errorf("the transport %s is %s and its publish buffer is full", c.name, c.state)
+			}
+
+			c.buffer = append(c.buffer, evt)
+			c.buffered[evt] = true
+		}
+		return &RequeueError{
+			Delay:  c.options.Backoff.Duration,
+			Reason: fmt.Sprintf("the event is buffered until the transport %s is connected", c.name),
+		}
+	}
+	client := c.client
+	c.lock.Unlock()
+
+	return client.Publish(ctx, eventType, resource)
+}
+
+// resync sends a status resync request to the given cluster.
+func (c *transportConnection) resync(ctx context.Context, clusterName string) error {
+	c.lock.Lock()
+	client := c.client
+	c.lock.Unlock()
+
+	if client == nil {
+		return fmt.Errorf("the transport %s is not connected", c.name)
+	}
+	return client.Resync(ctx, clusterName)
+}
+
+// flushBuffer publishes the buffered events in order until the buffer is empty or the transport is disconnected.
+// A failed event stays at the front of the buffer and is retried with backoff until its attempts are exhausted, an
+// event that fails to be encoded is dropped at once since it never succeeds.
+func (c *transportConnection) flushBuffer(ctx context.Context) {
+	backoff, attempts := c.options.Backoff, 0
+	for {
+		c.lock.Lock()
+		if c.state != ConnectionStateConnected || len(c.buffer) == 0 {
+			c.lock.Unlock()
+			return
+		}
+		evt := c.buffer[0]
+		client := c.client
+		c.lock.Unlock()
+
+		// the resource may be removed after its event is buffered
+		resource, err := c.resourceByID(evt.resourceID)
+		var publishErr error
+		if err == nil {
+			if _, err := c.encode(c.sourceOptions.SourceID, resource); err != nil {
+				publishErr = fmt.Errorf("failed to encode the %s event of resource %s, %v",
+					evt.eventType.Action, evt.resourceID, err)
+			} else if err := client.Publish(ctx, evt.eventType, resource); err != nil {
+				attempts++
+				publishErr = fmt.Errorf("failed to publish the buffered %s event of resource %s to transport %s, %v",
+					evt.eventType.Action, evt.resourceID, c.name, err)
+				if c.options.MaxFlushAttempts <= 0 || attempts < c.options.MaxFlushAttempts {
+					runtime.HandleError(publishErr)
+					select {
+					case <-time.After(backoff.Step()):
+						continue
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}
+
+		c.lock.Lock()
+		c.buffer = c.buffer[1:]
+		delete(c.buffered, evt)
+		switch {
+		case publishErr != nil:
+			c.dropped[evt] = publishErr
+		case err == nil:
+			c.flushed[evt] = resource.ResourceVersion
+		}
+		c.lock.Unlock()
+		backoff, attempts = c.options.Backoff, 0
+	}
+}
+
+func (c *transportConnection) triggerFlush() {
+	select {
+	case c.flush <- struct{}{}:
+	default:
+	}
+}
+
+func (c *transportConnection) connectionState() ConnectionState {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.state
+}
+
+func (c *transportConnection) setState(state ConnectionState, err error) {
+	c.lock.Lock()
+	changed := c.state != state
+	c.state = state
+	c.lock.Unlock()
+
+	if changed && c.options.OnStateChange != nil {
+		c.options.OnStateChange(c.name, state, err)
+	}
+}
+
+// stateReportingOptions marks the connection as disconnected once the transport reports a connection error, the
+// error is then forwarded to the sdk-go client to reconnect.
+type stateReportingOptions struct {
+	options.CloudEventsOptions
+	connection *transportConnection
+	errorChan  chan error
+}
+
+func (o *stateReportingOptions) ErrorChan() <-chan error {
+	return o.errorChan
+}
+
+func (o *stateReportingOptions) forwardErrors(ctx context.Context) {
+	errorChan := o.CloudEventsOptions.ErrorChan()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err, ok := <-errorChan:
+			if !ok {
+				close(o.errorChan)
+				return
+			}
+
+			o.connection.setState(ConnectionStateDisconnected, err)
+			select {
+			case o.errorChan <- err:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/morvencao/event-based-transport-demo/pkg/api"
+	"github.com/morvencao/event-based-transport-demo/pkg/fakeagent"
+	"github.com/morvencao/event-based-transport-demo/pkg/store"
+	"github.com/morvencao/event-based-transport-demo/pkg/transport"
+
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/options"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/types"
+)
+
+func TestBufferedEventIsKeptUntilPublished(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	broker := transport.NewLoopbackBroker()
+	resourceStore := store.NewMemoryStore()
+	client, connection, connect := newDelayedTestClient(broker, resourceStore)
+	var resynced atomic.Int32
+	connection.onReconnected = func(ctx context.Context) { resynced.Add(1) }
+	connection.start(ctx)
+
+	agent, err := fakeagent.StartFakeAgent(ctx, transport.NewLoopbackAgentOptions(broker, "cluster1", "cluster1-agent"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eventStore := NewMemoryEventStore()
+	ec := newTestEventController(ctx, eventStore, client)
+
+	resource := newTestResource("source", "cluster1", "nginx")
+	resourceStore.Add(resource)
+	ec.EnqueueEvent(Event{EventType: CreateEvent, ID: resource.ResourceID})
+
+	// the event is buffered once, and it's kept in the event store while it's requeued
+	bufferLen := func() int {
+		connection.lock.Lock()
+		defer connection.lock.Unlock()
+		return len(connection.buffer)
+	}
+	if err := waitFor(func() bool { return bufferLen() == 1 }); err != nil {
+		t.Fatalf("expected the event is buffered")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := bufferLen(); n != 1 {
+		t.Errorf("expected the event is buffered once, but got %d buffered events", n)
+	}
+	if pending, _ := eventStore.List(); len(pending) != 1 {
+		t.Errorf("expected the buffered event is kept in the event store, but got %v", pending)
+	}
+
+	// the event is forgotten once the buffer is flushed
+	close(connect)
+	if err := waitFor(func() bool {
+		_, ok := agent.Get(resource.ResourceID)
+		pending, _ := eventStore.List()
+		return ok && len(pending) == 0
+	}); err != nil {
+		t.Fatalf("expected the buffered event is published and handled")
+	}
+	if deadLetters := ec.DeadLetters().List(); len(deadLetters) != 0 {
+		t.Errorf("expected no dead letters, but got %v", deadLetters)
+	}
+
+	// the statuses are resynced once the delayed first connection is established
+	if n := resynced.Load(); n != 1 {
+		t.Errorf("expected the statuses are resynced once, but got %d resyncs", n)
+	}
+}
+
+func TestBufferedEventIsDroppedOnFailure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	broker := transport.NewLoopbackBroker()
+	resourceStore := store.NewMemoryStore()
+	client, connection, connect := newDelayedTestClient(broker, resourceStore)
+	broken := newTestResource("source", "cluster1", "broken")
+	client.codecs[0] = &brokenCodec{Codec: client.codecs[0], resourceID: broken.ResourceID}
+	connection.start(ctx)
+
+	agent, err := fakeagent.StartFakeAgent(ctx, transport.NewLoopbackAgentOptions(broker, "cluster1", "cluster1-agent"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ec := newTestEventController(ctx, NewMemoryEventStore(), client)
+
+	// the broken event is at the front of the buffer, it doesn't block the event behind it
+	resource := newTestResource("source", "cluster1", "nginx")
+	resourceStore.Add(broken)
+	resourceStore.Add(resource)
+	ec.EnqueueEvent(Event{EventType: CreateEvent, ID: broken.ResourceID})
+	if err := waitFor(func() bool {
+		connection.lock.Lock()
+		defer connection.lock.Unlock()
+		return connection.buffered[bufferedEvent{eventType: createRequest, resourceID: broken.ResourceID}]
+	}); err != nil {
+		t.Fatalf("expected the broken event is buffered")
+	}
+	ec.EnqueueEvent(Event{EventType: CreateEvent, ID: resource.ResourceID})
+
+	close(connect)
+	if err := waitFor(func() bool {
+		_, ok := agent.Get(resource.ResourceID)
+		return ok
+	}); err != nil {
+		t.Fatalf("expected the event behind the broken event is published")
+	}
+
+	// the failures of the broken event count as attempts, so it's dead-lettered
+	if err := waitFor(func() bool { return len(ec.DeadLetters().List()) == 1 }); err != nil {
+		t.Fatalf("expected the broken event is dead-lettered, but got %v", ec.DeadLetters().List())
+	}
+	if deadLetter := ec.DeadLetters().List()[0]; deadLetter.Event.ID != broken.ResourceID {
+		t.Errorf("expected the dead letter of resource %s, but got %v", broken.ResourceID, deadLetter)
+	}
+}
+
+// brokenCodec fails to encode the resource of the resource ID, e.g. since there is no encryption key of its cluster.
+type brokenCodec struct {
+	generic.Codec[*api.Resource]
+	resourceID string
+}
+
+func (c *brokenCodec) Encode(source string, eventType types.CloudEventsType, resource *api.Resource) (*cloudevents.Event, error) {
+	if resource.ResourceID == c.resourceID {
+		return nil, fmt.Errorf("no encryption key of cluster %s", resource.ClusterName)
+	}
+	return c.Codec.Encode(source, eventType, resource)
+}
+
+// newDelayedTestClient returns a source client whose default transport is connected once the returned channel is
+// closed, the connection is started by the caller.
+func newDelayedTestClient(broker *transport.LoopbackBroker, resourceStore store.Store) (*ResourceSourceClient, *transportConnection, chan struct{}) {
+	client := &ResourceSourceClient{
+		connections: map[string]*transportConnection{},
+		router:      &ClusterRouter{Default: DefaultTransport},
+		store:       resourceStore,
+		codecs:      []generic.Codec[*api.Resource]{&ResourceCodec{}, &ResourceBundleCodec{}},
+		statusHash:  StatusHashGetter,
+	}
+
+	// the transport is not available until it's connected
+	connect := make(chan struct{})
+	connectionOptions := NewConnectionOptions()
+	connectionOptions.Backoff.Duration = 10 * time.Millisecond
+	connection := &transportConnection{
+		name:          DefaultTransport,
+		options:       connectionOptions,
+		sourceOptions: transport.NewLoopbackSourceOptions(broker, "source"),
+		newClient: func(ctx context.Context, sourceOptions *options.CloudEventsSourceOptions) (*generic.CloudEventSourceClient[*api.Resource], error) {
+			select {
+			case <-connect:
+				return client.newClient(ctx, sourceOptions)
+			default:
+				return nil, fmt.Errorf("the transport is not available")
+			}
+		},
+		resourceByID:  resourceStore.Get,
+		encode:        client.encodeSpec,
+		onReconnected: func(ctx context.Context) {},
+	}
+	client.connections[DefaultTransport] = connection
+	return client, connection, connect
+}
+
+func newTestEventController(ctx context.Context, eventStore EventStore, client *ResourceSourceClient) *EventController {
+	eventControllerOptions := NewEventControllerOptions()
+	eventControllerOptions.EventStore = eventStore
+	eventControllerOptions.MaxRetries = 1
+	ec := NewEventController(eventControllerOptions)
+	ec.AddEventHandler(CreateEvent, client.OnCreate)
+	go ec.Run(ctx)
+	return ec
+}
@@ -0,0 +1,91 @@
+package source
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DeadLetter records an event that failed to be handled after exhausting its retries.
+type DeadLetter struct {
+	ID       string    `json:"id"`
+	Event    Event     `json:"event"`
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	FailedAt time.Time `json:"failedAt"`
+}
+
+// DeadLetterQueue keeps the dead-lettered events in memory so that they can be inspected and replayed. A dead-lettered
+// event is removed from the event store, so the dead letters are lost on restart even if the event store is persisted.
+type DeadLetterQueue struct {
+	sync.RWMutex
+
+	deadLetters map[string]*DeadLetter
+}
+
+func NewDeadLetterQueue() *DeadLetterQueue {
+	return &DeadLetterQueue{
+		deadLetters: make(map[string]*DeadLetter),
+	}
+}
+
+// Add adds a failed event to the dead-letter queue and returns the dead letter
+func (q *DeadLetterQueue) Add(event Event, attempts int, err error) *DeadLetter {
+	q.Lock()
+	defer q.Unlock()
+
+	deadLetter := &DeadLetter{
+		ID:       uuid.New().String(),
+		Event:    event,
+		Error:    err.Error(),
+		Attempts: attempts,
+		FailedAt: time.Now(),
+	}
+	q.deadLetters[deadLetter.ID] = deadLetter
+	return deadLetter
+}
+
+// Get retrieves a dead letter from the dead-letter queue
+func (q *DeadLetterQueue) Get(id string) (*DeadLetter, error) {
+	q.RLock()
+	defer q.RUnlock()
+
+	deadLetter, ok := q.deadLetters[id]
+	if !ok {
+		return nil, fmt.Errorf("failed to find dead letter %s", id)
+	}
+
+	return deadLetter, nil
+}
+
+// Remove removes a dead letter from the dead-letter queue
+func (q *DeadLetterQueue) Remove(id string) (*DeadLetter, error) {
+	q.Lock()
+	defer q.Unlock()
+
+	deadLetter, ok := q.deadLetters[id]
+	if !ok {
+		return nil, fmt.Errorf("failed to find dead letter %s", id)
+	}
+
+	delete(q.deadLetters, id)
+	return deadLetter, nil
+}
+
+// List lists all dead letters, the oldest failure comes first
+func (q *DeadLetterQueue) List() []*DeadLetter {
+	q.RLock()
+	defer q.RUnlock()
+
+	deadLetters := []*DeadLetter{}
+	for _, deadLetter := range q.deadLetters {
+		deadLetters = append(deadLetters, deadLetter)
+	}
+	sort.Slice(deadLetters, func(i, j int) bool {
+		return deadLetters[i].FailedAt.Before(deadLetters[j].FailedAt)
+	})
+	return deadLetters
+}
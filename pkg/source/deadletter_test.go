@@ -0,0 +1,38 @@
+package source
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDeadLetterQueue(t *testing.T) {
+	q := NewDeadLetterQueue()
+	second := q.Add(Event{EventType: UpdateEvent, ID: "r2"}, 3, fmt.Errorf("failed"))
+	first := q.Add(Event{EventType: UpdateEvent, ID: "r1"}, 3, fmt.Errorf("failed"))
+	third := q.Add(Event{EventType: DeleteEvent, ID: "r3"}, 3, fmt.Errorf("failed"))
+	now := time.Now()
+	first.FailedAt, second.FailedAt, third.FailedAt = now.Add(-2*time.Minute), now.Add(-time.Minute), now
+
+	// the oldest failure comes first
+	deadLetters := q.List()
+	if len(deadLetters) != 3 || deadLetters[0] != first || deadLetters[1] != second || deadLetters[2] != third {
+		t.Fatalf("expected the dead letters are ordered by the failure time, but got %v", deadLetters)
+	}
+
+	if deadLetter, err := q.Get(second.ID); err != nil || deadLetter != second {
+		t.Errorf("expected to get the dead letter %s, but got %v %v", second.ID, deadLetter, err)
+	}
+	if _, err := q.Remove(second.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Get(second.ID); err == nil {
+		t.Errorf("expected the removed dead letter is not found")
+	}
+	if _, err := q.Remove(second.ID); err == nil {
+		t.Errorf("expected the removed dead letter can't be removed again")
+	}
+	if deadLetters := q.List(); len(deadLetters) != 2 || deadLetters[0] != first || deadLetters[1] != third {
+		t.Errorf("expected the remaining dead letters, but got %v", deadLetters)
+	}
+}
@@ -0,0 +1,139 @@
+package source
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cloudeventstypes "github.com/cloudevents/sdk-go/v2/types"
+	"github.com/morvencao/event-based-transport-demo/pkg/api"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/types"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/work/common"
+)
+
+const (
+	// ConditionDecodeWarning is set on the status of a resource if its status event is decoded in the tolerant mode
+	// with problems, the message lists the problems.
+	ConditionDecodeWarning = "DecodeWarning"
+	// ReasonMalformedStatusEvent is the reason of the decode warning condition.
+	ReasonMalformedStatusEvent = "MalformedStatusEvent"
+)
+
+// TolerantDecodeMiddleware switches the resource codecs to the tolerant mode. It replaces the codec instead of
+// wrapping it, so it must be the last middleware.
+func TolerantDecodeMiddleware() CodecMiddleware {
+	return func(codec generic.Codec[*api.Resource]) generic.Codec[*api.Resource] {
+		switch codec.(type) {
+		case *ResourceCodec:
+			return &ResourceCodec{Tolerant: true}
+		case *ResourceBundleCodec:
+			return &ResourceBundleCodec{Tolerant: true}
+		}
+		return codec
+	}
+}
+
+// decodeWarnings collects the problems of a status event that are tolerated. In the strict mode, a problem fails
+// the event.
+type decodeWarnings struct {
+	tolerant bool
+	messages []string
+}
+
+// tolerate records the error as a warning in the tolerant mode, otherwise it returns the error.
+func (w *decodeWarnings) tolerate(err error) error {
+	if !w.tolerant {
+		return err
+	}
+
+	w.messages = append(w.messages, err.Error())
+	return nil
+}
+
+// setCondition sets the decode warning condition on the status if there are warnings.
+func (w *decodeWarnings) setCondition(status *api.ResourceStatus) {
+	if len(w.messages) == 0 {
+		return
+	}
+
+	status.ReconcileStatus.Conditions = append(status.ReconcileStatus.Conditions, metav1.Condition{
+		Type:               ConditionDecodeWarning,
+		Status:             metav1.ConditionTrue,
+		Reason:             ReasonMalformedStatusEvent,
+		Message:            strings.Join(w.messages, "; "),
+		LastTransitionTime: metav1.Now(),
+	})
+}
+
+// decodeStatusResource decodes the extensions of a status event into a resource. The resource ID and the cluster
+// name are always required since the status can't be matched to a resource without them, the missing resource
+// version and sequence ID are tolerated.
+func decodeStatusResource(evt *cloudevents.Event, warnings *decodeWarnings) (*api.Resource, error) {
+	evtExtensions := evt.Context.GetExtensions()
+
+	resourceID, err := cloudeventstypes.ToString(evtExtensions[types.ExtensionResourceID])
+	if err != nil {
+		return nil, fmt.Errorf("failed to get resourceid extension: %v", err)
+	}
+
+	clusterName, err := cloudeventstypes.ToString(evtExtensions[types.ExtensionClusterName])
+	if err != nil {
+		return nil, fmt.Errorf("failed to get clustername extension: %v", err)
+	}
+
+	resourceVersion, err := cloudeventstypes.ToInteger(evtExtensions[types.ExtensionResourceVersion])
+	if err != nil {
+		if err := warnings.tolerate(fmt.Errorf("failed to get resourceversion extension: %v", err)); err != nil {
+			return nil, err
+		}
+	}
+
+	sequenceID, err := cloudeventstypes.ToString(evtExtensions[types.ExtensionStatusUpdateSequenceID])
+	if err != nil {
+		if err := warnings.tolerate(fmt.Errorf("failed to get sequenceid extension: %v", err)); err != nil {
+			return nil, err
+		}
+	}
+
+	return &api.Resource{
+		ResourceID:      resourceID,
+		ResourceVersion: int64(resourceVersion),
+		ClusterName:     clusterName,
+		Status: &api.ResourceStatus{
+			ObservedResourceVersion: int64(resourceVersion),
+			ReconcileStatus: &api.ReconcileStatus{
+				SequenceID: sequenceID,
+			},
+		},
+	}, nil
+}
+
+// salvageConditions salvages the conditions of the status event data that fails to be unmarshaled, e.g. the status
+// feedback of an agent with a different payload version. The event fails if it's not tolerated or the conditions
+// can't be salvaged either, e.g. the data is not JSON. The ManifestsDeleted condition is not salvaged, so a
+// malformed event never deletes a resource.
+func salvageConditions(evt *cloudevents.Event, err error, warnings *decodeWarnings) ([]metav1.Condition, error) {
+	err = fmt.Errorf("failed to unmarshal event data %s, %v", string(evt.Data()), err)
+	if !warnings.tolerant {
+		return nil, err
+	}
+
+	salvaged := struct {
+		Conditions []metav1.Condition `json:"conditions"`
+	}{}
+	if json.Unmarshal(evt.Data(), &salvaged) != nil {
+		return nil, err
+	}
+	conditions := []metav1.Condition{}
+	for _, condition := range salvaged.Conditions {
+		if condition.Type == common.ManifestsDeleted {
+			continue
+		}
+		conditions = append(conditions, condition)
+	}
+	return conditions, warnings.tolerate(fmt.Errorf("the event data is malformed, only the conditions are decoded"))
+}
@@ -0,0 +1,100 @@
+package source
+
+import (
+	"reflect"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"k8s.io/apimachinery/pkg/api/meta"
+	workv1 "open-cluster-management.io/api/work/v1"
+
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/types"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/work/common"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/work/payload"
+)
+
+func TestSalvagedStatusNeverDeletes(t *testing.T) {
+	// the status doesn't match the payload, only the conditions can be salvaged
+	evt := newStatusTestEvent(t, map[string]interface{}{
+		"conditions": []map[string]interface{}{
+			{"type": common.ManifestsDeleted, "status": "True", "reason": "ManifestsDeleted",
+				"lastTransitionTime": "2024-01-01T00:00:00Z"},
+			{"type": "Applied", "status": "True", "reason": "Applied",
+				"lastTransitionTime": "2024-01-01T00:00:00Z"},
+		},
+		"status": "malformed",
+	})
+
+	if _, err := (&ResourceCodec{}).Decode(evt); err == nil {
+		t.Fatalf("expected the malformed event fails in the strict mode")
+	}
+
+	resource, err := (&ResourceCodec{Tolerant: true}).Decode(evt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conditions := resource.Status.ReconcileStatus.Conditions
+	if meta.FindStatusCondition(conditions, common.ManifestsDeleted) != nil {
+		t.Errorf("expected the deleted condition is not salvaged, but got %v", conditions)
+	}
+	if !meta.IsStatusConditionTrue(conditions, ConditionDecodeWarning) {
+		t.Errorf("expected the decode warning condition, but got %v", conditions)
+	}
+	// the salvaged status isn't the status of the agent, so the agent resends its status on a resync
+	if resource.Status.StatusHash != "" {
+		t.Errorf("expected no status hash of the salvaged status, but got %s", resource.Status.StatusHash)
+	}
+}
+
+func TestDecodeStatusFeedbackOfNonObject(t *testing.T) {
+	running := `"running"`
+	evt := newStatusTestEvent(t, &payload.ManifestStatus{
+		Status: &workv1.ManifestCondition{
+			StatusFeedbacks: workv1.StatusFeedbackResult{
+				Values: []workv1.FeedbackValue{{
+					Name:  contentStatusFeedback,
+					Value: workv1.FieldValue{Type: workv1.JsonRaw, JsonRaw: &running},
+				}},
+			},
+		},
+	})
+
+	if _, err := (&ResourceCodec{}).Decode(evt); err == nil {
+		t.Fatalf("expected the status feedback that isn't an object fails in the strict mode")
+	}
+
+	// the tolerant decoding keeps the value as a feedback with a decode warning
+	resource, err := (&ResourceCodec{Tolerant: true}).Decode(evt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resource.Status.ContentStatus != nil {
+		t.Errorf("expected no content status, but got %v", resource.Status.ContentStatus)
+	}
+	if !reflect.DeepEqual(resource.Status.Feedbacks, map[string]interface{}{contentStatusFeedback: "running"}) {
+		t.Errorf("expected the status is kept as a feedback, but got %v", resource.Status.Feedbacks)
+	}
+	if !meta.IsStatusConditionTrue(resource.Status.ReconcileStatus.Conditions, ConditionDecodeWarning) {
+		t.Errorf("expected the decode warning condition, but got %v", resource.Status.ReconcileStatus.Conditions)
+	}
+}
+
+// newStatusTestEvent returns a status event of the resource r1 on cluster1 with the given data.
+func newStatusTestEvent(t *testing.T, data interface{}) *cloudevents.Event {
+	evt := cloudevents.NewEvent()
+	evt.SetID("1")
+	evt.SetSource("cluster1-agent")
+	evt.SetType(types.CloudEventsType{
+		CloudEventsDataType: payload.ManifestEventDataType,
+		SubResource:         types.SubResourceStatus,
+		Action:              "update_request",
+	}.String())
+	evt.SetExtension(types.ExtensionResourceID, "r1")
+	evt.SetExtension(types.ExtensionClusterName, "cluster1")
+	evt.SetExtension(types.ExtensionResourceVersion, 1)
+	evt.SetExtension(types.ExtensionStatusUpdateSequenceID, "1")
+	if err := evt.SetData(cloudevents.ApplicationJSON, data); err != nil {
+		t.Fatal(err)
+	}
+	return &evt
+}
@@ -2,11 +2,12 @@ package source
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
-	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/util/workqueue"
 )
 
@@ -19,85 +20,448 @@ const (
 )
 
 type Event struct {
-	EventType EventType
-	ID        string
+	EventType EventType     `json:"eventType"`
+	ID        string        `json:"id"`
+	Priority  EventPriority `json:"priority,omitempty"`
+}
+
+// key returns the event without its priority, the events of a resource are deduplicated by their keys regardless of
+// their priorities.
+func (e Event) key() Event {
+	e.Priority = ""
+	return e
 }
 
 type EventHandler func(ctx context.Context, id string) error
 
+// RequeueError is returned by a handler or a middleware to handle the event again after the delay, e.g. when it's
+// rate limited. The event is not failed, so it doesn't count as an attempt.
+type RequeueError struct {
+	Delay  time.Duration
+	Reason string
+}
+
+func (e *RequeueError) Error() string {
+	return fmt.Sprintf("requeued after %v: %s", e.Delay, e.Reason)
+}
+
+// HandlerOption configures an event handler when it's added to the EventController.
+type HandlerOption func(*registeredHandler)
+
+// NonFatal marks a handler as non-fatal, its error is logged and does not stop the subsequent handlers or fail the
+// event, so the event is not retried for it.
+func NonFatal() HandlerOption {
+	return func(h *registeredHandler) {
+		h.nonFatal = true
+	}
+}
+
+type registeredHandler struct {
+	handler  EventHandler
+	nonFatal bool
+}
+
+// EventControllerOptions holds the options that are used to build the EventController.
+type EventControllerOptions struct {
+	// MaxRetries is the number of times a failed event is retried before it's moved to the dead-letter queue.
+	// If it's less than or equal to zero, the failed event is retried forever.
+	MaxRetries int
+
+	// HandlerTimeout is the timeout for handling one event by all of its handlers.
+	// If it's less than or equal to zero, the handlers run without timeout.
+	HandlerTimeout time.Duration
+
+	// DrainGracePeriod is how long the controller waits for the queued and in-flight events to be handled on
+	// shutdown, the events that are not handled within this period are reported as unpublished.
+	DrainGracePeriod time.Duration
+
+	// EventStore records the pending events, the pending events are reloaded from it when the controller starts.
+	// If it's nil, the pending events are kept in memory.
+	EventStore EventStore
+
+	// EventPriorities is the default priority of each event type, it's used when an event is enqueued without
+	// priority. The event type that is not in it has the normal priority.
+	EventPriorities map[EventType]EventPriority
+
+	// PriorityWeights is how many events of each priority are served in a scheduling round, so that the lower
+	// priority events are not starved by the higher ones. The weight is at least 1.
+	PriorityWeights map[EventPriority]int
+
+	// MetricsProvider provides the metrics of the event queue, e.g. its depth, latency and retries, the queue is named
+	// `events`. The metrics are not recorded if it's nil.
+	MetricsProvider workqueue.MetricsProvider
+}
+
+func NewEventControllerOptions() *EventControllerOptions {
+	return &EventControllerOptions{
+		MaxRetries:       10,
+		HandlerTimeout:   30 * time.Second,
+		DrainGracePeriod: 30 * time.Second,
+		EventPriorities: map[EventType]EventPriority{
+			DeleteEvent: HighPriority,
+		},
+		PriorityWeights: map[EventPriority]int{
+			HighPriority:   8,
+			NormalPriority: 4,
+			LowPriority:    1,
+		},
+	}
+}
+
+// eventsQueueName is the name of the event queue in its metrics.
+const eventsQueueName = "events"
+
 type EventController struct {
-	eventsQueue workqueue.RateLimitingInterface
-	handlers    map[EventType][]EventHandler
+	sync.Mutex
+
+	eventsQueue      workqueue.RateLimitingInterface
+	priorityQueue    *priorityQueue
+	handlers         map[EventType][]*registeredHandler
+	middlewares      []Middleware
+	typeMiddlewares  map[EventType][]Middleware
+	eventPriorities  map[EventType]EventPriority
+	deadLetterQueue  *DeadLetterQueue
+	eventStore       EventStore
+	maxRetries       int
+	handlerTimeout   time.Duration
+	drainGracePeriod time.Duration
+	unpublished      []Event
+	// delayed are the events that are waiting in the delaying queue to be retried, they are lost when the queue is
+	// shut down, so they are reported as unpublished
+	delayed map[Event]struct{}
+
+	// serializes recording the events in the event store with queuing them, so an event that is added again while
+	// it's processing is not removed from the event store when its processing is done
+	storeLock sync.Mutex
 }
 
-func NewEventController() *EventController {
+func NewEventController(options *EventControllerOptions) *EventController {
+	eventStore := options.EventStore
+	if eventStore == nil {
+		eventStore = NewMemoryEventStore()
+	}
+
+	priorityQueue := newPriorityQueue(eventsQueueName, options.PriorityWeights, options.MetricsProvider)
 	return &EventController{
-		eventsQueue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "events"),
-		handlers:    make(map[EventType][]EventHandler),
+		eventsQueue: workqueue.NewRateLimitingQueueWithConfig(
+			workqueue.DefaultControllerRateLimiter(),
+			workqueue.RateLimitingQueueConfig{
+				Name:            eventsQueueName,
+				MetricsProvider: options.MetricsProvider,
+				DelayingQueue: workqueue.NewDelayingQueueWithConfig(workqueue.DelayingQueueConfig{
+					Name:            eventsQueueName,
+					MetricsProvider: options.MetricsProvider,
+					Queue:           priorityQueue,
+				}),
+			},
+		),
+		priorityQueue:    priorityQueue,
+		handlers:         make(map[EventType][]*registeredHandler),
+		typeMiddlewares:  make(map[EventType][]Middleware),
+		eventPriorities:  options.EventPriorities,
+		deadLetterQueue:  NewDeadLetterQueue(),
+		eventStore:       eventStore,
+		maxRetries:       options.MaxRetries,
+		handlerTimeout:   options.HandlerTimeout,
+		drainGracePeriod: options.DrainGracePeriod,
+		delayed:          make(map[Event]struct{}),
 	}
 }
 
-func (ec *EventController) AddEventHandler(eventType EventType, handler EventHandler) {
-	ec.handlers[eventType] = append(ec.handlers[eventType], handler)
+func (ec *EventController) AddEventHandler(eventType EventType, handler EventHandler, opts ...HandlerOption) {
+	h := &registeredHandler{handler: handler}
+	for _, opt := range opts {
+		opt(h)
+	}
+	ec.handlers[eventType] = append(ec.handlers[eventType], h)
+}
+
+// Use adds middlewares that wrap the handlers of all event types. The middlewares are applied in order, the first
+// one is the outermost, and they wrap the middlewares added with UseFor.
+func (ec *EventController) Use(middlewares ...Middleware) {
+	ec.middlewares = append(ec.middlewares, middlewares...)
+}
+
+// UseFor adds middlewares that wrap the handlers of the given event type.
+func (ec *EventController) UseFor(eventType EventType, middlewares ...Middleware) {
+	ec.typeMiddlewares[eventType] = append(ec.typeMiddlewares[eventType], middlewares...)
 }
 
 func (ec *EventController) EnqueueEvent(event Event) {
-	ec.eventsQueue.Add(event)
+	if event.Priority == "" {
+		event.Priority = NormalPriority
+		if priority, ok := ec.eventPriorities[event.EventType]; ok {
+			event.Priority = priority
+		}
+	}
+
+	ec.storeLock.Lock()
+	defer ec.storeLock.Unlock()
+
+	// record the event before it's queued, so that it can be reloaded if the source restarts
+	if err := ec.eventStore.Add(event); err != nil {
+		log.Printf("Failed to record the event %v, %v", event, err)
+	}
+
+	if ec.eventsQueue.ShuttingDown() {
+		// the controller is shutting down and does not accept new events
+		log.Printf("Event controller is shutting down, the event %v will not be published", event)
+		ec.addUnpublished(event)
+		return
+	}
+
+	ec.priorityQueue.setPriority(event.key(), event.Priority)
+	ec.eventsQueue.Add(event.key())
 }
 
+// Unpublished returns the events that were not published when the controller shut down.
+func (ec *EventController) Unpublished() []Event {
+	ec.Lock()
+	defer ec.Unlock()
+
+	return append([]Event{}, ec.unpublished...)
+}
+
+func (ec *EventController) addUnpublished(event Event) {
+	ec.Lock()
+	defer ec.Unlock()
+
+	ec.unpublished = append(ec.unpublished, event)
+}
+
+// addDelayed records the event that is added to the delaying queue.
+func (ec *EventController) addDelayed(key Event) {
+	ec.Lock()
+	defer ec.Unlock()
+
+	ec.delayed[key] = struct{}{}
+}
+
+// removeDelayed removes the event that is out of the delaying queue.
+func (ec *EventController) removeDelayed(key Event) {
+	ec.Lock()
+	defer ec.Unlock()
+
+	delete(ec.delayed, key)
+}
+
+// addDelayedToUnpublished reports the events that are still waiting to be retried after the queue is shut down.
+func (ec *EventController) addDelayedToUnpublished() {
+	ec.Lock()
+	defer ec.Unlock()
+
+	for key := range ec.delayed {
+		event := key
+		event.Priority = ec.priorityQueue.priority(key)
+		ec.unpublished = append(ec.unpublished, event)
+	}
+	ec.delayed = make(map[Event]struct{})
+}
+
+// DeadLetters returns the dead-letter queue that holds the events failed after the max retries.
+func (ec *EventController) DeadLetters() *DeadLetterQueue {
+	return ec.deadLetterQueue
+}
+
+// RetryDeadLetter removes the dead letter from the dead-letter queue and enqueues its event again.
+func (ec *EventController) RetryDeadLetter(id string) (*DeadLetter, error) {
+	deadLetter, err := ec.deadLetterQueue.Remove(id)
+	if err != nil {
+		return nil, err
+	}
+
+	ec.EnqueueEvent(deadLetter.Event)
+	return deadLetter, nil
+}
+
+// Run handles the events until the ctx is done. On shutdown, it stops accepting new events and drains the queued
+// and in-flight events up to the drain grace period, then returns. The events that are not handled, including the
+// ones waiting to be retried, are reported as unpublished.
 func (ec *EventController) Run(ctx context.Context) {
 	log.Print("Starting event controller")
-	defer ec.eventsQueue.ShutDown()
+
+	// reload the pending events that were not handled before the last shutdown
+	if err := ec.reloadPendingEvents(); err != nil {
+		log.Printf("Failed to reload the pending events, %v", err)
+	}
+
+	// the handlers run with a context that is not cancelled with ctx, so that the events can still be published
+	// while draining, it's cancelled once the drain grace period expires.
+	handlerCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
 
 	// start a goroutine to handle the event from the event queue
-	go wait.Until(ec.runWorker, time.Second, ctx.Done())
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		ec.runWorker(handlerCtx)
+	}()
 
 	// wait until we're told to stop
 	<-ctx.Done()
 	log.Print("Shutting down event controller")
+
+	// stop accepting new events, the worker quits after the queue becomes empty
+	ec.eventsQueue.ShutDown()
+
+	select {
+	case <-drained:
+	case <-time.After(ec.drainGracePeriod):
+		log.Printf("Timed out draining the events after %v", ec.drainGracePeriod)
+		// cancel the in-flight handlers, the remaining events are reported as unpublished
+		cancel()
+		<-drained
+	}
+	// the events that are waiting to be retried are not handled after the queue is shut down
+	ec.addDelayedToUnpublished()
+
+	if unpublished := ec.Unpublished(); len(unpublished) > 0 {
+		log.Printf("Event controller is shut down with %d unpublished events: %v", len(unpublished), unpublished)
+		return
+	}
+	log.Print("Event controller is shut down with all events drained")
 }
 
-func (ec *EventController) runWorker() {
+func (ec *EventController) reloadPendingEvents() error {
+	pendingEvents, err := ec.eventStore.List()
+	if err != nil {
+		return err
+	}
+
+	for _, pending := range pendingEvents {
+		ec.priorityQueue.setPriority(pending.Event.key(), pending.Event.Priority)
+		ec.eventsQueue.Add(pending.Event.key())
+	}
+
+	if len(pendingEvents) > 0 {
+		log.Printf("Reloaded %d pending events", len(pendingEvents))
+	}
+	return nil
+}
+
+func (ec *EventController) runWorker(ctx context.Context) {
 	// hot loop until we're told to stop.
-	for ec.processNextEvent() {
+	for ec.processNextEvent(ctx) {
 	}
 }
 
-func (ec *EventController) processNextEvent() bool {
+func (ec *EventController) processNextEvent(ctx context.Context) bool {
 	key, quit := ec.eventsQueue.Get()
 	if quit {
 		// the current queue is shutdown and becomes empty, quit this process
 		return false
 	}
 	defer ec.eventsQueue.Done(key)
+	ec.removeDelayed(key.(Event))
+
+	event := key.(Event)
+	event.Priority = ec.priorityQueue.priority(event)
 
-	if err := ec.handleEvent(key.(Event)); err != nil {
-		log.Printf("Failed to handle the event %v, %v ", key, err)
+	if ctx.Err() != nil {
+		// the drain grace period is expired, give up the remaining events
+		ec.addUnpublished(event)
+		return true
+	}
+
+	if err := ec.handleEvent(ctx, event); err != nil {
+		var requeue *RequeueError
+		if errors.As(err, &requeue) {
+			if ec.eventsQueue.ShuttingDown() {
+				// the event cannot be requeued when the controller is shutting down
+				ec.addUnpublished(event)
+				return true
+			}
+
+			// handle the event again after the delay without counting an attempt
+			ec.addDelayed(event.key())
+			ec.eventsQueue.AddAfter(key, requeue.Delay)
+			return true
+		}
+
+		log.Printf("Failed to handle the event %v, %v ", event, err)
+
+		attempts, storeErr := ec.eventStore.IncAttempts(event)
+		if storeErr != nil {
+			log.Printf("Failed to record the attempts of the event %v, %v", event, storeErr)
+		}
+
+		if ec.eventsQueue.ShuttingDown() {
+			// the event cannot be requeued when the controller is shutting down
+			ec.addUnpublished(event)
+			return true
+		}
+
+		if ec.maxRetries > 0 && attempts > ec.maxRetries {
+			// give up the event and move it to the dead-letter queue
+			deadLetter := ec.deadLetterQueue.Add(event, attempts, err)
+			log.Printf("Moved the event %v to dead-letter queue as %s after %d attempts", event, deadLetter.ID, attempts)
+			ec.forget(event)
+			return true
+		}
 
 		// requeue the item to work on later
+		ec.addDelayed(event.key())
 		ec.eventsQueue.AddRateLimited(key)
 		return true
 	}
 
 	// handle the event successfully, forget it
-	ec.eventsQueue.Forget(key)
+	ec.forget(event)
 	return true
 }
 
-func (ec *EventController) handleEvent(event Event) error {
-	ctx := context.Background()
+func (ec *EventController) forget(event Event) {
+	ec.eventsQueue.Forget(event.key())
+
+	ec.storeLock.Lock()
+	defer ec.storeLock.Unlock()
+
+	// the event is added again while it's processing, it's kept in the event store until it's handled again
+	if ec.priorityQueue.requeued(event.key()) {
+		return
+	}
+	if err := ec.eventStore.Remove(event); err != nil {
+		log.Printf("Failed to remove the event %v from event store, %v", event, err)
+	}
+	ec.priorityQueue.forget(event.key())
+}
+
+func (ec *EventController) handleEvent(ctx context.Context, event Event) error {
 	handlers, found := ec.handlers[event.EventType]
 	if !found {
 		log.Printf("No handler functions found for '%s'\n", event.EventType)
 		return nil
 	}
 
-	for _, handler := range handlers {
-		err := handler(ctx, event.ID)
+	if ec.handlerTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ec.handlerTimeout)
+		defer cancel()
+	}
+
+	for _, h := range handlers {
+		err := ec.wrap(event.EventType, h.handler)(ctx, event.ID)
 		if err != nil {
-			return fmt.Errorf("error handing event %s, %s: %s", event.EventType, event.ID, err)
+			var requeue *RequeueError
+			if errors.As(err, &requeue) {
+				return err
+			}
+			if h.nonFatal {
+				log.Printf("Ignored the error of non-fatal handler for event %s, %s: %s", event.EventType, event.ID, err)
+				continue
+			}
+			return fmt.Errorf("error handing event %s, %s: %w", event.EventType, event.ID, err)
 		}
 	}
 
 	return nil
 }
+
+// wrap wraps the handler with the middlewares of the event type and then the middlewares of all event types.
+func (ec *EventController) wrap(eventType EventType, handler EventHandler) EventHandler {
+	middlewares := append(append([]Middleware{}, ec.middlewares...), ec.typeMiddlewares[eventType]...)
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](eventType, handler)
+	}
+	return handler
+}
@@ -0,0 +1,267 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunDrainsEventsOnShutdown(t *testing.T) {
+	options := NewEventControllerOptions()
+	ec := NewEventController(options)
+
+	release := make(chan struct{})
+	handled := make(chan string, 3)
+	ec.AddEventHandler(UpdateEvent, func(ctx context.Context, id string) error {
+		<-release
+		handled <- id
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		ec.Run(ctx)
+		close(stopped)
+	}()
+
+	for _, id := range []string{"r1", "r2", "r3"} {
+		ec.EnqueueEvent(Event{EventType: UpdateEvent, ID: id})
+	}
+	cancel()
+	// the events that are enqueued on shutdown are not accepted
+	if err := waitFor(ec.eventsQueue.ShuttingDown); err != nil {
+		t.Fatal(err)
+	}
+	rejected := Event{EventType: UpdateEvent, ID: "r4"}
+	ec.EnqueueEvent(rejected)
+	close(release)
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the controller is stopped after the events are drained")
+	}
+	if len(handled) != 3 {
+		t.Errorf("expected the queued events are drained, but %d are handled", len(handled))
+	}
+	if unpublished := ec.Unpublished(); !reflect.DeepEqual(unpublished, []Event{withPriority(rejected, NormalPriority)}) {
+		t.Errorf("expected the rejected event is unpublished, but got %v", unpublished)
+	}
+}
+
+func TestRunReportsEventsAfterGracePeriod(t *testing.T) {
+	options := NewEventControllerOptions()
+	options.DrainGracePeriod = 10 * time.Millisecond
+	options.HandlerTimeout = 0
+	ec := NewEventController(options)
+
+	started := make(chan struct{}, 1)
+	ec.AddEventHandler(UpdateEvent, func(ctx context.Context, id string) error {
+		started <- struct{}{}
+		// the in-flight handler is cancelled once the grace period is expired
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		ec.Run(ctx)
+		close(stopped)
+	}()
+
+	inFlight := Event{EventType: UpdateEvent, ID: "r1"}
+	queued := Event{EventType: UpdateEvent, ID: "r2"}
+	ec.EnqueueEvent(inFlight)
+	<-started
+	ec.EnqueueEvent(queued)
+	cancel()
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the controller is stopped after the grace period")
+	}
+	expected := map[string]bool{"r1": true, "r2": true}
+	unpublished := ec.Unpublished()
+	if len(unpublished) != len(expected) {
+		t.Fatalf("expected the in-flight and queued events are unpublished, but got %v", unpublished)
+	}
+	for _, event := range unpublished {
+		if !expected[event.ID] {
+			t.Errorf("unexpected unpublished event %v", event)
+		}
+	}
+}
+
+func TestRunReportsDelayedEvents(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+	}{
+		{
+			name: "requeued",
+			err:  &RequeueError{Delay: time.Hour, Reason: "rate limited"},
+		},
+		{
+			name: "failed",
+			err:  fmt.Errorf("failed to publish"),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			options := NewEventControllerOptions()
+			ec := NewEventController(options)
+
+			handled := make(chan struct{}, 10)
+			ec.AddEventHandler(DeleteEvent, func(ctx context.Context, id string) error {
+				handled <- struct{}{}
+				return c.err
+			})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			stopped := make(chan struct{})
+			go func() {
+				ec.Run(ctx)
+				close(stopped)
+			}()
+
+			event := Event{EventType: DeleteEvent, ID: "r1"}
+			ec.EnqueueEvent(event)
+			<-handled
+			// the event is waiting in the delaying queue to be retried
+			if err := waitFor(func() bool {
+				ec.Lock()
+				defer ec.Unlock()
+				return len(ec.delayed) == 1
+			}); err != nil {
+				t.Fatal(err)
+			}
+			cancel()
+			<-stopped
+
+			if unpublished := ec.Unpublished(); !reflect.DeepEqual(unpublished, []Event{withPriority(event, HighPriority)}) {
+				t.Errorf("expected the delayed event is unpublished, but got %v", unpublished)
+			}
+		})
+	}
+}
+
+func TestHandlerTimeout(t *testing.T) {
+	options := NewEventControllerOptions()
+	options.HandlerTimeout = 10 * time.Millisecond
+	ec := NewEventController(options)
+
+	handlerErrs := make(chan error, 1)
+	ec.AddEventHandler(CreateEvent, func(ctx context.Context, id string) error {
+		<-ctx.Done()
+		select {
+		case handlerErrs <- ctx.Err():
+		default:
+		}
+		return ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go ec.Run(ctx)
+
+	ec.EnqueueEvent(Event{EventType: CreateEvent, ID: "r1"})
+	select {
+	case err := <-handlerErrs:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected the handler is timed out, but got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the handler is timed out")
+	}
+
+	// the timed out event is retried as a failed attempt
+	if err := waitFor(func() bool {
+		pending, _ := ec.eventStore.List()
+		return len(pending) == 1 && pending[0].Attempts >= 1
+	}); err != nil {
+		t.Errorf("expected the timed out event counts as an attempt")
+	}
+}
+
+func TestDeadLetterAfterMaxRetries(t *testing.T) {
+	eventStore := NewMemoryEventStore()
+	options := NewEventControllerOptions()
+	options.MaxRetries = 2
+	options.EventStore = eventStore
+	ec := NewEventController(options)
+
+	var lock sync.Mutex
+	calls, failing := 0, true
+	ec.AddEventHandler(UpdateEvent, func(ctx context.Context, id string) error {
+		lock.Lock()
+		defer lock.Unlock()
+		calls++
+		if failing {
+			return fmt.Errorf("failed to publish")
+		}
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go ec.Run(ctx)
+
+	event := Event{EventType: UpdateEvent, ID: "r1"}
+	ec.EnqueueEvent(event)
+	if err := waitFor(func() bool { return len(ec.DeadLetters().List()) == 1 }); err != nil {
+		t.Fatalf("expected the event is dead-lettered after the max retries")
+	}
+
+	// the event is attempted once and retried max retries times, then it's not retried any more
+	deadLetter := ec.DeadLetters().List()[0]
+	if deadLetter.Event.ID != event.ID || deadLetter.Attempts != 3 || !strings.Contains(deadLetter.Error, "failed to publish") {
+		t.Errorf("unexpected dead letter %+v", deadLetter)
+	}
+	lock.Lock()
+	if calls != 3 {
+		t.Errorf("expected the event is handled 3 times, but got %d", calls)
+	}
+	failing = false
+	lock.Unlock()
+	if pending, _ := eventStore.List(); len(pending) != 0 {
+		t.Errorf("expected the dead-lettered event is not pending, but got %v", pending)
+	}
+
+	// the retried event is enqueued again and removed from the dead-letter queue
+	if _, err := ec.RetryDeadLetter(deadLetter.ID); err != nil {
+		t.Fatal(err)
+	}
+	if len(ec.DeadLetters().List()) != 0 {
+		t.Errorf("expected the retried dead letter is removed")
+	}
+	if err := waitFor(func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return calls == 4
+	}); err != nil {
+		t.Fatalf("expected the retried event is handled again")
+	}
+	if err := waitFor(func() bool {
+		pending, _ := eventStore.List()
+		return len(pending) == 0
+	}); err != nil {
+		t.Errorf("expected the retried event is handled successfully")
+	}
+	if _, err := ec.RetryDeadLetter(deadLetter.ID); err == nil {
+		t.Errorf("expected the retried dead letter can't be retried again")
+	}
+}
+
+func withPriority(event Event, priority EventPriority) Event {
+	event.Priority = priority
+	return event
+}
@@ -0,0 +1,223 @@
+package source
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/morvencao/event-based-transport-demo/pkg/store"
+)
+
+// PendingEvent is an event that is enqueued but not handled yet.
+type PendingEvent struct {
+	Event      Event     `json:"event"`
+	Attempts   int       `json:"attempts"`
+	EnqueuedAt time.Time `json:"enqueuedAt"`
+}
+
+// EventStore records the pending events of the EventController with their attempt counts. The events are keyed by
+// their types and IDs, an event that's added with different priorities is pending once with the highest of them.
+type EventStore interface {
+	// Add records a pending event, the attempt count is kept and the priority is raised if the event is already
+	// pending
+	Add(event Event) error
+	// IncAttempts increases the attempt count of a pending event and returns the new attempt count
+	IncAttempts(event Event) (int, error)
+	// Remove removes a pending event from the store
+	Remove(event Event) error
+	// List lists all pending events, the earliest enqueued event comes first
+	List() ([]*PendingEvent, error)
+}
+
+var _ EventStore = &MemoryEventStore{}
+var _ EventStore = &FileEventStore{}
+
+// MemoryEventStore keeps the pending events in memory, they are lost when the source restarts.
+type MemoryEventStore struct {
+	sync.RWMutex
+
+	events map[Event]*PendingEvent
+}
+
+func NewMemoryEventStore() *MemoryEventStore {
+	return &MemoryEventStore{
+		events: make(map[Event]*PendingEvent),
+	}
+}
+
+func (s *MemoryEventStore) Add(event Event) error {
+	s.Lock()
+	defer s.Unlock()
+
+	pending, ok := s.events[event.key()]
+	if !ok {
+		s.events[event.key()] = &PendingEvent{Event: event, EnqueuedAt: time.Now()}
+		return nil
+	}
+	if event.Priority.higherThan(pending.Event.Priority) {
+		pending.Event.Priority = event.Priority
+	}
+	return nil
+}
+
+func (s *MemoryEventStore) IncAttempts(event Event) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	pending, ok := s.events[event.key()]
+	if !ok {
+		pending = &PendingEvent{Event: event, EnqueuedAt: time.Now()}
+		s.events[event.key()] = pending
+	}
+
+	pending.Attempts = pending.Attempts + 1
+	return pending.Attempts, nil
+}
+
+func (s *MemoryEventStore) Remove(event Event) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.events, event.key())
+	return nil
+}
+
+func (s *MemoryEventStore) List() ([]*PendingEvent, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	events := []*PendingEvent{}
+	for _, pending := range s.events {
+		events = append(events, &PendingEvent{
+			Event:      pending.Event,
+			Attempts:   pending.Attempts,
+			EnqueuedAt: pending.EnqueuedAt,
+		})
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].EnqueuedAt.Before(events[j].EnqueuedAt)
+	})
+	return events, nil
+}
+
+// eventRecord is a journal record of the latest state of a pending event, the pending event is nil if it's removed.
+type eventRecord struct {
+	Event   Event         `json:"event"`
+	Pending *PendingEvent `json:"pending,omitempty"`
+}
+
+// FileEventStore keeps the pending events in memory and records their changes in a journal file, so that the
+// pending events can be reloaded when the source restarts.
+type FileEventStore struct {
+	*MemoryEventStore
+
+	// serializes the changes with the journal records
+	journalLock sync.Mutex
+	journal     *store.Journal
+}
+
+// NewFileEventStore returns a FileEventStore that records the pending events in the given journal file. The pending
+// events are loaded from the file if it exists.
+func NewFileEventStore(path string) (*FileEventStore, error) {
+	s := &FileEventStore{
+		MemoryEventStore: NewMemoryEventStore(),
+	}
+
+	journal, err := store.OpenJournal(path, func(data []byte) error {
+		record := &eventRecord{}
+		if err := json.Unmarshal(data, record); err != nil {
+			return err
+		}
+		if record.Pending == nil {
+			delete(s.events, record.Event.key())
+			return nil
+		}
+		s.events[record.Event.key()] = record.Pending
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load event store, %v", err)
+	}
+	s.journal = journal
+
+	return s, nil
+}
+
+func (s *FileEventStore) Add(event Event) error {
+	s.journalLock.Lock()
+	defer s.journalLock.Unlock()
+
+	last := s.pending(event)
+	if err := s.MemoryEventStore.Add(event); err != nil {
+		return err
+	}
+	if last != nil && *last == *s.pending(event) {
+		// the event is already recorded
+		return nil
+	}
+	return s.record(event)
+}
+
+func (s *FileEventStore) IncAttempts(event Event) (int, error) {
+	s.journalLock.Lock()
+	defer s.journalLock.Unlock()
+
+	attempts, err := s.MemoryEventStore.IncAttempts(event)
+	if err != nil {
+		return 0, err
+	}
+	return attempts, s.record(event)
+}
+
+func (s *FileEventStore) Remove(event Event) error {
+	s.journalLock.Lock()
+	defer s.journalLock.Unlock()
+
+	if s.pending(event) == nil {
+		return nil
+	}
+	if err := s.MemoryEventStore.Remove(event); err != nil {
+		return err
+	}
+	return s.record(event)
+}
+
+// record appends the latest state of the pending event to the journal, and compacts the journal to the current
+// pending events once it has grown well beyond them.
+func (s *FileEventStore) record(event Event) error {
+	if err := s.journal.Append(&eventRecord{Event: event.key(), Pending: s.pending(event)}); err != nil {
+		return err
+	}
+
+	s.RLock()
+	live := len(s.events)
+	s.RUnlock()
+	if !s.journal.NeedsCompaction(live) {
+		return nil
+	}
+
+	events, err := s.MemoryEventStore.List()
+	if err != nil {
+		return err
+	}
+	snapshot := []interface{}{}
+	for _, pending := range events {
+		snapshot = append(snapshot, &eventRecord{Event: pending.Event.key(), Pending: pending})
+	}
+	return s.journal.Compact(snapshot)
+}
+
+// pending returns a copy of the pending event, it's nil if the event is not pending.
+func (s *FileEventStore) pending(event Event) *PendingEvent {
+	s.RLock()
+	defer s.RUnlock()
+
+	pending, ok := s.events[event.key()]
+	if !ok {
+		return nil
+	}
+	copied := *pending
+	return &copied
+}
@@ -0,0 +1,106 @@
+package source
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileEventStoreReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events")
+
+	s, err := NewFileEventStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := Event{EventType: CreateEvent, ID: "r1"}
+	updated := Event{EventType: UpdateEvent, ID: "r2"}
+	deleted := Event{EventType: DeleteEvent, ID: "r3"}
+	for _, event := range []Event{created, updated, deleted} {
+		if err := s.Add(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := s.IncAttempts(updated); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Remove(deleted); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewFileEventStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending, err := reloaded.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 2 {
+		t.Fatalf("expected 2 pending events, but got %d", len(pending))
+	}
+	if pending[0].Event != created || pending[1].Event != updated {
+		t.Errorf("expected pending events %v and %v, but got %v and %v", created, updated, pending[0].Event, pending[1].Event)
+	}
+	if pending[1].Attempts != 2 {
+		t.Errorf("expected 2 attempts, but got %d", pending[1].Attempts)
+	}
+}
+
+func TestForgetKeepsRequeuedEvent(t *testing.T) {
+	eventStore := NewMemoryEventStore()
+	options := NewEventControllerOptions()
+	options.EventStore = eventStore
+	ec := NewEventController(options)
+
+	event := Event{EventType: UpdateEvent, ID: "r1"}
+	handled := make(chan struct{})
+	release := make(chan struct{})
+	ec.AddEventHandler(UpdateEvent, func(ctx context.Context, id string) error {
+		handled <- struct{}{}
+		<-release
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go ec.Run(ctx)
+
+	ec.EnqueueEvent(event)
+	<-handled
+	// the event is updated again while its first update is published
+	ec.EnqueueEvent(event)
+	release <- struct{}{}
+
+	// the event is handled again, so it must still be pending in the event store
+	<-handled
+	pending, _ := eventStore.List()
+	if len(pending) != 1 {
+		t.Errorf("expected the requeued event is pending, but got %v", pending)
+	}
+	release <- struct{}{}
+
+	if err := waitFor(func() bool {
+		pending, _ := eventStore.List()
+		return len(pending) == 0
+	}); err != nil {
+		t.Errorf("expected the handled event is removed from the event store")
+	}
+}
+
+// waitFor polls the condition until it's true or times out.
+func waitFor(condition func() bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for !condition() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	return nil
+}
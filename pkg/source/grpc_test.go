@@ -0,0 +1,92 @@
+package source
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/morvencao/event-based-transport-demo/pkg/api"
+	"github.com/morvencao/event-based-transport-demo/pkg/fakeagent"
+	"github.com/morvencao/event-based-transport-demo/pkg/store"
+	"github.com/morvencao/event-based-transport-demo/pkg/transport"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	workv1 "open-cluster-management.io/api/work/v1"
+
+	sdkgrpc "open-cluster-management.io/sdk-go/pkg/cloudevents/generic/options/grpc"
+)
+
+func TestGRPCBrokerEndToEnd(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	broker := transport.NewGRPCBroker()
+	go broker.Serve(ctx, lis)
+
+	grpcOptions := transport.NewGRPCOptions()
+	grpcOptions.Address = lis.Addr().String()
+	resourceStore := store.NewMemoryStore()
+	client, err := StartResourceSourceClient(ctx, transport.NewGRPCSourceOptions(grpcOptions, "source"), resourceStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent, err := fakeagent.StartFakeAgent(ctx,
+		sdkgrpc.NewAgentOptions(&sdkgrpc.GRPCOptions{URL: lis.Addr().String()}, "cluster1", "cluster1-agent"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resource := newTestResource("source", "cluster1", "nginx")
+	resourceStore.Add(resource)
+
+	// the source publishes the spec through the broker, it's received by the agent of the cluster
+	if err := waitFor(func() bool {
+		if client.ConnectionStates()[DefaultTransport] != ConnectionStateConnected {
+			return false
+		}
+		if err := client.OnCreate(ctx, resource.ResourceID); err != nil {
+			t.Logf("failed to publish the resource, %v", err)
+			return false
+		}
+		_, ok := agent.Get(resource.ResourceID)
+		return ok
+	}); err != nil {
+		t.Fatalf("expected the resource is received by the agent")
+	}
+
+	// the status is sent back through the broker
+	if err := waitFor(func() bool {
+		last, err := resourceStore.Get(resource.ResourceID)
+		if err != nil || last.Status == nil {
+			return false
+		}
+		return meta.IsStatusConditionTrue(last.Status.ReconcileStatus.Conditions, workv1.WorkApplied)
+	}); err != nil {
+		t.Errorf("expected the applied status is received by the source")
+	}
+}
+
+// newTestResource returns a deployment resource of the cluster.
+func newTestResource(source, clusterName, name string) *api.Resource {
+	return &api.Resource{
+		Source:          source,
+		ClusterName:     clusterName,
+		ResourceID:      api.ResourceID(clusterName, name),
+		ResourceVersion: 1,
+		Spec: &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": "default",
+			},
+			"spec": map[string]interface{}{
+				"replicas": int64(1),
+			},
+		}},
+	}
+}
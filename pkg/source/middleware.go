@@ -0,0 +1,160 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
+)
+
+// Middleware wraps the handler of the given event type to add cross-cutting behavior around it.
+type Middleware func(eventType EventType, next EventHandler) EventHandler
+
+// LoggingMiddleware logs the duration of each successful handler call.
+func LoggingMiddleware() Middleware {
+	return func(eventType EventType, next EventHandler) EventHandler {
+		return func(ctx context.Context, id string) error {
+			start := time.Now()
+			if err := next(ctx, id); err != nil {
+				// the error is logged by the event controller
+				return err
+			}
+			log.Printf("Handled the event %s, %s in %v", eventType, id, time.Since(start))
+			return nil
+		}
+	}
+}
+
+// RecoveryMiddleware converts a panic in the handler into an error, so that the event is retried rather than
+// crashing the worker.
+func RecoveryMiddleware() Middleware {
+	return func(eventType EventType, next EventHandler) EventHandler {
+		return func(ctx context.Context, id string) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("Recovered from panic handling the event %s, %s: %v\n%s", eventType, id, r, debug.Stack())
+					err = fmt.Errorf("panic handling the event: %v", r)
+				}
+			}()
+			return next(ctx, id)
+		}
+	}
+}
+
+// SkipMiddleware skips the handler if the skip function returns true for the event.
+func SkipMiddleware(skip func(eventType EventType, id string) bool) Middleware {
+	return func(eventType EventType, next EventHandler) EventHandler {
+		return func(ctx context.Context, id string) error {
+			if skip(eventType, id) {
+				return nil
+			}
+			return next(ctx, id)
+		}
+	}
+}
+
+// ClusterRateLimitMiddleware limits the rate of the handler calls per cluster, the clusterName function resolves
+// the cluster name of an event's resource. A throttled event is requeued with a RequeueError instead of blocking the
+// worker, so the events of the other clusters are not held up by it.
+func ClusterRateLimitMiddleware(clusterName func(id string) (string, error), qps float32, burst int) Middleware {
+	var lock sync.Mutex
+	rateLimiters := make(map[string]*rate.Limiter)
+	if burst < 1 {
+		// a token bucket without burst never allows an event
+		burst = 1
+	}
+
+	rateLimiter := func(cluster string) *rate.Limiter {
+		lock.Lock()
+		defer lock.Unlock()
+
+		limiter, ok := rateLimiters[cluster]
+		if !ok {
+			limiter = rate.NewLimiter(rate.Limit(qps), burst)
+			rateLimiters[cluster] = limiter
+		}
+		return limiter
+	}
+
+	return func(eventType EventType, next EventHandler) EventHandler {
+		return func(ctx context.Context, id string) error {
+			cluster, err := clusterName(id)
+			if err != nil {
+				return err
+			}
+
+			reservation := rateLimiter(cluster).Reserve()
+			if delay := reservation.Delay(); delay > 0 {
+				// give the token back, the event takes a token when it's handled again
+				reservation.Cancel()
+				return &RequeueError{
+					Delay:  delay,
+					Reason: fmt.Sprintf("cluster %s is rate limited", cluster),
+				}
+			}
+			return next(ctx, id)
+		}
+	}
+}
+
+// MetricsMiddleware records the count and the duration of the handler calls with the prometheus metrics that are
+// registered to the given registerer.
+func MetricsMiddleware(registerer prometheus.Registerer) Middleware {
+	handledTotal := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "source_event_handled_total",
+		Help: "Number of the event handler calls by event type and result.",
+	}, []string{"event_type", "result"})
+	handleDuration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "source_event_handle_duration_seconds",
+		Help:    "Duration of the event handler calls by event type.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"event_type"})
+	registerer.MustRegister(handledTotal, handleDuration)
+
+	return func(eventType EventType, next EventHandler) EventHandler {
+		return func(ctx context.Context, id string) error {
+			start := time.Now()
+			err := next(ctx, id)
+			handleDuration.WithLabelValues(string(eventType)).Observe(time.Since(start).Seconds())
+
+			result := "success"
+			var requeue *RequeueError
+			if errors.As(err, &requeue) {
+				result = "requeued"
+			} else if err != nil {
+				result = "error"
+			}
+			handledTotal.WithLabelValues(string(eventType), result).Inc()
+			return err
+		}
+	}
+}
+
+// TracingMiddleware starts a span with the given tracer for each handler call.
+func TracingMiddleware(tracer trace.Tracer) Middleware {
+	return func(eventType EventType, next EventHandler) EventHandler {
+		return func(ctx context.Context, id string) error {
+			ctx, span := tracer.Start(ctx, fmt.Sprintf("handle %s", eventType), trace.WithAttributes(
+				attribute.String("event.type", string(eventType)),
+				attribute.String("event.id", id),
+			))
+			defer span.End()
+
+			err := next(ctx, id)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClusterRateLimitMiddleware(t *testing.T) {
+	eventStore := NewMemoryEventStore()
+	options := NewEventControllerOptions()
+	options.EventStore = eventStore
+	ec := NewEventController(options)
+
+	clusters := map[string]string{"r1": "cluster1", "r2": "cluster1", "r3": "cluster2"}
+	ec.Use(ClusterRateLimitMiddleware(func(id string) (string, error) {
+		cluster, ok := clusters[id]
+		if !ok {
+			return "", fmt.Errorf("failed to find resource %s", id)
+		}
+		return cluster, nil
+	}, 2, 1))
+
+	var lock sync.Mutex
+	var handled []string
+	ec.AddEventHandler(UpdateEvent, func(ctx context.Context, id string) error {
+		lock.Lock()
+		defer lock.Unlock()
+		handled = append(handled, id)
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go ec.Run(ctx)
+
+	for _, id := range []string{"r1", "r2", "r3"} {
+		ec.EnqueueEvent(Event{EventType: UpdateEvent, ID: id})
+	}
+
+	if err := waitFor(func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(handled) == 3
+	}); err != nil {
+		t.Fatalf("expected all events are handled, but got %v", handled)
+	}
+
+	// the second event of cluster1 is throttled, and it doesn't hold up the event of cluster2
+	if !reflect.DeepEqual(handled, []string{"r1", "r3", "r2"}) && !reflect.DeepEqual(handled, []string{"r3", "r1", "r2"}) {
+		t.Errorf("expected the throttled event of cluster1 is handled last, but got %v", handled)
+	}
+
+	// the throttled event is not counted as a failed attempt
+	if deadLetters := ec.DeadLetters().List(); len(deadLetters) != 0 {
+		t.Errorf("expected no dead letters, but got %v", deadLetters)
+	}
+	if err := waitFor(func() bool {
+		pending, _ := eventStore.List()
+		return len(pending) == 0
+	}); err != nil {
+		pending, _ := eventStore.List()
+		t.Errorf("expected no pending events, but got %v", pending)
+	}
+}
+
+func TestHandleEventRequeuesWithoutAttempt(t *testing.T) {
+	eventStore := NewMemoryEventStore()
+	options := NewEventControllerOptions()
+	options.EventStore = eventStore
+	options.MaxRetries = 1
+	ec := NewEventController(options)
+
+	var lock sync.Mutex
+	calls := 0
+	ec.AddEventHandler(UpdateEvent, func(ctx context.Context, id string) error {
+		lock.Lock()
+		defer lock.Unlock()
+		calls++
+		if calls <= 3 {
+			return &RequeueError{Delay: 10 * time.Millisecond, Reason: "not ready"}
+		}
+		return nil
+	}, NonFatal())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go ec.Run(ctx)
+
+	ec.EnqueueEvent(Event{EventType: UpdateEvent, ID: "r1"})
+	if err := waitFor(func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return calls == 4
+	}); err != nil {
+		t.Fatalf("expected the event is handled after it's requeued 3 times, but it's called %d times", calls)
+	}
+	if deadLetters := ec.DeadLetters().List(); len(deadLetters) != 0 {
+		t.Errorf("expected the requeued event is not dead-lettered, but got %v", deadLetters)
+	}
+}
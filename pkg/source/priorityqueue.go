@@ -0,0 +1,317 @@
+package source
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+type EventPriority string
+
+const (
+	HighPriority   EventPriority = "high"
+	NormalPriority EventPriority = "normal"
+	LowPriority    EventPriority = "low"
+)
+
+// priorities lists the event priorities from the highest to the lowest
+var priorities = []EventPriority{HighPriority, NormalPriority, LowPriority}
+
+// ParseEventPriority parses the event priority from a string.
+func ParseEventPriority(priority string) (EventPriority, error) {
+	for _, p := range priorities {
+		if string(p) == priority {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported event priority %q, it should be one of %v", priority, priorities)
+}
+
+// higherThan returns true if the priority is higher than the other priority, an unknown priority is the normal
+// priority.
+func (p EventPriority) higherThan(other EventPriority) bool {
+	return p.rank() < other.rank()
+}
+
+func (p EventPriority) rank() int {
+	for i, priority := range priorities {
+		if p == priority {
+			return i
+		}
+	}
+	return 1
+}
+
+// unfinishedWorkUpdatePeriod is how often the unfinished work metrics are updated.
+const unfinishedWorkUpdatePeriod = 500 * time.Millisecond
+
+// priorityQueue is a workqueue that holds one FIFO lane per event priority. It serves the lanes with weighted
+// round-robin: in each round, a lane is served at most its weight times before the lower lanes, and the round
+// restarts once no non-empty lane has weight left, so the higher lanes go first but the lower lanes are not starved.
+// The priority isn't a part of the queued event, it's kept in a side map by the event, so an event that's added with
+// different priorities is queued once with the highest of them.
+// Like the workqueue, an event is never processed in parallel, and an event added while it's processing is queued
+// again after it's done. It's wrapped by the workqueue rate limiting queue for the delayed and rate limited adds.
+type priorityQueue struct {
+	cond *sync.Cond
+
+	lanes      map[EventPriority][]Event
+	weights    map[EventPriority]int
+	credits    map[EventPriority]int
+	priorities map[Event]EventPriority
+	dirty      map[Event]struct{}
+	processing map[Event]struct{}
+	metrics    *queueMetrics
+
+	shuttingDown bool
+	drain        bool
+}
+
+var _ workqueue.Interface = &priorityQueue{}
+
+func newPriorityQueue(name string, weights map[EventPriority]int, metricsProvider workqueue.MetricsProvider) *priorityQueue {
+	q := &priorityQueue{
+		cond:       sync.NewCond(&sync.Mutex{}),
+		lanes:      make(map[EventPriority][]Event),
+		weights:    make(map[EventPriority]int),
+		credits:    make(map[EventPriority]int),
+		priorities: make(map[Event]EventPriority),
+		dirty:      make(map[Event]struct{}),
+		processing: make(map[Event]struct{}),
+		metrics:    newQueueMetrics(name, metricsProvider),
+	}
+
+	for _, priority := range priorities {
+		// each lane is served at least once in a round
+		q.weights[priority] = 1
+		if weight, ok := weights[priority]; ok && weight > 1 {
+			q.weights[priority] = weight
+		}
+		q.credits[priority] = q.weights[priority]
+	}
+
+	if q.metrics != nil {
+		go q.updateUnfinishedWorkLoop()
+	}
+
+	return q
+}
+
+// setPriority sets the priority of the event if it's higher than its current priority, the event is moved to the
+// lane of the priority if it's queued.
+func (q *priorityQueue) setPriority(event Event, priority EventPriority) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+
+	current, ok := q.priorities[event]
+	if ok && !priority.higherThan(current) {
+		return
+	}
+	q.priorities[event] = priority
+
+	_, dirty := q.dirty[event]
+	_, processing := q.processing[event]
+	if dirty && !processing {
+		q.remove(event, current)
+		q.push(event)
+	}
+}
+
+// priority returns the priority of the event.
+func (q *priorityQueue) priority(event Event) EventPriority {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+
+	if priority, ok := q.priorities[event]; ok {
+		return priority
+	}
+	return NormalPriority
+}
+
+// forget removes the priority of the event once it's handled or given up.
+func (q *priorityQueue) forget(event Event) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+
+	if _, ok := q.dirty[event]; ok {
+		return
+	}
+	delete(q.priorities, event)
+}
+
+func (q *priorityQueue) Add(item interface{}) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+
+	if q.shuttingDown {
+		return
+	}
+
+	event := item.(Event)
+	if _, ok := q.dirty[event]; ok {
+		return
+	}
+
+	q.metrics.add(event)
+	q.dirty[event] = struct{}{}
+	if _, ok := q.processing[event]; ok {
+		return
+	}
+
+	q.push(event)
+	q.cond.Signal()
+}
+
+func (q *priorityQueue) Len() int {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+
+	length := 0
+	for _, lane := range q.lanes {
+		length = length + len(lane)
+	}
+	return length
+}
+
+func (q *priorityQueue) Get() (interface{}, bool) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+
+	for q.empty() && !q.shuttingDown {
+		q.cond.Wait()
+	}
+	if q.empty() {
+		// we must be shutting down
+		return nil, true
+	}
+
+	event := q.pop()
+	q.metrics.get(event)
+	q.processing[event] = struct{}{}
+	delete(q.dirty, event)
+
+	return event, false
+}
+
+func (q *priorityQueue) Done(item interface{}) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+
+	event := item.(Event)
+	q.metrics.done(event)
+	delete(q.processing, event)
+	if _, ok := q.dirty[event]; ok {
+		q.push(event)
+		q.cond.Signal()
+	} else if len(q.processing) == 0 {
+		q.cond.Signal()
+	}
+}
+
+// requeued returns true if the event is added again while it's processing, it's queued again once it's done.
+func (q *priorityQueue) requeued(event Event) bool {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+
+	_, processing := q.processing[event]
+	_, dirty := q.dirty[event]
+	return processing && dirty
+}
+
+func (q *priorityQueue) ShutDown() {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+
+	q.drain = false
+	q.shuttingDown = true
+	q.cond.Broadcast()
+}
+
+func (q *priorityQueue) ShutDownWithDrain() {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+
+	q.drain = true
+	q.shuttingDown = true
+	q.cond.Broadcast()
+
+	for len(q.processing) != 0 && q.drain {
+		q.cond.Wait()
+	}
+}
+
+func (q *priorityQueue) ShuttingDown() bool {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+
+	return q.shuttingDown
+}
+
+func (q *priorityQueue) empty() bool {
+	for _, lane := range q.lanes {
+		if len(lane) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (q *priorityQueue) push(event Event) {
+	priority, ok := q.priorities[event]
+	if _, known := q.weights[priority]; !ok || !known {
+		priority = NormalPriority
+	}
+	q.lanes[priority] = append(q.lanes[priority], event)
+}
+
+// remove removes the queued event from the lane of the priority.
+func (q *priorityQueue) remove(event Event, priority EventPriority) {
+	if _, ok := q.weights[priority]; !ok {
+		priority = NormalPriority
+	}
+	lane := q.lanes[priority]
+	for i := range lane {
+		if lane[i] == event {
+			q.lanes[priority] = append(lane[:i:i], lane[i+1:]...)
+			return
+		}
+	}
+}
+
+// pop takes the next event from the highest non-empty lane that still has credits in the current round, the
+// caller must ensure the queue is not empty.
+func (q *priorityQueue) pop() Event {
+	for {
+		for _, priority := range priorities {
+			lane := q.lanes[priority]
+			if len(lane) == 0 || q.credits[priority] == 0 {
+				continue
+			}
+
+			q.credits[priority] = q.credits[priority] - 1
+			q.lanes[priority] = lane[1:]
+			return lane[0]
+		}
+
+		// every non-empty lane has used up its credits, start a new round
+		for _, priority := range priorities {
+			q.credits[priority] = q.weights[priority]
+		}
+	}
+}
+
+func (q *priorityQueue) updateUnfinishedWorkLoop() {
+	ticker := time.NewTicker(unfinishedWorkUpdatePeriod)
+	defer ticker.Stop()
+	for range ticker.C {
+		q.cond.L.Lock()
+		if q.shuttingDown {
+			q.cond.L.Unlock()
+			return
+		}
+		q.metrics.updateUnfinishedWork()
+		q.cond.L.Unlock()
+	}
+}
@@ -0,0 +1,156 @@
+package source
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPriorityQueueWeightedRoundRobin(t *testing.T) {
+	q := newPriorityQueue("test", map[EventPriority]int{HighPriority: 2, NormalPriority: 1, LowPriority: 1}, nil)
+	add := func(id string, priority EventPriority) {
+		event := Event{EventType: UpdateEvent, ID: id}
+		q.setPriority(event, priority)
+		q.Add(event)
+	}
+	for _, id := range []string{"h1", "h2", "h3", "h4"} {
+		add(id, HighPriority)
+	}
+	add("n1", NormalPriority)
+	add("n2", NormalPriority)
+	add("l1", LowPriority)
+
+	order := []string{}
+	for q.Len() > 0 {
+		item, _ := q.Get()
+		order = append(order, item.(Event).ID)
+		q.Done(item)
+	}
+
+	expected := []string{"h1", "h2", "n1", "l1", "h3", "h4", "n2"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("expected order %v, but got %v", expected, order)
+	}
+}
+
+func TestPriorityQueueDeduplicatesPriorities(t *testing.T) {
+	q := newPriorityQueue("test", nil, nil)
+	normal := Event{EventType: UpdateEvent, ID: "n1"}
+	event := Event{EventType: UpdateEvent, ID: "r1"}
+
+	q.setPriority(normal, NormalPriority)
+	q.Add(normal)
+	q.setPriority(event, LowPriority)
+	q.Add(event)
+	// the event is raised to the high priority while it's queued
+	q.setPriority(event, HighPriority)
+	q.Add(event)
+	// a lower priority doesn't lower it again
+	q.setPriority(event, NormalPriority)
+	q.Add(event)
+
+	if q.Len() != 2 {
+		t.Fatalf("expected 2 queued events, but got %d", q.Len())
+	}
+	item, _ := q.Get()
+	if item.(Event) != event {
+		t.Errorf("expected the raised event %v first, but got %v", event, item)
+	}
+	if priority := q.priority(event); priority != HighPriority {
+		t.Errorf("expected high priority, but got %s", priority)
+	}
+}
+
+func TestEventControllerHandlesEventOnceAcrossPriorities(t *testing.T) {
+	options := NewEventControllerOptions()
+	options.MetricsProvider = NewQueueMetricsProvider(prometheus.NewRegistry())
+	ec := NewEventController(options)
+
+	var lock sync.Mutex
+	handled := []Event{}
+	block := make(chan struct{})
+	ec.AddEventHandler(UpdateEvent, func(ctx context.Context, id string) error {
+		<-block
+		lock.Lock()
+		defer lock.Unlock()
+		handled = append(handled, Event{EventType: UpdateEvent, ID: id})
+		return nil
+	})
+
+	// the same update is enqueued with different priorities before it's handled
+	ec.EnqueueEvent(Event{EventType: UpdateEvent, ID: "r1", Priority: LowPriority})
+	ec.EnqueueEvent(Event{EventType: UpdateEvent, ID: "r1", Priority: HighPriority})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go ec.Run(ctx)
+	close(block)
+
+	if err := waitFor(func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(handled) == 1 && ec.eventsQueue.Len() == 0
+	}); err != nil {
+		t.Fatalf("expected the event is handled, but got %v", handled)
+	}
+
+	pending, _ := ec.eventStore.List()
+	if len(pending) != 0 {
+		t.Errorf("expected no pending events, but got %v", pending)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if len(handled) != 1 {
+		t.Errorf("expected the event is handled once, but got %v", handled)
+	}
+}
+
+func TestEventControllerQueueMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	options := NewEventControllerOptions()
+	options.MetricsProvider = NewQueueMetricsProvider(registry)
+	ec := NewEventController(options)
+
+	var failed atomic.Bool
+	ec.AddEventHandler(UpdateEvent, func(ctx context.Context, id string) error {
+		if failed.CompareAndSwap(false, true) {
+			return context.DeadlineExceeded
+		}
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go ec.Run(ctx)
+
+	ec.EnqueueEvent(Event{EventType: UpdateEvent, ID: "r1"})
+	if err := waitFor(func() bool {
+		pending, _ := ec.eventStore.List()
+		return failed.Load() && len(pending) == 0
+	}); err != nil {
+		t.Fatalf("expected the event is handled after it's retried")
+	}
+
+	expected := `
+# HELP workqueue_adds_total Total number of adds handled by workqueue
+# TYPE workqueue_adds_total counter
+workqueue_adds_total{name="events"} 2
+# HELP workqueue_depth Current depth of workqueue
+# TYPE workqueue_depth gauge
+workqueue_depth{name="events"} 0
+# HELP workqueue_retries_total Total number of retries handled by workqueue
+# TYPE workqueue_retries_total counter
+workqueue_retries_total{name="events"} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"workqueue_adds_total", "workqueue_depth", "workqueue_retries_total"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,127 @@
+package source
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/google/uuid"
+	"github.com/morvencao/event-based-transport-demo/pkg/api"
+
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic"
+)
+
+// QuarantinedEvent records a received event that can't be decoded, the event is kept as it's received so that the
+// mismatch between the agent and the codec can be debugged.
+type QuarantinedEvent struct {
+	ID            string            `json:"id"`
+	Event         cloudevents.Event `json:"event"`
+	Error         string            `json:"error"`
+	QuarantinedAt time.Time         `json:"quarantinedAt"`
+}
+
+// Quarantine keeps the events that fail to be decoded in memory. It holds up to its capacity of events, the oldest
+// event is dropped to make room for a new one, so a misbehaving agent can't exhaust the memory of the source.
+type Quarantine struct {
+	sync.RWMutex
+
+	capacity int
+	// events are the quarantined events in order, the oldest event comes first
+	events *list.List
+	index  map[string]*list.Element
+}
+
+func NewQuarantine(capacity int) *Quarantine {
+	return &Quarantine{
+		capacity: capacity,
+		events:   list.New(),
+		index:    make(map[string]*list.Element),
+	}
+}
+
+// Add adds an event that fails to be decoded to the quarantine and returns the quarantined event
+func (q *Quarantine) Add(evt cloudevents.Event, err error) *QuarantinedEvent {
+	q.Lock()
+	defer q.Unlock()
+
+	if q.capacity > 0 && q.events.Len() >= q.capacity {
+		oldest := q.events.Remove(q.events.Front()).(*QuarantinedEvent)
+		delete(q.index, oldest.ID)
+	}
+
+	quarantined := &QuarantinedEvent{
+		ID:            uuid.New().String(),
+		Event:         evt,
+		Error:         err.Error(),
+		QuarantinedAt: time.Now(),
+	}
+	q.index[quarantined.ID] = q.events.PushBack(quarantined)
+	return quarantined
+}
+
+// Get retrieves a quarantined event from the quarantine
+func (q *Quarantine) Get(id string) (*QuarantinedEvent, error) {
+	q.RLock()
+	defer q.RUnlock()
+
+	element, ok := q.index[id]
+	if !ok {
+		return nil, fmt.Errorf("failed to find quarantined event %s", id)
+	}
+
+	return element.Value.(*QuarantinedEvent), nil
+}
+
+// Remove removes a quarantined event from the quarantine
+func (q *Quarantine) Remove(id string) (*QuarantinedEvent, error) {
+	q.Lock()
+	defer q.Unlock()
+
+	element, ok := q.index[id]
+	if !ok {
+		return nil, fmt.Errorf("failed to find quarantined event %s", id)
+	}
+
+	delete(q.index, id)
+	return q.events.Remove(element).(*QuarantinedEvent), nil
+}
+
+// List lists all quarantined events, the oldest event comes first
+func (q *Quarantine) List() []*QuarantinedEvent {
+	q.RLock()
+	defer q.RUnlock()
+
+	events := []*QuarantinedEvent{}
+	for element := q.events.Front(); element != nil; element = element.Next() {
+		events = append(events, element.Value.(*QuarantinedEvent))
+	}
+	return events
+}
+
+// quarantineCodec adds the events that its codec fails to decode to the quarantine.
+type quarantineCodec struct {
+	generic.Codec[*api.Resource]
+	quarantine *Quarantine
+}
+
+var _ generic.Codec[*api.Resource] = &quarantineCodec{}
+
+func (c *quarantineCodec) Decode(evt *cloudevents.Event) (*api.Resource, error) {
+	resource, err := c.Codec.Decode(evt)
+	if err != nil {
+		c.quarantine.Add(evt.Clone(), err)
+		return nil, err
+	}
+	return resource, nil
+}
+
+// QuarantineMiddleware adds the status events that fail to be decoded to the quarantine. It should follow the
+// middlewares that transform the event data, so the events are quarantined with their decrypted and decompressed
+// data.
+func QuarantineMiddleware(quarantine *Quarantine) CodecMiddleware {
+	return func(codec generic.Codec[*api.Resource]) generic.Codec[*api.Resource] {
+		return &quarantineCodec{Codec: codec, quarantine: quarantine}
+	}
+}
@@ -0,0 +1,44 @@
+package source
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+func TestQuarantineEvictsOldest(t *testing.T) {
+	q := NewQuarantine(2)
+	ids := []string{}
+	for i := 1; i <= 3; i++ {
+		evt := cloudevents.NewEvent()
+		evt.SetID(fmt.Sprintf("%d", i))
+		ids = append(ids, q.Add(evt, fmt.Errorf("malformed")).ID)
+	}
+
+	if _, err := q.Get(ids[0]); err == nil {
+		t.Errorf("expected the oldest event is evicted")
+	}
+	if listed := quarantinedIDs(q.List()); !reflect.DeepEqual(listed, ids[1:]) {
+		t.Errorf("expected %v, but got %v", ids[1:], listed)
+	}
+
+	if _, err := q.Remove(ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	evt := cloudevents.NewEvent()
+	evt.SetID("4")
+	ids = append(ids, q.Add(evt, fmt.Errorf("malformed")).ID)
+	if listed := quarantinedIDs(q.List()); !reflect.DeepEqual(listed, []string{ids[2], ids[3]}) {
+		t.Errorf("expected %v, but got %v", []string{ids[2], ids[3]}, listed)
+	}
+}
+
+func quarantinedIDs(events []*QuarantinedEvent) []string {
+	ids := []string{}
+	for _, quarantined := range events {
+		ids = append(ids, quarantined.ID)
+	}
+	return ids
+}
@@ -0,0 +1,173 @@
+package source
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// queueMetricsProvider provides the workqueue metrics with the prometheus metrics, they have the same names and
+// labels as the metrics of the Kubernetes workqueues.
+type queueMetricsProvider struct {
+	depth                   *prometheus.GaugeVec
+	adds                    *prometheus.CounterVec
+	latency                 *prometheus.HistogramVec
+	workDuration            *prometheus.HistogramVec
+	unfinishedWorkSeconds   *prometheus.GaugeVec
+	longestRunningProcessor *prometheus.GaugeVec
+	retries                 *prometheus.CounterVec
+}
+
+var _ workqueue.MetricsProvider = &queueMetricsProvider{}
+
+// NewQueueMetricsProvider returns a workqueue metrics provider whose metrics are registered to the given registerer.
+func NewQueueMetricsProvider(registerer prometheus.Registerer) workqueue.MetricsProvider {
+	p := &queueMetricsProvider{
+		depth: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "workqueue_depth",
+			Help: "Current depth of workqueue",
+		}, []string{"name"}),
+		adds: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "workqueue_adds_total",
+			Help: "Total number of adds handled by workqueue",
+		}, []string{"name"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "workqueue_queue_duration_seconds",
+			Help:    "How long in seconds an item stays in workqueue before being requested.",
+			Buckets: prometheus.ExponentialBuckets(10e-9, 10, 10),
+		}, []string{"name"}),
+		workDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "workqueue_work_duration_seconds",
+			Help:    "How long in seconds processing an item from workqueue takes.",
+			Buckets: prometheus.ExponentialBuckets(10e-9, 10, 10),
+		}, []string{"name"}),
+		unfinishedWorkSeconds: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "workqueue_unfinished_work_seconds",
+			Help: "How many seconds of work has done that is in progress and hasn't been observed by work_duration.",
+		}, []string{"name"}),
+		longestRunningProcessor: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "workqueue_longest_running_processor_seconds",
+			Help: "How many seconds has the longest running processor for workqueue been running.",
+		}, []string{"name"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "workqueue_retries_total",
+			Help: "Total number of retries handled by workqueue",
+		}, []string{"name"}),
+	}
+	registerer.MustRegister(p.depth, p.adds, p.latency, p.workDuration, p.unfinishedWorkSeconds,
+		p.longestRunningProcessor, p.retries)
+	return p
+}
+
+func (p *queueMetricsProvider) NewDepthMetric(name string) workqueue.GaugeMetric {
+	return p.depth.WithLabelValues(name)
+}
+
+func (p *queueMetricsProvider) NewAddsMetric(name string) workqueue.CounterMetric {
+	return p.adds.WithLabelValues(name)
+}
+
+func (p *queueMetricsProvider) NewLatencyMetric(name string) workqueue.HistogramMetric {
+	return p.latency.WithLabelValues(name)
+}
+
+func (p *queueMetricsProvider) NewWorkDurationMetric(name string) workqueue.HistogramMetric {
+	return p.workDuration.WithLabelValues(name)
+}
+
+func (p *queueMetricsProvider) NewUnfinishedWorkSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return p.unfinishedWorkSeconds.WithLabelValues(name)
+}
+
+func (p *queueMetricsProvider) NewLongestRunningProcessorSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return p.longestRunningProcessor.WithLabelValues(name)
+}
+
+func (p *queueMetricsProvider) NewRetriesMetric(name string) workqueue.CounterMetric {
+	return p.retries.WithLabelValues(name)
+}
+
+// queueMetrics records the metrics of a queue like the workqueue does, the caller must hold the queue lock.
+type queueMetrics struct {
+	depth                   workqueue.GaugeMetric
+	adds                    workqueue.CounterMetric
+	latency                 workqueue.HistogramMetric
+	workDuration            workqueue.HistogramMetric
+	unfinishedWorkSeconds   workqueue.SettableGaugeMetric
+	longestRunningProcessor workqueue.SettableGaugeMetric
+
+	addTimes             map[Event]time.Time
+	processingStartTimes map[Event]time.Time
+}
+
+// newQueueMetrics returns the metrics of the named queue, it's nil if there is no provider.
+func newQueueMetrics(name string, provider workqueue.MetricsProvider) *queueMetrics {
+	if provider == nil {
+		return nil
+	}
+
+	return &queueMetrics{
+		depth:                   provider.NewDepthMetric(name),
+		adds:                    provider.NewAddsMetric(name),
+		latency:                 provider.NewLatencyMetric(name),
+		workDuration:            provider.NewWorkDurationMetric(name),
+		unfinishedWorkSeconds:   provider.NewUnfinishedWorkSecondsMetric(name),
+		longestRunningProcessor: provider.NewLongestRunningProcessorSecondsMetric(name),
+		addTimes:                make(map[Event]time.Time),
+		processingStartTimes:    make(map[Event]time.Time),
+	}
+}
+
+func (m *queueMetrics) add(event Event) {
+	if m == nil {
+		return
+	}
+
+	m.adds.Inc()
+	m.depth.Inc()
+	if _, ok := m.addTimes[event]; !ok {
+		m.addTimes[event] = time.Now()
+	}
+}
+
+func (m *queueMetrics) get(event Event) {
+	if m == nil {
+		return
+	}
+
+	m.depth.Dec()
+	m.processingStartTimes[event] = time.Now()
+	if addTime, ok := m.addTimes[event]; ok {
+		m.latency.Observe(time.Since(addTime).Seconds())
+		delete(m.addTimes, event)
+	}
+}
+
+func (m *queueMetrics) done(event Event) {
+	if m == nil {
+		return
+	}
+
+	if startTime, ok := m.processingStartTimes[event]; ok {
+		m.workDuration.Observe(time.Since(startTime).Seconds())
+		delete(m.processingStartTimes, event)
+	}
+}
+
+func (m *queueMetrics) updateUnfinishedWork() {
+	if m == nil {
+		return
+	}
+
+	var total, oldest float64
+	for _, startTime := range m.processingStartTimes {
+		age := time.Since(startTime).Seconds()
+		total = total + age
+		if age > oldest {
+			oldest = age
+		}
+	}
+	m.unfinishedWorkSeconds.Set(total)
+	m.longestRunningProcessor.Set(oldest)
+}
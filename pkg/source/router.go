@@ -0,0 +1,153 @@
+package source
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// ClusterRouter routes the events of a cluster to one of the source transports by the cluster name. A cluster is
+// routed by the static mapping first, then by the first matched rule, and finally to the default transport.
+type ClusterRouter struct {
+	// Clusters maps the cluster names to the transport names.
+	Clusters map[string]string `yaml:"clusters,omitempty"`
+	// ClusterLabels are the labels of the clusters that the rule selectors match.
+	ClusterLabels map[string]map[string]string `yaml:"clusterLabels,omitempty"`
+	// Rules are the routing rules that are matched in order.
+	Rules []RouteRule `yaml:"rules,omitempty"`
+	// Default is the transport of the clusters that are not matched, a cluster can't be routed if it's empty.
+	Default string `yaml:"default,omitempty"`
+}
+
+// RouteRule routes the clusters that match the cluster name patterns or the label selector to a transport. If
+// both are set, a cluster must match both of them.
+type RouteRule struct {
+	// Transport is the transport name.
+	Transport string `yaml:"transport"`
+	// ClusterNames are the glob patterns of the cluster names, e.g. `edge-*`.
+	ClusterNames []string `yaml:"clusterNames,omitempty"`
+	// Selector is the label selector of the cluster labels, e.g. `region=edge`.
+	Selector string `yaml:"selector,omitempty"`
+}
+
+// RoutingConfig is the routing config file of a source with multiple transports.
+type RoutingConfig struct {
+	// Transports maps the transport names to their transport config files.
+	Transports map[string]string `yaml:"transports"`
+
+	ClusterRouter `yaml:",inline"`
+}
+
+// LoadRoutingConfig loads the routing config from a YAML or JSON file.
+func LoadRoutingConfig(file string) (*RoutingConfig, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read routing config %s, %v", file, err)
+	}
+
+	config := &RoutingConfig{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal routing config %s, %v", file, err)
+	}
+
+	if len(config.Transports) == 0 {
+		return nil, fmt.Errorf("invalid routing config %s: no transports", file)
+	}
+
+	transports := []string{}
+	for name := range config.Transports {
+		transports = append(transports, name)
+	}
+	if err := config.Validate(transports); err != nil {
+		return nil, fmt.Errorf("invalid routing config %s: %v", file, err)
+	}
+
+	return config, nil
+}
+
+// Validate validates the router routes the clusters to the given transports.
+func (r *ClusterRouter) Validate(transports []string) error {
+	known := map[string]bool{}
+	for _, transport := range transports {
+		known[transport] = true
+	}
+
+	if r.Default != "" && !known[r.Default] {
+		return fmt.Errorf("the default transport %s is not found", r.Default)
+	}
+
+	for clusterName, transport := range r.Clusters {
+		if !known[transport] {
+			return fmt.Errorf("the transport %s of cluster %s is not found", transport, clusterName)
+		}
+	}
+
+	for i, rule := range r.Rules {
+		if !known[rule.Transport] {
+			return fmt.Errorf("the transport %s of rule %d is not found", rule.Transport, i)
+		}
+
+		if len(rule.ClusterNames) == 0 && rule.Selector == "" {
+			return fmt.Errorf("the rule %d has neither cluster names nor selector", i)
+		}
+
+		for _, pattern := range rule.ClusterNames {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid cluster name pattern %q of rule %d, %v", pattern, i, err)
+			}
+		}
+
+		if _, err := labels.Parse(rule.Selector); err != nil {
+			return fmt.Errorf("invalid selector %q of rule %d, %v", rule.Selector, i, err)
+		}
+	}
+
+	return nil
+}
+
+// Route returns the transport name of the given cluster.
+func (r *ClusterRouter) Route(clusterName string) (string, error) {
+	if transport, ok := r.Clusters[clusterName]; ok {
+		return transport, nil
+	}
+
+	for _, rule := range r.Rules {
+		if rule.matches(clusterName, r.ClusterLabels[clusterName]) {
+			return rule.Transport, nil
+		}
+	}
+
+	if r.Default == "" {
+		return "", fmt.Errorf("no transport is found for cluster %s", clusterName)
+	}
+
+	return r.Default, nil
+}
+
+func (r *RouteRule) matches(clusterName string, clusterLabels map[string]string) bool {
+	if len(r.ClusterNames) != 0 {
+		matched := false
+		for _, pattern := range r.ClusterNames {
+			if ok, _ := path.Match(pattern, clusterName); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if r.Selector != "" {
+		// the selector is validated
+		selector, _ := labels.Parse(r.Selector)
+		if !selector.Matches(labels.Set(clusterLabels)) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,171 @@
+package source
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestClusterRouterRoute(t *testing.T) {
+	router := &ClusterRouter{
+		Clusters: map[string]string{"edge-pinned": "mqtt"},
+		ClusterLabels: map[string]map[string]string{
+			"edge-east":   {"region": "east"},
+			"edge-pinned": {"region": "east"},
+			"core1":       {"region": "east"},
+		},
+		Rules: []RouteRule{
+			{Transport: "kafka", ClusterNames: []string{"edge-*"}, Selector: "region=east"},
+			{Transport: "grpc", ClusterNames: []string{"edge-*", "far-?"}},
+			{Transport: "http", Selector: "region=east"},
+		},
+		Default: "mqtt",
+	}
+
+	cases := []struct {
+		clusterName       string
+		expectedTransport string
+	}{
+		// the static mapping comes before the rules
+		{clusterName: "edge-pinned", expectedTransport: "mqtt"},
+		// a rule with both the patterns and the selector requires matching both of them
+		{clusterName: "edge-east", expectedTransport: "kafka"},
+		// the first matched rule wins
+		{clusterName: "edge-west", expectedTransport: "grpc"},
+		{clusterName: "far-1", expectedTransport: "grpc"},
+		{clusterName: "core1", expectedTransport: "http"},
+		// the unmatched clusters are routed to the default transport
+		{clusterName: "far-10", expectedTransport: "mqtt"},
+		{clusterName: "core2", expectedTransport: "mqtt"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.clusterName, func(t *testing.T) {
+			transport, err := router.Route(c.clusterName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if transport != c.expectedTransport {
+				t.Errorf("expected transport %s, but got %s", c.expectedTransport, transport)
+			}
+		})
+	}
+
+	// a cluster can't be routed without the default transport
+	router.Default = ""
+	if _, err := router.Route("core2"); err == nil || !strings.Contains(err.Error(), "no transport is found for cluster core2") {
+		t.Errorf("expected the unmatched cluster can't be routed, but got %v", err)
+	}
+}
+
+func TestClusterRouterValidate(t *testing.T) {
+	cases := []struct {
+		name        string
+		router      ClusterRouter
+		expectedErr string
+	}{
+		{
+			name: "valid",
+			router: ClusterRouter{
+				Clusters: map[string]string{"cluster1": "grpc"},
+				Rules:    []RouteRule{{Transport: "grpc", ClusterNames: []string{"edge-*"}, Selector: "region in (east,west)"}},
+				Default:  "mqtt",
+			},
+		},
+		{
+			name:        "unknown default transport",
+			router:      ClusterRouter{Default: "amqp"},
+			expectedErr: "the default transport amqp is not found",
+		},
+		{
+			name:        "unknown transport of cluster",
+			router:      ClusterRouter{Clusters: map[string]string{"cluster1": "amqp"}},
+			expectedErr: "the transport amqp of cluster cluster1 is not found",
+		},
+		{
+			name:        "unknown transport of rule",
+			router:      ClusterRouter{Rules: []RouteRule{{Transport: "amqp", ClusterNames: []string{"edge-*"}}}},
+			expectedErr: "the transport amqp of rule 0 is not found",
+		},
+		{
+			name:        "rule without cluster names and selector",
+			router:      ClusterRouter{Rules: []RouteRule{{Transport: "grpc"}}},
+			expectedErr: "the rule 0 has neither cluster names nor selector",
+		},
+		{
+			name:        "invalid cluster name pattern",
+			router:      ClusterRouter{Rules: []RouteRule{{Transport: "grpc", ClusterNames: []string{"edge-["}}}},
+			expectedErr: `invalid cluster name pattern "edge-[" of rule 0`,
+		},
+		{
+			name:        "invalid selector",
+			router:      ClusterRouter{Rules: []RouteRule{{Transport: "grpc", Selector: "region in east"}}},
+			expectedErr: `invalid selector "region in east" of rule 0`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.router.Validate([]string{"mqtt", "grpc"})
+			switch {
+			case c.expectedErr == "" && err != nil:
+				t.Fatalf("unexpected error %v", err)
+			case c.expectedErr != "" && (err == nil || !strings.Contains(err.Error(), c.expectedErr)):
+				t.Fatalf("expected error %q, but got %v", c.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestLoadRoutingConfig(t *testing.T) {
+	cases := []struct {
+		name        string
+		config      string
+		expectedErr string
+	}{
+		{
+			name: "valid",
+			config: "transports:\n  mqtt: /etc/mqtt.yaml\n  grpc: /etc/grpc.yaml\n" +
+				"clusters:\n  cluster1: grpc\ndefault: mqtt\n",
+		},
+		{
+			name:        "no transports",
+			config:      "default: mqtt\n",
+			expectedErr: "no transports",
+		},
+		{
+			name:        "unknown transport",
+			config:      "transports:\n  mqtt: /etc/mqtt.yaml\nclusters:\n  cluster1: grpc\n",
+			expectedErr: "the transport grpc of cluster cluster1 is not found",
+		},
+		{
+			name:        "misspelled field",
+			config:      "transports:\n  mqtt: /etc/mqtt.yaml\ndefualt: mqtt\n",
+			expectedErr: "field defualt not found",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "routes.yaml")
+			if err := os.WriteFile(path, []byte(c.config), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			config, err := LoadRoutingConfig(path)
+			switch {
+			case c.expectedErr == "" && err != nil:
+				t.Fatalf("unexpected error %v", err)
+			case c.expectedErr != "" && (err == nil || !strings.Contains(err.Error(), c.expectedErr)):
+				t.Fatalf("expected error %q, but got %v", c.expectedErr, err)
+			case c.expectedErr != "":
+				return
+			}
+
+			if transport, err := config.Route("cluster1"); err != nil || transport != "grpc" {
+				t.Errorf("expected cluster1 is routed to grpc, but got %s %v", transport, err)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package source
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"reflect"
 
@@ -9,20 +10,28 @@ import (
 	"github.com/google/uuid"
 	"github.com/morvencao/event-based-transport-demo/pkg/api"
 	"github.com/morvencao/event-based-transport-demo/pkg/store"
+	"github.com/morvencao/event-based-transport-demo/pkg/transport"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 type APIServer struct {
 	sourceID        string
 	server          *http.Server
+	router          *gin.Engine
 	store           store.Store
-	eventController EventController
+	eventController *EventController
+	client          *ResourceSourceClient
+	maxPayloadSize  int
+	quarantine      *Quarantine
+	tlsCertFile     string
+	tlsKeyFile      string
 }
 
 func NewAPIServer(addr, sourceID string, store store.Store, eventController *EventController) *APIServer {
 	s := &APIServer{
 		sourceID:        sourceID,
 		store:           store,
-		eventController: *eventController,
+		eventController: eventController,
 	}
 
 	router := gin.Default()
@@ -31,7 +40,16 @@ func NewAPIServer(addr, sourceID string, store store.Store, eventController *Eve
 	router.POST("/resources", s.postResource)
 	router.PATCH("/resources/:id", s.updateResource)
 	router.DELETE("/resources/:id", s.deleteResource)
+	router.GET("/events/deadletter", s.getDeadLetters)
+	router.GET("/events/deadletter/:id", s.getDeadLetterByID)
+	router.POST("/events/deadletter/:id/retry", s.retryDeadLetter)
+	router.DELETE("/events/deadletter/:id", s.deleteDeadLetter)
+	router.GET("/events/quarantine", s.getQuarantinedEvents)
+	router.GET("/events/quarantine/:id", s.getQuarantinedEventByID)
+	router.DELETE("/events/quarantine/:id", s.deleteQuarantinedEvent)
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
+	s.router = router
 	s.server = &http.Server{
 		Addr:    addr,
 		Handler: router,
@@ -40,12 +58,43 @@ func NewAPIServer(addr, sourceID string, store store.Store, eventController *Eve
 	return s
 }
 
+// AddIngestHandler serves the handler on a POST route of the given path, it's used by the transports that receive
+// the events over HTTP, the handler authenticates the requests itself. It must be called before the server is started.
+func (s *APIServer) AddIngestHandler(path string, handler http.Handler) {
+	s.router.POST(path, gin.WrapH(handler))
+}
+
+// SetPayloadLimit makes the server reject the resources whose spec event exceeds the max payload size as it's
+// encoded by the client, i.e. after the compression, the encryption and the signature. It must be called before
+// the server is started.
+func (s *APIServer) SetPayloadLimit(client *ResourceSourceClient, maxPayloadSize int) {
+	s.client = client
+	s.maxPayloadSize = maxPayloadSize
+}
+
+// SetQuarantine serves the events of the quarantine, the quarantine is empty if it's not set. It must be called
+// before the server is started.
+func (s *APIServer) SetQuarantine(quarantine *Quarantine) {
+	s.quarantine = quarantine
+}
+
+// SetTLS serves the API over TLS with the given cert, the client certs are requested for the ingest handlers that
+// authenticate the agents with mTLS. It must be called before the server is started.
+func (s *APIServer) SetTLS(certFile, keyFile string) {
+	s.tlsCertFile = certFile
+	s.tlsKeyFile = keyFile
+	s.server.TLSConfig = transport.HTTPServerTLSConfig()
+}
+
 func (s *APIServer) Start(ctx context.Context) error {
 	go func() {
 		<-ctx.Done()
 		s.server.Shutdown(ctx)
 	}()
 
+	if s.tlsCertFile != "" {
+		return s.server.ListenAndServeTLS(s.tlsCertFile, s.tlsKeyFile)
+	}
 	return s.server.ListenAndServe()
 }
 
@@ -65,11 +114,21 @@ func (s *APIServer) getResourceByID(c *gin.Context) {
 }
 
 func (s *APIServer) postResource(c *gin.Context) {
+	priority, err := eventPriority(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	var resource *api.Resource
 	if err := c.ShouldBindJSON(&resource); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := resource.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	// server generates a resource ID with UUID
 	resource.ResourceID = uuid.New().String()
@@ -77,6 +136,11 @@ func (s *APIServer) postResource(c *gin.Context) {
 	resource.Source = s.sourceID
 	// server sets the resource version to 1
 	resource.ResourceVersion = 1
+	// the payload is checked once the resource has the extensions of its spec event
+	if code, err := s.checkPayloadSize(resource); err != nil {
+		c.JSON(code, gin.H{"error": err.Error()})
+		return
+	}
 	// persist the resource
 	s.store.Add(resource)
 
@@ -84,6 +148,7 @@ func (s *APIServer) postResource(c *gin.Context) {
 	event := Event{
 		EventType: CreateEvent,
 		ID:        resource.ResourceID,
+		Priority:  priority,
 	}
 	s.eventController.EnqueueEvent(event)
 
@@ -92,6 +157,12 @@ func (s *APIServer) postResource(c *gin.Context) {
 
 func (s *APIServer) updateResource(c *gin.Context) {
 	id := c.Param("id")
+	priority, err := eventPriority(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	var resource *api.Resource
 	if err := c.ShouldBindJSON(&resource); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -102,17 +173,58 @@ func (s *APIServer) updateResource(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
-	if reflect.DeepEqual(resource.Spec, found.Spec) {
+	// the type can't be changed
+	if resource.Type == "" {
+		resource.Type = found.Type
+	}
+	if resource.IsBundle() != found.IsBundle() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "the resource type can't be changed"})
+		return
+	}
+	if err := resource.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// the feedback rules, update strategy and delete option are kept if they are not given
+	if resource.FeedbackRules == nil {
+		resource.FeedbackRules = found.FeedbackRules
+	}
+	if resource.UpdateStrategy == nil {
+		resource.UpdateStrategy = found.UpdateStrategy
+	}
+	if resource.DeleteOption == nil {
+		resource.DeleteOption = found.DeleteOption
+	}
+	if reflect.DeepEqual(resource.Spec, found.Spec) &&
+		reflect.DeepEqual(resource.Manifests, found.Manifests) &&
+		reflect.DeepEqual(resource.FeedbackRules, found.FeedbackRules) &&
+		reflect.DeepEqual(resource.UpdateStrategy, found.UpdateStrategy) &&
+		reflect.DeepEqual(resource.DeleteOption, found.DeleteOption) {
 		c.JSON(http.StatusNotAcceptable, gin.H{"error": "no change in resource spec"})
 		return
 	}
+	// the payload is checked as the spec event of the updated resource is sent
+	resource.ResourceID = found.ResourceID
+	resource.Source = found.Source
+	resource.ClusterName = found.ClusterName
+	resource.ResourceVersion = found.ResourceVersion + 1
+	if code, err := s.checkPayloadSize(resource); err != nil {
+		c.JSON(code, gin.H{"error": err.Error()})
+		return
+	}
 
-	// update the resource spec
-	found.Spec = resource.Spec
+	// update the spec and options of a copy, the stored resource is replaced rather than modified, so it's intact
+	// if the update fails and its readers don't race with the update
+	updated := *found
+	updated.Spec = resource.Spec
+	updated.Manifests = resource.Manifests
+	updated.FeedbackRules = resource.FeedbackRules
+	updated.UpdateStrategy = resource.UpdateStrategy
+	updated.DeleteOption = resource.DeleteOption
 	// increment the resource version
-	found.ResourceVersion = found.ResourceVersion + 1
+	updated.ResourceVersion = found.ResourceVersion + 1
 	// persist the resource
-	if err := s.store.Update(found); err != nil {
+	if err := s.store.Update(&updated); err != nil {
 		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 		return
 	}
@@ -121,6 +233,7 @@ func (s *APIServer) updateResource(c *gin.Context) {
 	event := Event{
 		EventType: UpdateEvent,
 		ID:        id,
+		Priority:  priority,
 	}
 	s.eventController.EnqueueEvent(event)
 
@@ -129,6 +242,12 @@ func (s *APIServer) updateResource(c *gin.Context) {
 
 func (s *APIServer) deleteResource(c *gin.Context) {
 	id := c.Param("id")
+	priority, err := eventPriority(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	resource, err := s.store.Get(id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
@@ -142,8 +261,108 @@ func (s *APIServer) deleteResource(c *gin.Context) {
 	event := Event{
 		EventType: DeleteEvent,
 		ID:        resource.ResourceID,
+		Priority:  priority,
 	}
 	s.eventController.EnqueueEvent(event)
 
 	c.JSON(http.StatusNoContent, nil)
 }
+
+// checkPayloadSize encodes the spec event of the resource as it's published, and returns an error with its status
+// code if the event can't be encoded, e.g. its cluster has no encryption key, or it exceeds the max payload size.
+func (s *APIServer) checkPayloadSize(resource *api.Resource) (int, error) {
+	if s.client == nil || s.maxPayloadSize == 0 {
+		return http.StatusOK, nil
+	}
+
+	evt, err := s.client.encodeSpec(s.sourceID, resource)
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("failed to encode the spec event, %v", err)
+	}
+	if size := transport.PayloadSize(evt); size > s.maxPayloadSize {
+		return http.StatusRequestEntityTooLarge,
+			fmt.Errorf("the event payload is %d bytes, it exceeds the max payload size %d", size, s.maxPayloadSize)
+	}
+	return http.StatusOK, nil
+}
+
+// eventPriority gets the event priority from the priority query parameter, e.g. a rollback can be sent with
+// `?priority=high` to reach the agent ahead of the routine updates. It's empty if the parameter is not set, then
+// the default priority of the event type is used.
+func eventPriority(c *gin.Context) (EventPriority, error) {
+	priority := c.Query("priority")
+	if priority == "" {
+		return "", nil
+	}
+	return ParseEventPriority(priority)
+}
+
+func (s *APIServer) getDeadLetters(c *gin.Context) {
+	deadLetters := s.eventController.DeadLetters().List()
+	c.JSON(http.StatusOK, deadLetters)
+}
+
+func (s *APIServer) getDeadLetterByID(c *gin.Context) {
+	id := c.Param("id")
+	deadLetter, err := s.eventController.DeadLetters().Get(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, deadLetter)
+}
+
+func (s *APIServer) retryDeadLetter(c *gin.Context) {
+	id := c.Param("id")
+	// replay the event of the dead letter
+	deadLetter, err := s.eventController.RetryDeadLetter(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, deadLetter)
+}
+
+func (s *APIServer) deleteDeadLetter(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := s.eventController.DeadLetters().Remove(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusNoContent, nil)
+}
+
+func (s *APIServer) getQuarantinedEvents(c *gin.Context) {
+	if s.quarantine == nil {
+		c.JSON(http.StatusOK, []*QuarantinedEvent{})
+		return
+	}
+	c.JSON(http.StatusOK, s.quarantine.List())
+}
+
+func (s *APIServer) getQuarantinedEventByID(c *gin.Context) {
+	id := c.Param("id")
+	if s.quarantine == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "failed to find quarantined event " + id})
+		return
+	}
+	quarantined, err := s.quarantine.Get(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, quarantined)
+}
+
+func (s *APIServer) deleteQuarantinedEvent(c *gin.Context) {
+	id := c.Param("id")
+	if s.quarantine == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "failed to find quarantined event " + id})
+		return
+	}
+	if _, err := s.quarantine.Remove(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusNoContent, nil)
+}
@@ -0,0 +1,183 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/morvencao/event-based-transport-demo/pkg/store"
+	"github.com/morvencao/event-based-transport-demo/pkg/transport"
+	"gopkg.in/yaml.v2"
+
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/options"
+)
+
+func TestCheckPayloadSize(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	keyring := newTestKeyring(t)
+	compression := transport.NewCompressionOptions()
+	compression.Algorithm = transport.CompressionZstd
+	compression.Threshold = 0
+
+	startClient := func(middlewares ...CodecMiddleware) *ResourceSourceClient {
+		client, err := StartRoutedResourceSourceClient(ctx,
+			map[string]*options.CloudEventsSourceOptions{
+				DefaultTransport: transport.NewLoopbackSourceOptions(transport.NewLoopbackBroker(), "source"),
+			},
+			&ClusterRouter{Default: DefaultTransport}, NewConnectionOptions(), store.NewMemoryStore(), middlewares...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return client
+	}
+	compressing := startClient(CompressionMiddleware(compression))
+	securing := startClient(SignatureMiddleware(keyring, nil), EncryptionMiddleware(keyring),
+		CompressionMiddleware(compression))
+
+	resource := newTestResource("source", "cluster1", "nginx")
+	evt, err := compressing.encodeSpec("source", resource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressedSize := transport.PayloadSize(evt)
+
+	// the compressed payload fits, but the encryption and the signature make it exceed the limit
+	server := NewAPIServer("", "source", store.NewMemoryStore(), nil)
+	server.SetPayloadLimit(compressing, compressedSize)
+	if _, err := server.checkPayloadSize(resource); err != nil {
+		t.Errorf("expected the compressed payload fits the limit, but got %v", err)
+	}
+	server.SetPayloadLimit(securing, compressedSize)
+	if code, err := server.checkPayloadSize(resource); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected the encrypted and signed payload exceeds the limit, but got %d %v", code, err)
+	}
+
+	// the resource of a cluster without an encryption key can't be encoded
+	server.SetPayloadLimit(securing, 1<<20)
+	if code, err := server.checkPayloadSize(newTestResource("source", "cluster2", "nginx")); code != http.StatusBadRequest {
+		t.Errorf("expected the resource without an encryption key is a bad request, but got %d %v", code, err)
+	}
+}
+
+func TestUpdateResourceReplacesStoredResource(t *testing.T) {
+	cases := []struct {
+		name                    string
+		deleting                bool
+		expectedCode            int
+		expectedResourceVersion int64
+	}{
+		{
+			name:                    "updated",
+			expectedCode:            http.StatusOK,
+			expectedResourceVersion: 2,
+		},
+		{
+			name:                    "being deleted",
+			deleting:                true,
+			expectedCode:            http.StatusConflict,
+			expectedResourceVersion: 1,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			resourceStore := store.NewMemoryStore()
+			resource := newTestResource("source", "cluster1", "nginx")
+			resourceStore.Add(resource)
+			if c.deleting {
+				resourceStore.MarkAsDeleting(resource.ResourceID)
+			}
+			stored, err := resourceStore.Get(resource.ResourceID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			server := NewAPIServer("", "source", resourceStore, NewEventController(NewEventControllerOptions()))
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPatch, "/resources/"+resource.ResourceID, strings.NewReader(
+				`{"spec":{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"nginx","namespace":"default"},`+
+					`"spec":{"replicas":3}}}`))
+			server.router.ServeHTTP(w, req)
+			if w.Code != c.expectedCode {
+				t.Fatalf("expected code %d, but got %d: %s", c.expectedCode, w.Code, w.Body.String())
+			}
+
+			// the resource that was read before the update is not modified
+			if stored.ResourceVersion != 1 {
+				t.Errorf("expected the stored resource is not modified, but got resource version %d", stored.ResourceVersion)
+			}
+			latest, err := resourceStore.Get(resource.ResourceID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if latest.ResourceVersion != c.expectedResourceVersion {
+				t.Errorf("expected resource version %d, but got %d", c.expectedResourceVersion, latest.ResourceVersion)
+			}
+		})
+	}
+}
+
+func TestDeadLetterEndpoints(t *testing.T) {
+	ec := NewEventController(NewEventControllerOptions())
+	deadLetter := ec.DeadLetters().Add(Event{EventType: UpdateEvent, ID: "r1"}, 3, fmt.Errorf("failed"))
+	server := NewAPIServer("", "source", store.NewMemoryStore(), ec)
+
+	for _, c := range []struct {
+		method       string
+		path         string
+		expectedCode int
+	}{
+		{http.MethodGet, "/events/deadletter", http.StatusOK},
+		{http.MethodGet, "/events/deadletter/" + deadLetter.ID, http.StatusOK},
+		{http.MethodDelete, "/events/deadletter/" + deadLetter.ID, http.StatusNoContent},
+		{http.MethodGet, "/events/deadletter/" + deadLetter.ID, http.StatusNotFound},
+		{http.MethodDelete, "/events/deadletter/" + deadLetter.ID, http.StatusNotFound},
+		{http.MethodPost, "/events/deadletter/" + deadLetter.ID + "/retry", http.StatusNotFound},
+	} {
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, httptest.NewRequest(c.method, c.path, nil))
+		if w.Code != c.expectedCode {
+			t.Errorf("expected %s %s returns %d, but got %d", c.method, c.path, c.expectedCode, w.Code)
+		}
+	}
+	if deadLetters := ec.DeadLetters().List(); len(deadLetters) != 0 {
+		t.Errorf("expected the deleted dead letter is removed, but got %v", deadLetters)
+	}
+}
+
+// newTestKeyring returns a keyring that signs the events and encrypts the events of cluster1.
+func newTestKeyring(t *testing.T) *transport.Keyring {
+	encryptionKey, err := transport.NewKeyringKey("cluster1-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingKey, err := transport.NewSigningKey("source-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := yaml.Marshal(transport.KeyringConfig{
+		Clusters:    map[string][]transport.KeyringKey{"cluster1": {encryptionKey}},
+		SigningKeys: []transport.KeyringKey{signingKey},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "keyring.yaml")
+	if err := os.WriteFile(file, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	keyring, err := transport.LoadKeyring(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyring
+}
@@ -1,17 +1,30 @@
 package source
 
 import (
-	"crypto/sha256"
-	"encoding/json"
-	"fmt"
-
 	"github.com/morvencao/event-based-transport-demo/pkg/api"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	workv1 "open-cluster-management.io/api/work/v1"
+
+	cloudeventswork "open-cluster-management.io/sdk-go/pkg/cloudevents/work"
 )
 
+// StatusHashGetter returns the hash of the ManifestWork status that the agent reported with the status of the
+// resource, so an agent built on sdk-go doesn't resend the status on a status resync if it's not changed. It's empty
+// if no status is reported, or the status couldn't be decoded as it was sent, then the agent resends the status.
 func StatusHashGetter(resource *api.Resource) (string, error) {
-	statusBytes, err := json.Marshal(resource.Status)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal resource status, %v", err)
+	if resource.Status == nil {
+		return "", nil
 	}
-	return fmt.Sprintf("%x", sha256.Sum256(statusBytes)), nil
+	return resource.Status.StatusHash, nil
+}
+
+// workStatusHash hashes the ManifestWork status of the status payload as the agent hashes its ManifestWork, the
+// payload carries the conditions and the manifest conditions of the ManifestWork as they are.
+func workStatusHash(conditions []metav1.Condition, manifests []workv1.ManifestCondition) (string, error) {
+	return cloudeventswork.ManifestWorkStatusHash(&workv1.ManifestWork{
+		Status: workv1.ManifestWorkStatus{
+			Conditions:     conditions,
+			ResourceStatus: workv1.ManifestResourceStatus{Manifests: manifests},
+		},
+	})
 }
@@ -0,0 +1,133 @@
+package source
+
+import (
+	"testing"
+	"time"
+
+	"github.com/morvencao/event-based-transport-demo/pkg/api"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	workv1 "open-cluster-management.io/api/work/v1"
+
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic"
+	cetypes "open-cluster-management.io/sdk-go/pkg/cloudevents/generic/types"
+	cloudeventswork "open-cluster-management.io/sdk-go/pkg/cloudevents/work"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/work/agent/codec"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/work/common"
+)
+
+func TestStatusHash(t *testing.T) {
+	cases := []struct {
+		name      string
+		agent     generic.Codec[*workv1.ManifestWork]
+		source    generic.Codec[*api.Resource]
+		manifests int
+	}{
+		{
+			name:      "manifest",
+			agent:     codec.NewManifestCodec(nil),
+			source:    &ResourceCodec{},
+			manifests: 1,
+		},
+		{
+			name:      "manifest bundle",
+			agent:     codec.NewManifestBundleCodec(),
+			source:    &ResourceBundleCodec{},
+			manifests: 2,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			work := newHashTestWork(c.manifests)
+			evt, err := c.agent.Encode("cluster1-agent", cetypes.CloudEventsType{
+				CloudEventsDataType: c.agent.EventDataType(),
+				SubResource:         cetypes.SubResourceStatus,
+				Action:              "update_request",
+			}, work)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resource, err := c.source.Decode(evt)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the hash of the decoded status is the hash that the agent compares on a status resync
+			expected, err := cloudeventswork.ManifestWorkStatusHash(work)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hash, err := StatusHashGetter(resource)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hash != expected {
+				t.Errorf("expected status hash %s, but got %s", expected, hash)
+			}
+
+			// the status is changed on the agent, so it's resent
+			work.Status.Conditions[0].Reason = "Changed"
+			changed, err := cloudeventswork.ManifestWorkStatusHash(work)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hash == changed {
+				t.Errorf("expected the status hash is changed with the status")
+			}
+		})
+	}
+}
+
+func TestStatusHashWithoutStatus(t *testing.T) {
+	hash, err := StatusHashGetter(&api.Resource{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != "" {
+		t.Errorf("expected no status hash, but got %s", hash)
+	}
+}
+
+func newHashTestWork(manifests int) *workv1.ManifestWork {
+	transitionTime := metav1.NewTime(time.Date(2024, 10, 1, 8, 30, 15, 0, time.UTC))
+	replicas := int64(2)
+	raw := `{"replicas":2}`
+	work := &workv1.ManifestWork{
+		ObjectMeta: metav1.ObjectMeta{
+			UID:             types.UID("r1"),
+			ResourceVersion: "3",
+			Namespace:       "cluster1",
+			Labels:          map[string]string{common.CloudEventsOriginalSourceLabelKey: "source"},
+		},
+		Status: workv1.ManifestWorkStatus{
+			Conditions: []metav1.Condition{{
+				Type:               workv1.WorkApplied,
+				Status:             metav1.ConditionTrue,
+				Reason:             "AppliedManifestWorkComplete",
+				LastTransitionTime: transitionTime,
+			}},
+		},
+	}
+	for i := 0; i < manifests; i++ {
+		work.Spec.Workload.Manifests = append(work.Spec.Workload.Manifests, workv1.Manifest{})
+		work.Status.ResourceStatus.Manifests = append(work.Status.ResourceStatus.Manifests, workv1.ManifestCondition{
+			ResourceMeta: workv1.ManifestResourceMeta{
+				Ordinal: int32(i), Group: "apps", Version: "v1", Kind: "Deployment", Resource: "deployments",
+				Name: "nginx", Namespace: "default",
+			},
+			StatusFeedbacks: workv1.StatusFeedbackResult{Values: []workv1.FeedbackValue{
+				{Name: "replicas", Value: workv1.FieldValue{Type: workv1.Integer, Integer: &replicas}},
+				{Name: "status", Value: workv1.FieldValue{Type: workv1.JsonRaw, JsonRaw: &raw}},
+			}},
+			Conditions: []metav1.Condition{{
+				Type:               workv1.ManifestAvailable,
+				Status:             metav1.ConditionTrue,
+				Reason:             "ResourceAvailable",
+				LastTransitionTime: transitionTime,
+			}},
+		})
+	}
+	return work
+}
@@ -0,0 +1,60 @@
+package source
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/morvencao/event-based-transport-demo/pkg/api"
+)
+
+// checkStatusOrder returns an error if the status is superseded by the stored status of the resource, or if it's
+// reported on a resource version that the source hasn't published yet. A status that is reported on an older
+// resource version than the stored status is superseded. On the same resource version,
+// the status events of an agent are ordered by their sequence IDs, which are snowflake IDs that increase with the
+// time they're generated, so a status whose sequence ID isn't greater than the stored one is out of order.
+//
+// A status without a resource version or a sequence ID, e.g. one that's decoded in the tolerant mode, can't be
+// ordered by it, so that part of the check is skipped.
+func checkStatusOrder(last, resource *api.Resource) error {
+	observed := resource.Status.ObservedResourceVersion
+	if observed > last.ResourceVersion {
+		return fmt.Errorf("the status of resource %s is reported on resource version %d, but the latest resource version is %d",
+			resource.ResourceID, observed, last.ResourceVersion)
+	}
+
+	if last.Status == nil || last.Status.ReconcileStatus == nil {
+		return nil
+	}
+
+	lastObserved := last.Status.ObservedResourceVersion
+	if observed != 0 && observed < lastObserved {
+		return fmt.Errorf("the status of resource %s is reported on resource version %d, but the status of resource version %d is received",
+			resource.ResourceID, observed, lastObserved)
+	}
+	if observed > lastObserved {
+		return nil
+	}
+
+	sequenceID, ok := parseSequenceID(resource.Status.ReconcileStatus.SequenceID)
+	if !ok {
+		return nil
+	}
+	lastSequenceID, ok := parseSequenceID(last.Status.ReconcileStatus.SequenceID)
+	if !ok {
+		return nil
+	}
+	if sequenceID <= lastSequenceID {
+		return fmt.Errorf("the status of resource %s has sequence id %d, but the status of sequence id %d is received",
+			resource.ResourceID, sequenceID, lastSequenceID)
+	}
+
+	return nil
+}
+
+func parseSequenceID(sequenceID string) (int64, bool) {
+	id, err := strconv.ParseInt(sequenceID, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,122 @@
+package source
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/morvencao/event-based-transport-demo/pkg/api"
+	"github.com/morvencao/event-based-transport-demo/pkg/store"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/work/common"
+)
+
+func TestCheckStatusOrder(t *testing.T) {
+	cases := []struct {
+		name        string
+		lastVersion int64
+		lastStatus  *api.ResourceStatus
+		status      *api.ResourceStatus
+		expectedErr string
+	}{
+		{
+			name:        "first status",
+			lastVersion: 1,
+			status:      newTestStatus(1, "1"),
+		},
+		{
+			name:        "status of a newer resource version",
+			lastVersion: 2,
+			lastStatus:  newTestStatus(1, "2"),
+			status:      newTestStatus(2, "1"),
+		},
+		{
+			name:        "status of an older resource version",
+			lastVersion: 2,
+			lastStatus:  newTestStatus(2, "1"),
+			status:      newTestStatus(1, "2"),
+			expectedErr: "but the status of resource version 2 is received",
+		},
+		{
+			name:        "status of an unpublished resource version",
+			lastVersion: 1,
+			status:      newTestStatus(2, "1"),
+			expectedErr: "but the latest resource version is 1",
+		},
+		{
+			name:        "newer sequence id",
+			lastVersion: 1,
+			lastStatus:  newTestStatus(1, "1"),
+			status:      newTestStatus(1, "2"),
+		},
+		{
+			name:        "out-of-order sequence id",
+			lastVersion: 1,
+			lastStatus:  newTestStatus(1, "2"),
+			status:      newTestStatus(1, "1"),
+			expectedErr: "but the status of sequence id 2 is received",
+		},
+		{
+			name:        "status without sequence id",
+			lastVersion: 1,
+			lastStatus:  newTestStatus(1, "2"),
+			status:      newTestStatus(1, ""),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			last := newTestResource("source", "cluster1", "nginx")
+			last.ResourceVersion = c.lastVersion
+			last.Status = c.lastStatus
+			resource := newTestResource("source", "cluster1", "nginx")
+			resource.Status = c.status
+
+			err := checkStatusOrder(last, resource)
+			switch {
+			case c.expectedErr == "" && err != nil:
+				t.Errorf("unexpected error %v", err)
+			case c.expectedErr != "" && (err == nil || !strings.Contains(err.Error(), c.expectedErr)):
+				t.Errorf("expected error %q, but got %v", c.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestHandleStatusDiscardsStaleDeletedStatus(t *testing.T) {
+	resourceStore := store.NewMemoryStore()
+	client := &ResourceSourceClient{store: resourceStore}
+	resource := newTestResource("source", "cluster1", "nginx")
+	resource.Status = newTestStatus(1, "2")
+	resourceStore.Add(resource)
+	resourceStore.MarkAsDeleting(resource.ResourceID)
+
+	deleted := newTestResource("source", "cluster1", "nginx")
+	deleted.Status = newTestStatus(1, "1")
+	deleted.Status.ReconcileStatus.Conditions = []metav1.Condition{
+		{Type: common.ManifestsDeleted, Status: metav1.ConditionTrue, Reason: "ManifestsDeleted"},
+	}
+
+	// the deleted status is older than the stored status, so it's discarded
+	if err := client.handleStatus(deleted); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := resourceStore.Get(resource.ResourceID); err != nil {
+		t.Errorf("expected the resource is kept, but got %v", err)
+	}
+
+	deleted.Status.ReconcileStatus.SequenceID = "3"
+	if err := client.handleStatus(deleted); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := resourceStore.Get(resource.ResourceID); err == nil {
+		t.Errorf("expected the resource is deleted")
+	}
+}
+
+func newTestStatus(observedVersion int64, sequenceID string) *api.ResourceStatus {
+	return &api.ResourceStatus{
+		ObservedResourceVersion: observedVersion,
+		ReconcileStatus:         &api.ReconcileStatus{SequenceID: sequenceID},
+	}
+}
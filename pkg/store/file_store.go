@@ -0,0 +1,137 @@
+package store
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+
+	"github.com/morvencao/event-based-transport-demo/pkg/api"
+)
+
+var _ Store = &FileStore{}
+
+// resourceRecord is a journal record of the latest state of a resource, the resource is nil if it's deleted.
+type resourceRecord struct {
+	ResourceID string        `json:"resourceID"`
+	Resource   *api.Resource `json:"resource,omitempty"`
+}
+
+// FileStore keeps the resources in memory and records their changes in a journal file, so that the resources are
+// reloaded when the source restarts.
+type FileStore struct {
+	*MemoryStore
+
+	// serializes the changes with the journal records
+	journalLock sync.Mutex
+	journal     *Journal
+}
+
+// NewFileStore returns a FileStore that records the resources in the given journal file. The resources are loaded
+// from the file if it exists.
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{
+		MemoryStore: NewMemoryStore(),
+	}
+
+	journal, err := OpenJournal(path, func(data []byte) error {
+		record := &resourceRecord{}
+		if err := json.Unmarshal(data, record); err != nil {
+			return err
+		}
+		if record.Resource == nil {
+			delete(s.resources, record.ResourceID)
+			return nil
+		}
+		s.resources[record.ResourceID] = record.Resource
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.journal = journal
+
+	return s, nil
+}
+
+func (s *FileStore) Add(resource *api.Resource) {
+	s.journalLock.Lock()
+	defer s.journalLock.Unlock()
+
+	s.MemoryStore.Add(resource)
+	s.logError(s.record(resource.ResourceID))
+}
+
+func (s *FileStore) Update(resource *api.Resource) error {
+	s.journalLock.Lock()
+	defer s.journalLock.Unlock()
+
+	if err := s.MemoryStore.Update(resource); err != nil {
+		return err
+	}
+	return s.record(resource.ResourceID)
+}
+
+func (s *FileStore) UpSert(resource *api.Resource) {
+	s.journalLock.Lock()
+	defer s.journalLock.Unlock()
+
+	s.MemoryStore.UpSert(resource)
+	s.logError(s.record(resource.ResourceID))
+}
+
+func (s *FileStore) UpdateStatus(resource *api.Resource) error {
+	s.journalLock.Lock()
+	defer s.journalLock.Unlock()
+
+	if err := s.MemoryStore.UpdateStatus(resource); err != nil {
+		return err
+	}
+	return s.record(resource.ResourceID)
+}
+
+func (s *FileStore) MarkAsDeleting(resourceID string) {
+	s.journalLock.Lock()
+	defer s.journalLock.Unlock()
+
+	s.MemoryStore.MarkAsDeleting(resourceID)
+	s.logError(s.record(resourceID))
+}
+
+func (s *FileStore) Delete(resourceID string) {
+	s.journalLock.Lock()
+	defer s.journalLock.Unlock()
+
+	s.MemoryStore.Delete(resourceID)
+	s.logError(s.record(resourceID))
+}
+
+// record appends the latest state of the resource to the journal, and compacts the journal to the current resources
+// once it has grown well beyond them.
+func (s *FileStore) record(resourceID string) error {
+	record := &resourceRecord{ResourceID: resourceID}
+	if resource, err := s.MemoryStore.Get(resourceID); err == nil {
+		record.Resource = resource
+	}
+	if err := s.journal.Append(record); err != nil {
+		return err
+	}
+
+	s.MemoryStore.RLock()
+	live := len(s.resources)
+	s.MemoryStore.RUnlock()
+	if !s.journal.NeedsCompaction(live) {
+		return nil
+	}
+
+	snapshot := []interface{}{}
+	for _, resource := range s.MemoryStore.ListAll() {
+		snapshot = append(snapshot, &resourceRecord{ResourceID: resource.ResourceID, Resource: resource})
+	}
+	return s.journal.Compact(snapshot)
+}
+
+func (s *FileStore) logError(err error) {
+	if err != nil {
+		log.Printf("Failed to persist the resource store, %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/morvencao/event-based-transport-demo/pkg/api"
+)
+
+func TestFileStoreReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resources")
+
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Add(&api.Resource{ResourceID: "r1", ClusterName: "cluster1", ResourceVersion: 1})
+	s.Add(&api.Resource{ResourceID: "r2", ClusterName: "cluster1", ResourceVersion: 1})
+	if err := s.Update(&api.Resource{ResourceID: "r1", ClusterName: "cluster1", ResourceVersion: 2}); err != nil {
+		t.Fatal(err)
+	}
+	s.MarkAsDeleting("r2")
+	s.Add(&api.Resource{ResourceID: "r3", ClusterName: "cluster2", ResourceVersion: 1})
+	s.Delete("r3")
+	if err := s.journal.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resources := reloaded.ListAll(); len(resources) != 2 {
+		t.Errorf("expected 2 resources, but got %d", len(resources))
+	}
+	r1, err := reloaded.Get("r1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r1.ResourceVersion != 2 {
+		t.Errorf("expected resource version 2, but got %d", r1.ResourceVersion)
+	}
+	r2, err := reloaded.Get("r2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r2.DeletionTimestamp.IsZero() {
+		t.Errorf("expected resource r2 is deleting")
+	}
+}
+
+func TestFileStoreCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resources")
+
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Add(&api.Resource{ResourceID: "r1", ClusterName: "cluster1"})
+	for i := 0; i < 10*minCompactionRecords; i++ {
+		if err := s.UpdateStatus(&api.Resource{ResourceID: "r1", Status: &api.ResourceStatus{}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if s.journal.records > minCompactionRecords+1 {
+		t.Errorf("expected the journal is compacted, but it has %d records", s.journal.records)
+	}
+
+	reloaded, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reloaded.Get("r1"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestJournalTornRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resources")
+	if err := os.WriteFile(path, []byte(`{"resourceID":"r1","resource":{"resourceID":"r1"}}`+"\n"+`{"resourceID":"r2","reso`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Add(&api.Resource{ResourceID: "r3"})
+
+	reloaded, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"r1", "r3"} {
+		if _, err := reloaded.Get(id); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := reloaded.Get("r2"); err == nil {
+		t.Errorf("expected the torn resource r2 is dropped")
+	}
+}
@@ -0,0 +1,157 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// minCompactionRecords is the number of records below which a journal is not compacted.
+const minCompactionRecords = 100
+
+// Journal is an append-only log of JSON records in a file, one record per line. The records are replayed when the
+// journal is opened to rebuild the state, and the log is compacted to a snapshot of the state once it has grown well
+// beyond it, so a change costs one appended record instead of a rewrite of the whole state.
+type Journal struct {
+	lock    sync.Mutex
+	path    string
+	file    *os.File
+	records int
+}
+
+// OpenJournal opens the journal file, creating it if it doesn't exist, and replays its records in order. A record
+// that is torn by a crash while it was appended is the last line of the file, it's dropped.
+func OpenJournal(path string, replay func(data []byte) error) (*Journal, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read journal %s, %v", path, err)
+	}
+
+	j := &Journal{path: path}
+	torn := false
+	lines := bytes.Split(data, []byte("\n"))
+	for i, line := range lines {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if err := replay(line); err != nil {
+			if i == len(lines)-1 {
+				// the record has no trailing newline, it was not completely written
+				torn = true
+				break
+			}
+			return nil, fmt.Errorf("failed to replay journal %s at line %d, %v", path, i+1, err)
+		}
+		j.records++
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal %s, %v", path, err)
+	}
+	j.file = file
+
+	// the new records must start on a new line, so the torn record is removed
+	if len(data) != 0 && data[len(data)-1] != '\n' {
+		if torn {
+			err = file.Truncate(int64(bytes.LastIndexByte(data, '\n') + 1))
+		} else {
+			_, err = file.Write([]byte("\n"))
+		}
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to repair journal %s, %v", path, err)
+		}
+	}
+
+	return j, nil
+}
+
+// Append appends a record to the journal and syncs it to the disk.
+func (j *Journal) Append(record interface{}) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal journal record, %v", err)
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal %s, %v", j.path, err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync journal %s, %v", j.path, err)
+	}
+	j.records++
+	return nil
+}
+
+// NeedsCompaction returns true if the journal has grown to more than twice the live records of the state.
+func (j *Journal) NeedsCompaction(live int) bool {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	return j.records > minCompactionRecords && j.records > 2*live
+}
+
+// Compact replaces the journal with the snapshot records of the state, the caller must not append records while the
+// snapshot is taken and compacted. The snapshot is written to a temporary file that is renamed to the journal file,
+// so the journal is not corrupted if the source crashes while compacting.
+func (j *Journal) Compact(snapshot []interface{}) error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(j.path), filepath.Base(j.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary journal file, %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	writer := bufio.NewWriter(tmpFile)
+	for _, record := range snapshot {
+		data, err := json.Marshal(record)
+		if err != nil {
+			tmpFile.Close()
+			return fmt.Errorf("failed to marshal journal record, %v", err)
+		}
+		writer.Write(append(data, '\n'))
+	}
+	if err := writer.Flush(); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to write temporary journal file, %v", err)
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to sync temporary journal file, %v", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary journal file, %v", err)
+	}
+
+	if err := os.Rename(tmpFile.Name(), j.path); err != nil {
+		return fmt.Errorf("failed to write journal %s, %v", j.path, err)
+	}
+
+	file, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open journal %s, %v", j.path, err)
+	}
+	j.file.Close()
+	j.file = file
+	j.records = len(snapshot)
+	return nil
+}
+
+// Close closes the journal file.
+func (j *Journal) Close() error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	return j.file.Close()
+}
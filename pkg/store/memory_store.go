@@ -63,8 +63,10 @@ func (s *MemoryStore) UpdateStatus(resource *api.Resource) error {
 		return fmt.Errorf("the resource %s does not exist", resource.ResourceID)
 	}
 
-	last.Status = resource.Status
-	s.resources[resource.ResourceID] = last
+	// the stored resources are shared with the readers, they are replaced instead of being modified
+	updated := *last
+	updated.Status = resource.Status
+	s.resources[resource.ResourceID] = &updated
 	return nil
 }
 
@@ -77,8 +79,9 @@ func (s *MemoryStore) MarkAsDeleting(resourceID string) {
 		return
 	}
 
-	resource.DeletionTimestamp = time.Now()
-	s.resources[resourceID] = resource
+	deleting := *resource
+	deleting.DeletionTimestamp = time.Now()
+	s.resources[resourceID] = &deleting
 }
 
 func (s *MemoryStore) Delete(resourceID string) {
@@ -0,0 +1,195 @@
+package transport
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/klauspost/compress/zstd"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/types"
+)
+
+const (
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+
+	// ExtensionContentEncoding is the CloudEvents extension that carries the compression algorithm of the event
+	// data, the compressed data is sent as application/octet-stream.
+	ExtensionContentEncoding = "contentencoding"
+
+	// maxDecompressedSize limits the size of the decompressed data, so a small malicious payload can't exhaust the
+	// memory of the receiver.
+	maxDecompressedSize = 64 << 20
+)
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxDecompressedSize))
+)
+
+// CompressionOptions are the options to compress the CloudEvents data.
+type CompressionOptions struct {
+	// Algorithm is gzip or zstd, the data is not compressed if it's empty.
+	Algorithm string
+	// Threshold is the size of the data in bytes above which the data is compressed.
+	Threshold int
+	// MaxPayloadSize is the max size of the event data in bytes that the transport accepts after compression, 0
+	// means no limit.
+	MaxPayloadSize int
+}
+
+func NewCompressionOptions() *CompressionOptions {
+	return &CompressionOptions{
+		Threshold: 64 * 1024,
+	}
+}
+
+func (o *CompressionOptions) Validate() error {
+	var errs []error
+	switch o.Algorithm {
+	case "", CompressionGzip, CompressionZstd:
+	default:
+		errs = append(errs, fmt.Errorf("unsupported compression %q, it should be %s or %s",
+			o.Algorithm, CompressionGzip, CompressionZstd))
+	}
+	if o.Threshold < 0 {
+		errs = append(errs, fmt.Errorf("the compression threshold can't be negative"))
+	}
+	if o.MaxPayloadSize < 0 {
+		errs = append(errs, fmt.Errorf("the max payload size can't be negative"))
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// Compress compresses the event data if it exceeds the threshold, then checks the size of the data against the
+// max payload size.
+func (o *CompressionOptions) Compress(evt *cloudevents.Event) error {
+	data := evt.Data()
+	if o.Algorithm != "" && len(data) > o.Threshold {
+		compressed, err := compress(o.Algorithm, data)
+		if err != nil {
+			return fmt.Errorf("failed to compress the event data with %s, %v", o.Algorithm, err)
+		}
+
+		if err := evt.SetData("application/octet-stream", compressed); err != nil {
+			return err
+		}
+		evt.SetExtension(ExtensionContentEncoding, o.Algorithm)
+		data = compressed
+	}
+
+	if o.MaxPayloadSize > 0 && len(data) > o.MaxPayloadSize {
+		return fmt.Errorf("the event data is %d bytes, it exceeds the max payload size %d", len(data), o.MaxPayloadSize)
+	}
+	return nil
+}
+
+// PayloadSize returns the size of the event as it's sent, that's the size of the event data and the extensions,
+// e.g. the encrypted data key and the signature.
+func PayloadSize(evt *cloudevents.Event) int {
+	size := len(evt.Data())
+	for name, value := range evt.Extensions() {
+		size += len(name) + len(fmt.Sprintf("%v", value))
+	}
+	return size
+}
+
+// Decompress decompresses the event data if it's compressed, the data is restored as application/json.
+func Decompress(evt *cloudevents.Event) error {
+	encoding, ok := evt.Extensions()[ExtensionContentEncoding]
+	if !ok {
+		return nil
+	}
+
+	algorithm := fmt.Sprintf("%v", encoding)
+	data, err := decompress(algorithm, evt.Data())
+	if err != nil {
+		return fmt.Errorf("failed to decompress the event data with %s, %v", algorithm, err)
+	}
+
+	if err := evt.SetData(cloudevents.ApplicationJSON, data); err != nil {
+		return err
+	}
+	evt.SetExtension(ExtensionContentEncoding, nil)
+	return nil
+}
+
+func compress(algorithm string, data []byte) ([]byte, error) {
+	switch algorithm {
+	case CompressionGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case CompressionZstd:
+		return zstdEncoder.EncodeAll(data, nil), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", algorithm)
+	}
+}
+
+func decompress(algorithm string, data []byte) ([]byte, error) {
+	switch algorithm {
+	case CompressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+
+		decompressed, err := io.ReadAll(io.LimitReader(r, maxDecompressedSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(decompressed) > maxDecompressedSize {
+			return nil, fmt.Errorf("the decompressed data exceeds %d bytes", maxDecompressedSize)
+		}
+		return decompressed, nil
+	case CompressionZstd:
+		return zstdDecoder.DecodeAll(data, nil)
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", algorithm)
+	}
+}
+
+// CompressionCodec compresses the data of the encoded events and decompresses the data of the received events
+// before they are decoded, it's used by both the source and the agent.
+type CompressionCodec[T generic.ResourceObject] struct {
+	generic.Codec[T]
+	options *CompressionOptions
+}
+
+func NewCompressionCodec[T generic.ResourceObject](codec generic.Codec[T], options *CompressionOptions) *CompressionCodec[T] {
+	return &CompressionCodec[T]{Codec: codec, options: options}
+}
+
+func (c *CompressionCodec[T]) Encode(source string, eventType types.CloudEventsType, obj T) (*cloudevents.Event, error) {
+	evt, err := c.Codec.Encode(source, eventType, obj)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.options.Compress(evt); err != nil {
+		return nil, err
+	}
+	return evt, nil
+}
+
+func (c *CompressionCodec[T]) Decode(evt *cloudevents.Event) (T, error) {
+	decompressed := evt.Clone()
+	if err := Decompress(&decompressed); err != nil {
+		var obj T
+		return obj, err
+	}
+	return c.Codec.Decode(&decompressed)
+}
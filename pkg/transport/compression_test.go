@@ -0,0 +1,85 @@
+package transport
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+func TestCompressRoundTrip(t *testing.T) {
+	data := []byte(`{"manifest":"` + strings.Repeat("nginx", 100) + `"}`)
+
+	cases := []struct {
+		name               string
+		options            *CompressionOptions
+		expectedCompressed bool
+		expectedErr        string
+	}{
+		{
+			name:               "gzip",
+			options:            &CompressionOptions{Algorithm: CompressionGzip},
+			expectedCompressed: true,
+		},
+		{
+			name:               "zstd",
+			options:            &CompressionOptions{Algorithm: CompressionZstd},
+			expectedCompressed: true,
+		},
+		{
+			name:    "below the threshold",
+			options: &CompressionOptions{Algorithm: CompressionZstd, Threshold: len(data)},
+		},
+		{
+			name:    "no compression",
+			options: &CompressionOptions{},
+		},
+		{
+			name:        "exceeds the max payload size",
+			options:     &CompressionOptions{Algorithm: CompressionGzip, MaxPayloadSize: 10},
+			expectedErr: "exceeds the max payload size",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			evt := cloudevents.NewEvent()
+			if err := evt.SetData(cloudevents.ApplicationJSON, data); err != nil {
+				t.Fatal(err)
+			}
+
+			err := c.options.Compress(&evt)
+			switch {
+			case c.expectedErr == "" && err != nil:
+				t.Fatalf("unexpected error %v", err)
+			case c.expectedErr != "":
+				if err == nil || !strings.Contains(err.Error(), c.expectedErr) {
+					t.Errorf("expected error %q, but got %v", c.expectedErr, err)
+				}
+				return
+			}
+
+			_, compressed := evt.Extensions()[ExtensionContentEncoding]
+			if compressed != c.expectedCompressed {
+				t.Errorf("expected the data is compressed %t, but got %t", c.expectedCompressed, compressed)
+			}
+			if compressed && len(evt.Data()) >= len(data) {
+				t.Errorf("expected the compressed data is smaller than %d bytes, but got %d", len(data), len(evt.Data()))
+			}
+
+			if err := Decompress(&evt); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(evt.Data(), data) {
+				t.Errorf("expected the data %s, but got %s", data, evt.Data())
+			}
+			if evt.DataContentType() != cloudevents.ApplicationJSON {
+				t.Errorf("expected the content type %s, but got %s", cloudevents.ApplicationJSON, evt.DataContentType())
+			}
+			if _, ok := evt.Extensions()[ExtensionContentEncoding]; ok {
+				t.Errorf("expected the content encoding is removed")
+			}
+		})
+	}
+}
@@ -0,0 +1,415 @@
+package transport
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v2"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/options/grpc"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/options/mqtt"
+)
+
+const (
+	TransportTypeMQTT  = "mqtt"
+	TransportTypeGRPC  = "grpc"
+	TransportTypeKafka = "kafka"
+	TransportTypeHTTP  = "http"
+)
+
+// TransportConfig is the transport configuration file of the source. It's a flat document of one transport with
+// an optional `type` field, so an sdk-go MQTT or gRPC config file is a valid transport config file, e.g.
+//
+//	type: mqtt
+//	brokerHost: broker.example.com:8883
+//	caFile: /certs/ca.crt
+//	topics:
+//	  sourceEvents: sources/{{.SourceID}}/clusters/+/sourceevents
+//	  agentEvents: sources/{{.SourceID}}/clusters/+/agentevents
+//
+// If the type is not set, it's inferred from the `brokerHost` (mqtt), `url` (grpc), `bootstrapServers` (kafka) or
+// `endpoints` and `endpointTemplate` (http) field.
+type TransportConfig struct {
+	Type string `json:"type,omitempty" yaml:"type,omitempty"`
+
+	MQTT  *mqtt.MQTTConfig `json:"-" yaml:"-"`
+	GRPC  *GRPCConfig      `json:"-" yaml:"-"`
+	Kafka *KafkaConfig     `json:"-" yaml:"-"`
+	HTTP  *HTTPConfig      `json:"-" yaml:"-"`
+}
+
+// GRPCConfig is the sdk-go gRPC config with the keepalive settings.
+type GRPCConfig struct {
+	grpc.GRPCConfig `json:",inline" yaml:",inline"`
+
+	// ServerName overrides the server name that is used to verify the broker certificate.
+	ServerName string `json:"serverName,omitempty" yaml:"serverName,omitempty"`
+	// KeepAliveTime is the interval to ping the broker if there is no activity.
+	KeepAliveTime *time.Duration `json:"keepAliveTime,omitempty" yaml:"keepAliveTime,omitempty"`
+	// KeepAliveTimeout is how long to wait for the ping ack before the connection is considered broken.
+	KeepAliveTimeout *time.Duration `json:"keepAliveTimeout,omitempty" yaml:"keepAliveTimeout,omitempty"`
+	// KeepAlivePermitWithoutStream allows to ping the broker when there is no active stream.
+	KeepAlivePermitWithoutStream *bool `json:"keepAlivePermitWithoutStream,omitempty" yaml:"keepAlivePermitWithoutStream,omitempty"`
+}
+
+// KafkaConfig is the config of the Kafka transport.
+type KafkaConfig struct {
+	BootstrapServers string `json:"bootstrapServers" yaml:"bootstrapServers"`
+	GroupID          string `json:"groupID,omitempty" yaml:"groupID,omitempty"`
+	CAFile           string `json:"caFile,omitempty" yaml:"caFile,omitempty"`
+	ClientCertFile   string `json:"clientCertFile,omitempty" yaml:"clientCertFile,omitempty"`
+	ClientKeyFile    string `json:"clientKeyFile,omitempty" yaml:"clientKeyFile,omitempty"`
+	SASLMechanism    string `json:"saslMechanism,omitempty" yaml:"saslMechanism,omitempty"`
+	SASLUsername     string `json:"saslUsername,omitempty" yaml:"saslUsername,omitempty"`
+	SASLPassword     string `json:"saslPassword,omitempty" yaml:"saslPassword,omitempty"`
+}
+
+// HTTPConfig is the config of the CloudEvents HTTP transport.
+type HTTPConfig struct {
+	Endpoints        map[string]string `json:"endpoints,omitempty" yaml:"endpoints,omitempty"`
+	EndpointTemplate string            `json:"endpointTemplate,omitempty" yaml:"endpointTemplate,omitempty"`
+	CAFile           string            `json:"caFile,omitempty" yaml:"caFile,omitempty"`
+	ClientCertFile   string            `json:"clientCertFile,omitempty" yaml:"clientCertFile,omitempty"`
+	ClientKeyFile    string            `json:"clientKeyFile,omitempty" yaml:"clientKeyFile,omitempty"`
+	TokenFile        string            `json:"tokenFile,omitempty" yaml:"tokenFile,omitempty"`
+	ContentMode      string            `json:"contentMode,omitempty" yaml:"contentMode,omitempty"`
+	Timeout          *time.Duration    `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	IngestPath       string            `json:"ingestPath,omitempty" yaml:"ingestPath,omitempty"`
+	// IngestTokenFile and IngestClientCAFile authenticate the status events, one of them is required.
+	IngestTokenFile    string `json:"ingestTokenFile,omitempty" yaml:"ingestTokenFile,omitempty"`
+	IngestClientCAFile string `json:"ingestClientCAFile,omitempty" yaml:"ingestClientCAFile,omitempty"`
+	MaxBodySize        *int64 `json:"maxBodySize,omitempty" yaml:"maxBodySize,omitempty"`
+}
+
+// LoadTransportConfig loads the transport config from a YAML or JSON file.
+func LoadTransportConfig(path string) (*TransportConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transport config %s, %v", path, err)
+	}
+
+	config := &TransportConfig{}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal transport config %s, %v", path, err)
+	}
+
+	if config.Type == "" {
+		fields := map[string]interface{}{}
+		if err := yaml.Unmarshal(data, &fields); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal transport config %s, %v", path, err)
+		}
+		switch {
+		case fields["brokerHost"] != nil:
+			config.Type = TransportTypeMQTT
+		case fields["url"] != nil:
+			config.Type = TransportTypeGRPC
+		case fields["bootstrapServers"] != nil:
+			config.Type = TransportTypeKafka
+		case fields["endpoints"] != nil, fields["endpointTemplate"] != nil:
+			config.Type = TransportTypeHTTP
+		default:
+			return nil, fmt.Errorf("invalid transport config %s: the type is not set and can't be inferred", path)
+		}
+	}
+
+	switch config.Type {
+	case TransportTypeMQTT:
+		config.MQTT = &mqtt.MQTTConfig{}
+		err = unmarshalStrict(data, config.MQTT)
+	case TransportTypeGRPC:
+		config.GRPC = &GRPCConfig{}
+		err = unmarshalStrict(data, config.GRPC)
+	case TransportTypeKafka:
+		config.Kafka = &KafkaConfig{}
+		err = unmarshalStrict(data, config.Kafka)
+	case TransportTypeHTTP:
+		config.HTTP = &HTTPConfig{}
+		err = unmarshalStrict(data, config.HTTP)
+	default:
+		return nil, fmt.Errorf("invalid transport config %s: unsupported type %q, it should be mqtt, grpc, kafka or http",
+			path, config.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s transport config %s, %v", config.Type, path, err)
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid transport config %s: %v", path, err)
+	}
+
+	return config, nil
+}
+
+// unmarshalStrict unmarshals the config of the transport type strictly, so a misspelled field is reported instead of
+// being ignored, e.g. a misspelled caFile would connect without TLS. The type field is not a field of the config.
+func unmarshalStrict(data []byte, config interface{}) error {
+	fields := yaml.MapSlice{}
+	if err := yaml.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	typed := yaml.MapSlice{}
+	for _, field := range fields {
+		if field.Key != "type" {
+			typed = append(typed, field)
+		}
+	}
+	typedData, err := yaml.Marshal(typed)
+	if err != nil {
+		return err
+	}
+	return yaml.UnmarshalStrict(typedData, config)
+}
+
+// Validate validates the required fields of the config, all the errors are reported at once.
+func (c *TransportConfig) Validate() error {
+	var errs []error
+	switch {
+	case c.MQTT != nil:
+		if c.MQTT.BrokerHost == "" {
+			errs = append(errs, fmt.Errorf("brokerHost is required"))
+		}
+		if (c.MQTT.ClientCertFile == "") != (c.MQTT.ClientKeyFile == "") {
+			errs = append(errs, fmt.Errorf("either both or none of clientCertFile and clientKeyFile must be set"))
+		}
+		for name, qos := range map[string]*int{"pubQoS": c.MQTT.PubQoS, "subQoS": c.MQTT.SubQoS} {
+			if qos != nil && (*qos < 0 || *qos > 2) {
+				errs = append(errs, fmt.Errorf("%s %d should be 0, 1 or 2", name, *qos))
+			}
+		}
+		if c.MQTT.KeepAlive != nil && *c.MQTT.KeepAlive == 0 {
+			errs = append(errs, fmt.Errorf("keepAlive should be greater than 0"))
+		}
+		if c.MQTT.DialTimeout != nil && *c.MQTT.DialTimeout <= 0 {
+			errs = append(errs, fmt.Errorf("dialTimeout should be greater than 0"))
+		}
+		if c.MQTT.Topics != nil {
+			if err := validateTopicTemplates(c.MQTT.Topics); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	case c.GRPC != nil:
+		if c.GRPC.URL == "" {
+			errs = append(errs, fmt.Errorf("url is required"))
+		}
+		if (c.GRPC.ClientCertFile == "") != (c.GRPC.ClientKeyFile == "") {
+			errs = append(errs, fmt.Errorf("either both or none of clientCertFile and clientKeyFile must be set"))
+		}
+		if c.GRPC.ClientCertFile != "" && c.GRPC.CAFile == "" {
+			errs = append(errs, fmt.Errorf("setting clientCertFile and clientKeyFile requires caFile"))
+		}
+	case c.Kafka != nil:
+		if c.Kafka.BootstrapServers == "" {
+			errs = append(errs, fmt.Errorf("bootstrapServers is required"))
+		}
+		if (c.Kafka.ClientCertFile == "") != (c.Kafka.ClientKeyFile == "") {
+			errs = append(errs, fmt.Errorf("either both or none of clientCertFile and clientKeyFile must be set"))
+		}
+	case c.HTTP != nil:
+		if len(c.HTTP.Endpoints) == 0 && c.HTTP.EndpointTemplate == "" {
+			errs = append(errs, fmt.Errorf("either endpoints or endpointTemplate is required"))
+		}
+		for clusterName, endpoint := range c.HTTP.Endpoints {
+			if err := validateEndpoint(endpoint); err != nil {
+				errs = append(errs, fmt.Errorf("invalid endpoint of cluster %s, %v", clusterName, err))
+			}
+		}
+		if (c.HTTP.ClientCertFile == "") != (c.HTTP.ClientKeyFile == "") {
+			errs = append(errs, fmt.Errorf("either both or none of clientCertFile and clientKeyFile must be set"))
+		}
+		if c.HTTP.ContentMode != "" && c.HTTP.ContentMode != HTTPContentModeBinary &&
+			c.HTTP.ContentMode != HTTPContentModeStructured {
+			errs = append(errs, fmt.Errorf("contentMode %q should be %s or %s",
+				c.HTTP.ContentMode, HTTPContentModeBinary, HTTPContentModeStructured))
+		}
+		if c.HTTP.IngestTokenFile == "" && c.HTTP.IngestClientCAFile == "" {
+			errs = append(errs, fmt.Errorf("either ingestTokenFile or ingestClientCAFile is required"))
+		}
+		if c.HTTP.MaxBodySize != nil && *c.HTTP.MaxBodySize <= 0 {
+			errs = append(errs, fmt.Errorf("maxBodySize should be greater than 0"))
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// ApplyMQTT overrides the MQTT options with the config.
+func (c *TransportConfig) ApplyMQTT(o *MQTTOptions) {
+	if c.MQTT == nil {
+		return
+	}
+
+	o.BrokerHost = c.MQTT.BrokerHost
+	o.Username = c.MQTT.Username
+	o.Password = c.MQTT.Password
+	o.CAFile = c.MQTT.CAFile
+	o.ClientCertFile = c.MQTT.ClientCertFile
+	o.ClientKeyFile = c.MQTT.ClientKeyFile
+	if c.MQTT.KeepAlive != nil {
+		o.KeepAlive = time.Duration(*c.MQTT.KeepAlive) * time.Second
+	}
+	if c.MQTT.DialTimeout != nil {
+		o.DialTimeout = *c.MQTT.DialTimeout
+	}
+	if c.MQTT.PubQoS != nil {
+		o.PubQoS = *c.MQTT.PubQoS
+	}
+	if c.MQTT.SubQoS != nil {
+		o.SubQoS = *c.MQTT.SubQoS
+	}
+	if c.MQTT.Topics != nil {
+		o.Topics = *c.MQTT.Topics
+	}
+}
+
+// ApplyGRPC overrides the gRPC options with the config.
+func (c *TransportConfig) ApplyGRPC(o *GRPCOptions) {
+	if c.GRPC == nil {
+		return
+	}
+
+	o.Address = c.GRPC.URL
+	o.CAFile = c.GRPC.CAFile
+	o.ClientCertFile = c.GRPC.ClientCertFile
+	o.ClientKeyFile = c.GRPC.ClientKeyFile
+	o.ServerName = c.GRPC.ServerName
+	if c.GRPC.KeepAliveTime != nil {
+		o.KeepAliveTime = *c.GRPC.KeepAliveTime
+	}
+	if c.GRPC.KeepAliveTimeout != nil {
+		o.KeepAliveTimeout = *c.GRPC.KeepAliveTimeout
+	}
+	if c.GRPC.KeepAlivePermitWithoutStream != nil {
+		o.KeepAlivePermitWithoutStream = *c.GRPC.KeepAlivePermitWithoutStream
+	}
+}
+
+// ApplyKafka overrides the Kafka options with the config.
+func (c *TransportConfig) ApplyKafka(o *KafkaOptions) {
+	if c.Kafka == nil {
+		return
+	}
+
+	o.BootstrapServers = c.Kafka.BootstrapServers
+	o.GroupID = c.Kafka.GroupID
+	o.CAFile = c.Kafka.CAFile
+	o.ClientCertFile = c.Kafka.ClientCertFile
+	o.ClientKeyFile = c.Kafka.ClientKeyFile
+	o.SASLMechanism = c.Kafka.SASLMechanism
+	o.SASLUsername = c.Kafka.SASLUsername
+	o.SASLPassword = c.Kafka.SASLPassword
+}
+
+// ApplyHTTP overrides the HTTP options with the config.
+func (c *TransportConfig) ApplyHTTP(o *HTTPOptions) {
+	if c.HTTP == nil {
+		return
+	}
+
+	o.Endpoints = c.HTTP.Endpoints
+	o.EndpointTemplate = c.HTTP.EndpointTemplate
+	o.CAFile = c.HTTP.CAFile
+	o.ClientCertFile = c.HTTP.ClientCertFile
+	o.ClientKeyFile = c.HTTP.ClientKeyFile
+	o.TokenFile = c.HTTP.TokenFile
+	o.IngestTokenFile = c.HTTP.IngestTokenFile
+	o.IngestClientCAFile = c.HTTP.IngestClientCAFile
+	if c.HTTP.MaxBodySize != nil {
+		o.MaxBodySize = *c.HTTP.MaxBodySize
+	}
+	if c.HTTP.ContentMode != "" {
+		o.ContentMode = c.HTTP.ContentMode
+	}
+	if c.HTTP.Timeout != nil {
+		o.Timeout = *c.HTTP.Timeout
+	}
+	if c.HTTP.IngestPath != "" {
+		o.IngestPath = c.HTTP.IngestPath
+	}
+}
+
+// HTTPAgentConfig is the config file of the HTTP transport of the agent. The agent POSTs the status events to the
+// ingest URL of the source and serves the spec events over TLS on the listen address, e.g.
+//
+//	ingestURL: https://source.example.com:8080/cloudevents
+//	listenAddress: :8443
+//	tlsCertFile: /certs/tls.crt
+//	tlsKeyFile: /certs/tls.key
+//	tokenFile: /secrets/source-token
+//	ingestClientCAFile: /certs/source-ca.crt
+type HTTPAgentConfig struct {
+	IngestURL     string `json:"ingestURL" yaml:"ingestURL"`
+	ListenAddress string `json:"listenAddress" yaml:"listenAddress"`
+	// Path is the path of the route that receives the spec events, /cloudevents by default.
+	Path        string `json:"path,omitempty" yaml:"path,omitempty"`
+	TLSCertFile string `json:"tlsCertFile" yaml:"tlsCertFile"`
+	TLSKeyFile  string `json:"tlsKeyFile" yaml:"tlsKeyFile"`
+
+	CAFile             string         `json:"caFile,omitempty" yaml:"caFile,omitempty"`
+	ClientCertFile     string         `json:"clientCertFile,omitempty" yaml:"clientCertFile,omitempty"`
+	ClientKeyFile      string         `json:"clientKeyFile,omitempty" yaml:"clientKeyFile,omitempty"`
+	TokenFile          string         `json:"tokenFile,omitempty" yaml:"tokenFile,omitempty"`
+	ContentMode        string         `json:"contentMode,omitempty" yaml:"contentMode,omitempty"`
+	Timeout            *time.Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	IngestTokenFile    string         `json:"ingestTokenFile,omitempty" yaml:"ingestTokenFile,omitempty"`
+	IngestClientCAFile string         `json:"ingestClientCAFile,omitempty" yaml:"ingestClientCAFile,omitempty"`
+	MaxBodySize        *int64         `json:"maxBodySize,omitempty" yaml:"maxBodySize,omitempty"`
+}
+
+// LoadHTTPAgentConfig loads the HTTP transport config of the agent from a YAML or JSON file.
+func LoadHTTPAgentConfig(path string) (*HTTPAgentConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HTTP agent config %s, %v", path, err)
+	}
+
+	config := &HTTPAgentConfig{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal HTTP agent config %s, %v", path, err)
+	}
+
+	var errs []error
+	if err := validateEndpoint(config.IngestURL); err != nil {
+		errs = append(errs, fmt.Errorf("invalid ingestURL, %v", err))
+	}
+	if config.ListenAddress == "" {
+		errs = append(errs, fmt.Errorf("listenAddress is required"))
+	}
+	if config.TLSCertFile == "" || config.TLSKeyFile == "" {
+		errs = append(errs, fmt.Errorf("tlsCertFile and tlsKeyFile are required"))
+	}
+	if err := config.HTTPOptions().validateAgent(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := utilerrors.NewAggregate(errs); err != nil {
+		return nil, fmt.Errorf("invalid HTTP agent config %s: %v", path, err)
+	}
+
+	return config, nil
+}
+
+// HTTPOptions returns the HTTP options of the agent, the ingest path is the path of the spec events route.
+func (c *HTTPAgentConfig) HTTPOptions() *HTTPOptions {
+	o := NewHTTPOptions()
+	o.CAFile = c.CAFile
+	o.ClientCertFile = c.ClientCertFile
+	o.ClientKeyFile = c.ClientKeyFile
+	o.TokenFile = c.TokenFile
+	o.IngestTokenFile = c.IngestTokenFile
+	o.IngestClientCAFile = c.IngestClientCAFile
+	if c.Path != "" {
+		o.IngestPath = c.Path
+	}
+	if c.ContentMode != "" {
+		o.ContentMode = c.ContentMode
+	}
+	if c.Timeout != nil {
+		o.Timeout = *c.Timeout
+	}
+	if c.MaxBodySize != nil {
+		o.MaxBodySize = *c.MaxBodySize
+	}
+	return o
+}
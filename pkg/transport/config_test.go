@@ -0,0 +1,126 @@
+package transport
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadTransportConfig(t *testing.T) {
+	cases := []struct {
+		name         string
+		config       string
+		expectedType string
+		expectedErr  string
+	}{
+		{
+			name:         "infer mqtt",
+			config:       "brokerHost: broker.example.com:8883\ncaFile: /certs/ca.crt\n",
+			expectedType: TransportTypeMQTT,
+		},
+		{
+			name:         "infer grpc",
+			config:       "url: broker.example.com:8090\nkeepAliveTime: 30s\n",
+			expectedType: TransportTypeGRPC,
+		},
+		{
+			name:         "infer kafka",
+			config:       "bootstrapServers: kafka.example.com:9092\n",
+			expectedType: TransportTypeKafka,
+		},
+		{
+			name:         "infer http",
+			config:       "endpointTemplate: https://{{.ClusterName}}.example.com/cloudevents\ningestTokenFile: /token\n",
+			expectedType: TransportTypeHTTP,
+		},
+		{
+			name:         "explicit type",
+			config:       `{"type": "mqtt", "brokerHost": "broker.example.com:8883"}`,
+			expectedType: TransportTypeMQTT,
+		},
+		{
+			name:        "type can't be inferred",
+			config:      "caFile: /certs/ca.crt\n",
+			expectedErr: "the type is not set and can't be inferred",
+		},
+		{
+			name:        "unsupported type",
+			config:      "type: amqp\nbrokerHost: broker.example.com:5672\n",
+			expectedErr: `unsupported type "amqp"`,
+		},
+		{
+			name:        "misspelled field",
+			config:      "brokerHost: broker.example.com:8883\ncaFlie: /certs/ca.crt\n",
+			expectedErr: "field caFlie not found",
+		},
+		{
+			name:        "field of another type",
+			config:      "type: grpc\nurl: broker.example.com:8090\nbrokerHost: broker.example.com:8883\n",
+			expectedErr: "field brokerHost not found",
+		},
+		{
+			name:        "mqtt validation errors",
+			config:      "type: mqtt\nclientCertFile: /certs/tls.crt\npubQoS: 3\n",
+			expectedErr: "brokerHost is required, either both or none of clientCertFile and clientKeyFile must be set, pubQoS 3 should be 0, 1 or 2",
+		},
+		{
+			name:        "grpc validation errors",
+			config:      "url: broker.example.com:8090\nclientCertFile: /certs/tls.crt\nclientKeyFile: /certs/tls.key\n",
+			expectedErr: "setting clientCertFile and clientKeyFile requires caFile",
+		},
+		{
+			name:        "http validation errors",
+			config:      "endpoints:\n  cluster1: ftp://cluster1.example.com\ncontentMode: text\n",
+			expectedErr: `invalid endpoint of cluster cluster1, the scheme of "ftp://cluster1.example.com" should be http or https`,
+		},
+		{
+			name:        "http without ingest authentication",
+			config:      "endpointTemplate: https://{{.ClusterName}}.example.com/cloudevents\n",
+			expectedErr: "either ingestTokenFile or ingestClientCAFile is required",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "transport.yaml")
+			if err := os.WriteFile(path, []byte(c.config), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			config, err := LoadTransportConfig(path)
+			switch {
+			case c.expectedErr == "" && err != nil:
+				t.Fatalf("unexpected error %v", err)
+			case c.expectedErr != "" && (err == nil || !strings.Contains(err.Error(), c.expectedErr)):
+				t.Fatalf("expected error %q, but got %v", c.expectedErr, err)
+			case c.expectedErr != "":
+				return
+			}
+
+			if config.Type != c.expectedType {
+				t.Errorf("expected type %s, but got %s", c.expectedType, config.Type)
+			}
+		})
+	}
+}
+
+func TestApplyTransportConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "transport.yaml")
+	if err := os.WriteFile(path, []byte("type: grpc\nurl: broker.example.com:8090\ncaFile: /certs/ca.crt\n"+
+		"serverName: broker\nkeepAliveTime: 30s\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadTransportConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := NewGRPCOptions()
+	config.ApplyGRPC(o)
+	if o.Address != "broker.example.com:8090" || o.CAFile != "/certs/ca.crt" || o.ServerName != "broker" ||
+		o.KeepAliveTime.String() != "30s" {
+		t.Errorf("unexpected gRPC options %+v", o)
+	}
+}
@@ -0,0 +1,191 @@
+package transport
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cloudeventstypes "github.com/cloudevents/sdk-go/v2/types"
+
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/types"
+)
+
+const (
+	// ExtensionEncryptionKeyID is the CloudEvents extension that carries the ID of the cluster key that the data key
+	// is encrypted with.
+	ExtensionEncryptionKeyID = "encryptionkeyid"
+	// ExtensionEncryptedDataKey is the CloudEvents extension that carries the encrypted data key in base64.
+	ExtensionEncryptedDataKey = "encrypteddatakey"
+)
+
+// Encrypt encrypts the event data with a random data key, the data key is encrypted with the current key of the
+// cluster. The cluster name and the resource ID of the event are authenticated with the data, so the data can't be
+// replayed for another resource.
+func (k *Keyring) Encrypt(evt *cloudevents.Event) error {
+	data := evt.Data()
+	if len(data) == 0 {
+		return nil
+	}
+
+	clusterName, additionalData, err := authenticatedData(evt)
+	if err != nil {
+		return err
+	}
+
+	keys := k.encryptionKeys(clusterName)
+	if len(keys) == 0 {
+		return fmt.Errorf("no encryption key of the cluster %s", clusterName)
+	}
+	key := keys[0]
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return fmt.Errorf("failed to generate data key, %v", err)
+	}
+	encryptedDataKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, key.publicKey, dataKey, []byte(key.id))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt data key with key %s, %v", key.id, err)
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce, %v", err)
+	}
+
+	if err := evt.SetData("application/octet-stream", aead.Seal(nonce, nonce, data, additionalData)); err != nil {
+		return err
+	}
+	evt.SetExtension(ExtensionEncryptionKeyID, key.id)
+	evt.SetExtension(ExtensionEncryptedDataKey, base64.StdEncoding.EncodeToString(encryptedDataKey))
+	return nil
+}
+
+// Decrypt decrypts the event data if it's encrypted, the data is restored as application/json.
+func (k *Keyring) Decrypt(evt *cloudevents.Event) error {
+	extensions := evt.Extensions()
+	if _, ok := extensions[ExtensionEncryptionKeyID]; !ok {
+		return nil
+	}
+
+	keyID, err := cloudeventstypes.ToString(extensions[ExtensionEncryptionKeyID])
+	if err != nil {
+		return fmt.Errorf("failed to get encryptionkeyid extension: %v", err)
+	}
+	encodedDataKey, err := cloudeventstypes.ToString(extensions[ExtensionEncryptedDataKey])
+	if err != nil {
+		return fmt.Errorf("failed to get encrypteddatakey extension: %v", err)
+	}
+	encryptedDataKey, err := base64.StdEncoding.DecodeString(encodedDataKey)
+	if err != nil {
+		return fmt.Errorf("failed to decode encrypteddatakey extension: %v", err)
+	}
+
+	clusterName, additionalData, err := authenticatedData(evt)
+	if err != nil {
+		return err
+	}
+
+	var key *encryptionKey
+	for _, candidate := range k.encryptionKeys(clusterName) {
+		if candidate.id == keyID {
+			key = &candidate
+			break
+		}
+	}
+	if key == nil || key.privateKey == nil {
+		return fmt.Errorf("no decryption key %s of the cluster %s", keyID, clusterName)
+	}
+
+	dataKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, key.privateKey, encryptedDataKey, []byte(key.id))
+	if err != nil {
+		return fmt.Errorf("failed to decrypt data key with key %s, %v", key.id, err)
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+	encrypted := evt.Data()
+	if len(encrypted) < aead.NonceSize() {
+		return fmt.Errorf("the encrypted data is too short")
+	}
+	data, err := aead.Open(nil, encrypted[:aead.NonceSize()], encrypted[aead.NonceSize():], additionalData)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt the event data with key %s, %v", key.id, err)
+	}
+
+	if err := evt.SetData(cloudevents.ApplicationJSON, data); err != nil {
+		return err
+	}
+	evt.SetExtension(ExtensionEncryptionKeyID, nil)
+	evt.SetExtension(ExtensionEncryptedDataKey, nil)
+	return nil
+}
+
+func authenticatedData(evt *cloudevents.Event) (string, []byte, error) {
+	extensions := evt.Extensions()
+	clusterName, err := cloudeventstypes.ToString(extensions[types.ExtensionClusterName])
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get clustername extension: %v", err)
+	}
+	resourceID, err := cloudeventstypes.ToString(extensions[types.ExtensionResourceID])
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get resourceid extension: %v", err)
+	}
+	return clusterName, []byte(clusterName + "/" + resourceID), nil
+}
+
+func newAEAD(dataKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher, %v", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptionCodec encrypts the data of the encoded spec events with the keyring, and decrypts the data of the
+// received events before they are decoded. The source encrypts the spec events with the public keys of the
+// clusters, and the agent decrypts them with the private key of its cluster. The status events are not encrypted.
+type EncryptionCodec[T generic.ResourceObject] struct {
+	generic.Codec[T]
+	keyring *Keyring
+}
+
+func NewEncryptionCodec[T generic.ResourceObject](codec generic.Codec[T], keyring *Keyring) *EncryptionCodec[T] {
+	return &EncryptionCodec[T]{Codec: codec, keyring: keyring}
+}
+
+func (c *EncryptionCodec[T]) Encode(source string, eventType types.CloudEventsType, obj T) (*cloudevents.Event, error) {
+	evt, err := c.Codec.Encode(source, eventType, obj)
+	if err != nil {
+		return nil, err
+	}
+
+	if eventType.SubResource != types.SubResourceSpec {
+		return evt, nil
+	}
+
+	if err := c.keyring.Encrypt(evt); err != nil {
+		return nil, err
+	}
+	return evt, nil
+}
+
+func (c *EncryptionCodec[T]) Decode(evt *cloudevents.Event) (T, error) {
+	decrypted := evt.Clone()
+	if err := c.keyring.Decrypt(&decrypted); err != nil {
+		var obj T
+		return obj, err
+	}
+	return c.Codec.Decode(&decrypted)
+}
@@ -0,0 +1,191 @@
+package transport
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cloudeventstypes "github.com/cloudevents/sdk-go/v2/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubetypes "k8s.io/apimachinery/pkg/types"
+	workv1 "open-cluster-management.io/api/work/v1"
+
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/types"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/work/payload"
+)
+
+func TestEncryptionCodec(t *testing.T) {
+	oldKey, err := NewKeyringKey("cluster1-old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := NewKeyringKey("cluster1-new")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the agent keeps the old key to decrypt the events in flight once the source is rotated to the new key
+	agentKeyring := writeTestKeyring(t, KeyringConfig{Clusters: map[string][]KeyringKey{
+		"cluster1": {newKey, oldKey},
+		"cluster2": {newKey},
+	}})
+	agentCodec := NewEncryptionCodec[*workv1.ManifestWork](&testWorkCodec{}, agentKeyring)
+
+	cases := []struct {
+		name        string
+		sourceKeys  []KeyringKey
+		tamper      func(evt *cloudevents.Event)
+		expectedErr string
+	}{
+		{
+			name:       "current key",
+			sourceKeys: []KeyringKey{newKey, oldKey},
+		},
+		{
+			name:       "old key before the rotation",
+			sourceKeys: []KeyringKey{oldKey},
+		},
+		{
+			name:        "key that the agent doesn't have",
+			sourceKeys:  []KeyringKey{mustNewKeyringKey(t, "cluster1-unknown")},
+			expectedErr: "no decryption key cluster1-unknown",
+		},
+		{
+			name:       "swapped resource ID",
+			sourceKeys: []KeyringKey{newKey},
+			tamper: func(evt *cloudevents.Event) {
+				evt.SetExtension(types.ExtensionResourceID, "another-resource")
+			},
+			expectedErr: "failed to decrypt the event data",
+		},
+		{
+			name:       "swapped cluster",
+			sourceKeys: []KeyringKey{newKey},
+			tamper: func(evt *cloudevents.Event) {
+				evt.SetExtension(types.ExtensionClusterName, "cluster2")
+			},
+			expectedErr: "failed to decrypt the event data",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			sourceKeys := []KeyringKey{}
+			for _, key := range c.sourceKeys {
+				sourceKeys = append(sourceKeys, KeyringKey{ID: key.ID, PublicKey: key.PublicKey})
+			}
+			sourceKeyring := writeTestKeyring(t, KeyringConfig{Clusters: map[string][]KeyringKey{"cluster1": sourceKeys}})
+			sourceCodec := NewEncryptionCodec[*workv1.ManifestWork](&testWorkCodec{}, sourceKeyring)
+
+			work := newTestWork()
+			evt, err := sourceCodec.Encode("source", types.CloudEventsType{
+				CloudEventsDataType: payload.ManifestEventDataType,
+				SubResource:         types.SubResourceSpec,
+				Action:              "create_request",
+			}, work)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if keyID := evt.Extensions()[ExtensionEncryptionKeyID]; keyID != c.sourceKeys[0].ID {
+				t.Errorf("expected the data is encrypted with key %s, but got %v", c.sourceKeys[0].ID, keyID)
+			}
+			if strings.Contains(string(evt.Data()), "nginx") {
+				t.Errorf("expected the data is encrypted, but got %s", evt.Data())
+			}
+			if c.tamper != nil {
+				c.tamper(evt)
+			}
+
+			decoded, err := agentCodec.Decode(evt)
+			switch {
+			case c.expectedErr == "" && err != nil:
+				t.Fatalf("unexpected error %v", err)
+			case c.expectedErr != "":
+				if err == nil || !strings.Contains(err.Error(), c.expectedErr) {
+					t.Errorf("expected error %q, but got %v", c.expectedErr, err)
+				}
+				return
+			}
+			if !reflect.DeepEqual(decoded.Spec, work.Spec) {
+				t.Errorf("expected the spec %v, but got %v", work.Spec, decoded.Spec)
+			}
+		})
+	}
+}
+
+func TestEncryptWithoutClusterKey(t *testing.T) {
+	keyring := writeTestKeyring(t, KeyringConfig{Clusters: map[string][]KeyringKey{
+		"cluster1": {mustNewKeyringKey(t, "cluster1-key")},
+	}})
+
+	evt, err := (&testWorkCodec{}).Encode("source", types.CloudEventsType{}, newTestWork())
+	if err != nil {
+		t.Fatal(err)
+	}
+	evt.SetExtension(types.ExtensionClusterName, "cluster2")
+	if err := keyring.Encrypt(evt); err == nil || !strings.Contains(err.Error(), "no encryption key") {
+		t.Errorf("expected the event of a cluster without a key fails to be encrypted, but got %v", err)
+	}
+}
+
+// testWorkCodec encodes the spec of a manifest work as the event data, and the namespace and the UID as the
+// clustername and resourceid extensions.
+type testWorkCodec struct{}
+
+func (c *testWorkCodec) EventDataType() types.CloudEventsDataType {
+	return payload.ManifestEventDataType
+}
+
+func (c *testWorkCodec) Encode(source string, eventType types.CloudEventsType, work *workv1.ManifestWork) (*cloudevents.Event, error) {
+	evt := cloudevents.NewEvent()
+	evt.SetSource(source)
+	evt.SetType(eventType.String())
+	evt.SetExtension(types.ExtensionClusterName, work.Namespace)
+	evt.SetExtension(types.ExtensionResourceID, string(work.UID))
+	if err := evt.SetData(cloudevents.ApplicationJSON, work.Spec); err != nil {
+		return nil, err
+	}
+	return &evt, nil
+}
+
+func (c *testWorkCodec) Decode(evt *cloudevents.Event) (*workv1.ManifestWork, error) {
+	clusterName, err := cloudeventstypes.ToString(evt.Extensions()[types.ExtensionClusterName])
+	if err != nil {
+		return nil, err
+	}
+	resourceID, err := cloudeventstypes.ToString(evt.Extensions()[types.ExtensionResourceID])
+	if err != nil {
+		return nil, err
+	}
+
+	work := &workv1.ManifestWork{
+		ObjectMeta: metav1.ObjectMeta{Namespace: clusterName, UID: kubetypes.UID(resourceID)},
+	}
+	if err := json.Unmarshal(evt.Data(), &work.Spec); err != nil {
+		return nil, err
+	}
+	return work, nil
+}
+
+func newTestWork() *workv1.ManifestWork {
+	return &workv1.ManifestWork{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "cluster1", UID: "2b2a1d5e-3d4f-5c6e-8a7b-9c0d1e2f3a4b"},
+		Spec: workv1.ManifestWorkSpec{
+			DeleteOption: &workv1.DeleteOption{PropagationPolicy: workv1.DeletePropagationPolicyTypeOrphan},
+			Workload: workv1.ManifestsTemplate{Manifests: []workv1.Manifest{
+				{RawExtension: runtime.RawExtension{Raw: []byte(`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"nginx"}}`)}},
+			}},
+		},
+	}
+}
+
+func mustNewKeyringKey(t *testing.T, id string) KeyringKey {
+	key, err := NewKeyringKey(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
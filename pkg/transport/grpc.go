@@ -0,0 +1,180 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/options"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/options/cert"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/options/grpc/protocol"
+)
+
+// GRPCOptions holds the options that are used to connect the source to a gRPC CloudEvents broker.
+type GRPCOptions struct {
+	// Address is the address of the gRPC broker (host:port).
+	Address string
+
+	// CAFile is the file path to a cert file for the gRPC broker certificate authority, the connection uses TLS
+	// if it's set.
+	CAFile string
+	// ClientCertFile is the file path to a client cert file for mTLS.
+	ClientCertFile string
+	// ClientKeyFile is the file path to a client key file for mTLS.
+	ClientKeyFile string
+	// ServerName overrides the server name that is used to verify the broker certificate.
+	ServerName string
+
+	// KeepAliveTime is the interval to ping the broker if there is no activity.
+	KeepAliveTime time.Duration
+	// KeepAliveTimeout is how long to wait for the ping ack before the connection is considered broken.
+	KeepAliveTimeout time.Duration
+	// KeepAlivePermitWithoutStream allows to ping the broker when there is no active stream.
+	KeepAlivePermitWithoutStream bool
+}
+
+func NewGRPCOptions() *GRPCOptions {
+	return &GRPCOptions{
+		Address:          "localhost:8090",
+		KeepAliveTime:    30 * time.Second,
+		KeepAliveTimeout: 10 * time.Second,
+	}
+}
+
+// Validate validates the gRPC options.
+func (o *GRPCOptions) Validate() error {
+	if o.Address == "" {
+		return fmt.Errorf("the gRPC address is required")
+	}
+
+	if (o.ClientCertFile == "") != (o.ClientKeyFile == "") {
+		return fmt.Errorf("either both or none of gRPC client cert file and client key file must be set")
+	}
+
+	if o.ClientCertFile != "" && o.CAFile == "" {
+		return fmt.Errorf("setting gRPC client cert file and client key file requires CA file")
+	}
+
+	return nil
+}
+
+// DialOptions returns the gRPC dial options to connect to the broker.
+func (o *GRPCOptions) DialOptions() ([]grpc.DialOption, error) {
+	dialOptions := []grpc.DialOption{
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                o.KeepAliveTime,
+			Timeout:             o.KeepAliveTimeout,
+			PermitWithoutStream: o.KeepAlivePermitWithoutStream,
+		}),
+	}
+
+	if o.CAFile == "" {
+		return append(dialOptions, grpc.WithTransportCredentials(insecure.NewCredentials())), nil
+	}
+
+	caPEM, err := os.ReadFile(o.CAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	certPool := x509.NewCertPool()
+	if ok := certPool.AppendCertsFromPEM(caPEM); !ok {
+		return nil, fmt.Errorf("invalid CA %s", o.CAFile)
+	}
+
+	tlsConfig := &tls.Config{
+		RootCAs:    certPool,
+		ServerName: o.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if o.ClientCertFile != "" {
+		// reload the client certificate if the files are rotated
+		loadCert := cert.CachingCertificateLoader(o.ClientCertFile, o.ClientKeyFile)
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return loadCert()
+		}
+	}
+
+	return append(dialOptions, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))), nil
+}
+
+type grpcSourceOptions struct {
+	GRPCOptions
+	errorChan chan error
+	sourceID  string
+}
+
+// NewGRPCSourceOptions returns the CloudEvents source options that send and receive events over gRPC.
+func NewGRPCSourceOptions(grpcOptions *GRPCOptions, sourceID string) *options.CloudEventsSourceOptions {
+	return &options.CloudEventsSourceOptions{
+		CloudEventsOptions: &grpcSourceOptions{
+			GRPCOptions: *grpcOptions,
+			errorChan:   make(chan error),
+			sourceID:    sourceID,
+		},
+		SourceID: sourceID,
+	}
+}
+
+func (o *grpcSourceOptions) WithContext(ctx context.Context, evtCtx cloudevents.EventContext) (context.Context, error) {
+	// the broker routes the events by their extensions, the context is not changed
+	return ctx, nil
+}
+
+func (o *grpcSourceOptions) Protocol(ctx context.Context) (options.CloudEventsProtocol, error) {
+	dialOptions, err := o.DialOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := grpc.Dial(o.Address, dialOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to grpc broker %s, %v", o.Address, err)
+	}
+
+	// watch the connection state and report the error once the connection is broken, the client reconnects with
+	// a new protocol on the error.
+	go func() {
+		defer conn.Close()
+
+		connected := false
+		for {
+			state := conn.GetState()
+			switch {
+			case state == connectivity.Ready:
+				connected = true
+			case state == connectivity.TransientFailure, state == connectivity.Shutdown,
+				connected && state == connectivity.Idle:
+				select {
+				case o.errorChan <- fmt.Errorf("grpc connection is disconnected (state=%s)", state):
+				case <-ctx.Done():
+				}
+				return
+			}
+
+			if !conn.WaitForStateChange(ctx, state) {
+				// the ctx is done
+				return
+			}
+		}
+	}()
+
+	return protocol.NewProtocol(conn, protocol.WithSubscribeOption(&protocol.SubscribeOption{
+		Source: o.sourceID,
+	}))
+}
+
+func (o *grpcSourceOptions) ErrorChan() <-chan error {
+	return o.errorChan
+}
@@ -0,0 +1,132 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+
+	"github.com/cloudevents/sdk-go/v2/binding"
+	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+
+	pbv1 "open-cluster-management.io/sdk-go/pkg/cloudevents/generic/options/grpc/protobuf/v1"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/options/grpc/protocol"
+)
+
+// GRPCBroker is a minimal in-process gRPC CloudEvents broker. It forwards the spec events and the status resync
+// requests from the sources to the agents subscribed with the event's cluster name, and forwards the status events
+// and the spec resync requests from the agents to the sources subscribed with the event's original source.
+// It's a stand-in for a real broker to run the source and agents in one process.
+type GRPCBroker struct {
+	pbv1.UnimplementedCloudEventServiceServer
+	sync.RWMutex
+
+	server      *grpc.Server
+	subscribers map[string]*grpcSubscriber
+}
+
+type grpcSubscriber struct {
+	source      string
+	clusterName string
+	events      chan *pbv1.CloudEvent
+	// done is closed when the subscriber is unsubscribed
+	done chan struct{}
+}
+
+func NewGRPCBroker(opts ...grpc.ServerOption) *GRPCBroker {
+	b := &GRPCBroker{
+		server:      grpc.NewServer(opts...),
+		subscribers: make(map[string]*grpcSubscriber),
+	}
+	pbv1.RegisterCloudEventServiceServer(b.server, b)
+	return b
+}
+
+// Start serves the broker on the given address until the ctx is done.
+func (b *GRPCBroker) Start(ctx context.Context, addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s, %v", addr, err)
+	}
+	return b.Serve(ctx, lis)
+}
+
+// Serve serves the broker on the given listener until the ctx is done.
+func (b *GRPCBroker) Serve(ctx context.Context, lis net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		b.server.Stop()
+	}()
+
+	log.Printf("Starting gRPC broker on %s", lis.Addr())
+	return b.server.Serve(lis)
+}
+
+func (b *GRPCBroker) Publish(ctx context.Context, req *pbv1.PublishRequest) (*empty.Empty, error) {
+	evt, err := binding.ToEvent(ctx, protocol.NewMessage(req.Event))
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert protobuf to cloudevent, %v", err)
+	}
+
+	toAgents, err := routeToAgents(*evt)
+	if err != nil {
+		return nil, err
+	}
+
+	// the event is sent outside the lock, so a slow subscriber doesn't block the others to subscribe or unsubscribe
+	b.RLock()
+	subscribers := []*grpcSubscriber{}
+	for _, sub := range b.subscribers {
+		if subscribed(*evt, toAgents, sub.source, sub.clusterName) {
+			subscribers = append(subscribers, sub)
+		}
+	}
+	b.RUnlock()
+
+	for _, sub := range subscribers {
+		select {
+		case sub.events <- req.Event:
+		case <-sub.done:
+			// the subscriber is gone
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return &empty.Empty{}, nil
+}
+
+func (b *GRPCBroker) Subscribe(req *pbv1.SubscriptionRequest, stream pbv1.CloudEventService_SubscribeServer) error {
+	id := uuid.New().String()
+	sub := &grpcSubscriber{
+		source:      req.Source,
+		clusterName: req.ClusterName,
+		events:      make(chan *pbv1.CloudEvent, 100),
+		done:        make(chan struct{}),
+	}
+
+	b.Lock()
+	b.subscribers[id] = sub
+	b.Unlock()
+
+	defer func() {
+		b.Lock()
+		delete(b.subscribers, id)
+		b.Unlock()
+		close(sub.done)
+	}()
+
+	for {
+		select {
+		case evt := <-sub.events:
+			if err := stream.Send(evt); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
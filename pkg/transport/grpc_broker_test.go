@@ -0,0 +1,80 @@
+package transport
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/binding"
+
+	pbv1 "open-cluster-management.io/sdk-go/pkg/cloudevents/generic/options/grpc/protobuf/v1"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/options/grpc/protocol"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/types"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/work/payload"
+)
+
+func TestGRPCBrokerSlowSubscriber(t *testing.T) {
+	b := NewGRPCBroker()
+	// the subscriber of cluster1 doesn't receive the events
+	b.subscribers["slow"] = &grpcSubscriber{
+		source:      types.SourceAll,
+		clusterName: "cluster1",
+		events:      make(chan *pbv1.CloudEvent),
+		done:        make(chan struct{}),
+	}
+
+	evt := cloudevents.NewEvent()
+	evt.SetID("1")
+	evt.SetSource("source")
+	evt.SetType(types.CloudEventsType{
+		CloudEventsDataType: payload.ManifestEventDataType,
+		SubResource:         types.SubResourceSpec,
+		Action:              "create_request",
+	}.String())
+	evt.SetExtension(types.ExtensionClusterName, "cluster1")
+	pbEvt := &pbv1.CloudEvent{}
+	if err := protocol.WritePBMessage(context.Background(), binding.ToMessage(&evt), pbEvt); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	published := make(chan error)
+	go func() {
+		_, err := b.Publish(ctx, &pbv1.PublishRequest{Event: pbEvt})
+		published <- err
+	}()
+
+	// the others can subscribe and unsubscribe while the publish is blocked by the slow subscriber
+	locked := make(chan struct{})
+	go func() {
+		b.Lock()
+		b.subscribers["other"] = &grpcSubscriber{}
+		delete(b.subscribers, "other")
+		b.Unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatalf("expected the subscribers are not locked by the blocked publish")
+	}
+
+	select {
+	case err := <-published:
+		t.Fatalf("expected the publish is blocked by the slow subscriber, but got %v", err)
+	default:
+	}
+
+	// the publish returns once the slow subscriber is unsubscribed
+	close(b.subscribers["slow"].done)
+	select {
+	case err := <-published:
+		if err != nil {
+			t.Errorf("unexpected error %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("expected the publish returns after the subscriber is unsubscribed")
+	}
+	cancel()
+}
@@ -0,0 +1,592 @@
+package transport
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/binding"
+	cecontext "github.com/cloudevents/sdk-go/v2/context"
+	"github.com/cloudevents/sdk-go/v2/protocol"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/options"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/options/cert"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/types"
+)
+
+const (
+	// HTTPContentModeBinary sends the event attributes as the `ce-` headers and the event data as the body.
+	HTTPContentModeBinary = "binary"
+	// HTTPContentModeStructured sends the whole event as a `application/cloudevents+json` body.
+	HTTPContentModeStructured = "structured"
+)
+
+// HTTPOptions holds the options of the CloudEvents HTTP transport. The source POSTs the spec events to the endpoint
+// of each cluster, and the agents POST the status events to the ingest path of the source API server, so the
+// clusters that only allow HTTPS can be managed without a broker.
+type HTTPOptions struct {
+	// Endpoints maps the cluster names to the URLs that the spec events of the clusters are POSTed to.
+	Endpoints map[string]string
+	// EndpointTemplate is the template of the endpoint URL of the clusters that are not in the endpoints, it's
+	// rendered with the cluster name and the source ID, e.g. `https://{{.ClusterName}}.example.com/cloudevents`.
+	EndpointTemplate string
+
+	// CAFile is the file path to a cert file for the endpoint certificate authority, the system cert pool is used
+	// if it's not set.
+	CAFile string
+	// ClientCertFile is the file path to a client cert file for mTLS, the client cert is reloaded when it's
+	// rotated.
+	ClientCertFile string
+	// ClientKeyFile is the file path to a client key file for mTLS.
+	ClientKeyFile string
+	// TokenFile is the file path to a bearer token that is sent with the POST requests.
+	TokenFile string
+
+	// ContentMode is the CloudEvents content mode of the spec events, binary or structured.
+	ContentMode string
+	// Timeout is the timeout of a POST request.
+	Timeout time.Duration
+
+	// IngestPath is the path of the API server route that receives the status events.
+	IngestPath string
+	// IngestTokenFile is the file path to the bearer token that the ingest requests must carry.
+	IngestTokenFile string
+	// IngestClientCAFile is the file path to the CA that verifies the client certs of the ingest requests, the
+	// common name of the client cert must match the cluster name of the status events, or the source of the spec
+	// events on the agent.
+	IngestClientCAFile string
+	// MaxBodySize is the max size of an ingest request body in bytes.
+	MaxBodySize int64
+}
+
+// endpointData is the data to render the endpoint template.
+type endpointData struct {
+	ClusterName string
+	SourceID    string
+}
+
+func NewHTTPOptions() *HTTPOptions {
+	return &HTTPOptions{
+		ContentMode: HTTPContentModeBinary,
+		Timeout:     10 * time.Second,
+		IngestPath:  "/cloudevents",
+		MaxBodySize: 10 << 20,
+	}
+}
+
+// Validate validates the HTTP options.
+func (o *HTTPOptions) Validate() error {
+	if len(o.Endpoints) == 0 && o.EndpointTemplate == "" {
+		return fmt.Errorf("either the HTTP endpoints or the HTTP endpoint template is required")
+	}
+
+	for clusterName, endpoint := range o.Endpoints {
+		if err := validateEndpoint(endpoint); err != nil {
+			return fmt.Errorf("invalid HTTP endpoint of cluster %s, %v", clusterName, err)
+		}
+	}
+
+	if o.EndpointTemplate != "" {
+		if _, err := template.New("endpoint").Parse(o.EndpointTemplate); err != nil {
+			return fmt.Errorf("invalid HTTP endpoint template %q, %v", o.EndpointTemplate, err)
+		}
+	}
+
+	return o.validateAgent()
+}
+
+// validateAgent validates the options that are shared by the source and the agent, the ingest requests are
+// authenticated with either a bearer token or a client cert.
+func (o *HTTPOptions) validateAgent() error {
+	if (o.ClientCertFile == "") != (o.ClientKeyFile == "") {
+		return fmt.Errorf("either both or none of HTTP client cert file and client key file must be set")
+	}
+
+	if o.ContentMode != HTTPContentModeBinary && o.ContentMode != HTTPContentModeStructured {
+		return fmt.Errorf("the HTTP content mode %q should be %s or %s",
+			o.ContentMode, HTTPContentModeBinary, HTTPContentModeStructured)
+	}
+
+	if o.Timeout <= 0 {
+		return fmt.Errorf("the HTTP timeout should be greater than 0")
+	}
+
+	if !strings.HasPrefix(o.IngestPath, "/") {
+		return fmt.Errorf("the HTTP ingest path %q should start with /", o.IngestPath)
+	}
+
+	if o.IngestTokenFile == "" && o.IngestClientCAFile == "" {
+		return fmt.Errorf("either the HTTP ingest token file or the HTTP ingest client CA file is required")
+	}
+
+	if o.MaxBodySize <= 0 {
+		return fmt.Errorf("the HTTP max body size should be greater than 0")
+	}
+
+	return nil
+}
+
+// Endpoint returns the endpoint URL of the given cluster.
+func (o *HTTPOptions) Endpoint(clusterName, sourceID string) (string, error) {
+	if endpoint, ok := o.Endpoints[clusterName]; ok {
+		return endpoint, nil
+	}
+
+	if o.EndpointTemplate == "" {
+		return "", fmt.Errorf("no HTTP endpoint is found for cluster %s", clusterName)
+	}
+
+	tmpl, err := template.New("endpoint").Option("missingkey=error").Parse(o.EndpointTemplate)
+	if err != nil {
+		return "", fmt.Errorf("invalid HTTP endpoint template %q, %v", o.EndpointTemplate, err)
+	}
+
+	var endpoint strings.Builder
+	if err := tmpl.Execute(&endpoint, endpointData{ClusterName: clusterName, SourceID: sourceID}); err != nil {
+		return "", fmt.Errorf("failed to render HTTP endpoint template %q, %v", o.EndpointTemplate, err)
+	}
+
+	if err := validateEndpoint(endpoint.String()); err != nil {
+		return "", fmt.Errorf("invalid HTTP endpoint of cluster %s, %v", clusterName, err)
+	}
+	return endpoint.String(), nil
+}
+
+// Client returns the HTTP client to POST the events.
+func (o *HTTPOptions) Client() (*http.Client, error) {
+	httpTransport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if o.CAFile != "" || o.ClientCertFile != "" {
+		certPool, err := x509.SystemCertPool()
+		if err != nil {
+			return nil, err
+		}
+
+		if o.CAFile != "" {
+			caPEM, err := os.ReadFile(o.CAFile)
+			if err != nil {
+				return nil, err
+			}
+
+			if ok := certPool.AppendCertsFromPEM(caPEM); !ok {
+				return nil, fmt.Errorf("invalid CA %s", o.CAFile)
+			}
+		}
+
+		httpTransport.TLSClientConfig = &tls.Config{
+			RootCAs:    certPool,
+			MinVersion: tls.VersionTLS12,
+		}
+
+		if o.ClientCertFile != "" {
+			// the new connections use the rotated client cert
+			loadCert := cert.CachingCertificateLoader(o.ClientCertFile, o.ClientKeyFile)
+			httpTransport.TLSClientConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return loadCert()
+			}
+		}
+	}
+
+	var roundTripper http.RoundTripper = httpTransport
+	if o.TokenFile != "" {
+		token, err := readToken(o.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		roundTripper = &bearerTokenRoundTripper{token: token, next: httpTransport}
+	}
+
+	return &http.Client{
+		Transport: roundTripper,
+		Timeout:   o.Timeout,
+	}, nil
+}
+
+// ingestAuthenticator returns the authenticator of the ingest requests, it checks the bearer token or verifies the
+// client cert of the request, and returns the common name of the client cert.
+func (o *HTTPOptions) ingestAuthenticator() (*ingestAuthenticator, error) {
+	a := &ingestAuthenticator{}
+	if o.IngestTokenFile != "" {
+		token, err := readToken(o.IngestTokenFile)
+		if err != nil {
+			return nil, err
+		}
+		a.token = token
+	}
+
+	if o.IngestClientCAFile != "" {
+		caPEM, err := os.ReadFile(o.IngestClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		a.clientCAs = x509.NewCertPool()
+		if ok := a.clientCAs.AppendCertsFromPEM(caPEM); !ok {
+			return nil, fmt.Errorf("invalid CA %s", o.IngestClientCAFile)
+		}
+	}
+
+	return a, nil
+}
+
+// HTTPServerTLSConfig returns the TLS config of the servers that serve the ingest handlers, the client certs are
+// requested but verified by the handlers, so the other routes of the server are still served without a client cert.
+func HTTPServerTLSConfig() *tls.Config {
+	return &tls.Config{
+		ClientAuth: tls.RequestClientCert,
+		MinVersion: tls.VersionTLS12,
+	}
+}
+
+// bearerTokenRoundTripper sets the bearer token of the requests.
+type bearerTokenRoundTripper struct {
+	token string
+	next  http.RoundTripper
+}
+
+func (rt *bearerTokenRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+rt.token)
+	return rt.next.RoundTrip(req)
+}
+
+// ingestAuthenticator authenticates the ingest requests.
+type ingestAuthenticator struct {
+	token     string
+	clientCAs *x509.CertPool
+}
+
+// authenticate returns the common name of the verified client cert, it's empty if the request is authenticated by
+// the bearer token.
+func (a *ingestAuthenticator) authenticate(req *http.Request) (string, error) {
+	if a.token != "" {
+		if token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer "); ok &&
+			subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) == 1 {
+			return "", nil
+		}
+	}
+
+	if a.clientCAs != nil && req.TLS != nil && len(req.TLS.PeerCertificates) != 0 {
+		intermediates := x509.NewCertPool()
+		for _, cert := range req.TLS.PeerCertificates[1:] {
+			intermediates.AddCert(cert)
+		}
+		clientCert := req.TLS.PeerCertificates[0]
+		if _, err := clientCert.Verify(x509.VerifyOptions{
+			Roots:         a.clientCAs,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}); err != nil {
+			return "", fmt.Errorf("invalid client cert, %v", err)
+		}
+		return clientCert.Subject.CommonName, nil
+	}
+
+	return "", fmt.Errorf("the request is not authenticated")
+}
+
+func readToken(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token file %s, %v", path, err)
+	}
+
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("the token file %s is empty", path)
+	}
+	return token, nil
+}
+
+// HTTPTransport is a CloudEvents transport that sends the events with HTTP POST requests and receives the events
+// from its Handler. The events are encoded and decoded by the generic client codecs as with the other transports.
+type HTTPTransport struct {
+	client      *http.Client
+	target      func(evtCtx cloudevents.EventContext) (string, error)
+	contentMode string
+
+	authenticator *ingestAuthenticator
+	maxBodySize   int64
+	// sender returns the identity of the sender of a received event, it must match the common name of the client
+	// cert of the request.
+	sender func(evt *cloudevents.Event) string
+
+	lock      sync.RWMutex
+	receiver  *httpProtocol
+	errorChan chan error
+}
+
+var _ options.CloudEventsOptions = &HTTPTransport{}
+
+// NewHTTPSourceOptions returns the CloudEvents source options that POST the spec events to the cluster endpoints,
+// the status events are received by the handler of the returned transport, which should be served on the ingest
+// path.
+func NewHTTPSourceOptions(httpOptions *HTTPOptions, sourceID string) (*options.CloudEventsSourceOptions, *HTTPTransport, error) {
+	client, err := httpOptions.Client()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to build HTTP client, %v", err)
+	}
+
+	authenticator, err := httpOptions.ingestAuthenticator()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to build HTTP ingest authenticator, %v", err)
+	}
+
+	t := &HTTPTransport{
+		client:        client,
+		contentMode:   httpOptions.ContentMode,
+		authenticator: authenticator,
+		maxBodySize:   httpOptions.MaxBodySize,
+		errorChan:     make(chan error),
+		target: func(evtCtx cloudevents.EventContext) (string, error) {
+			clusterName, err := evtCtx.GetExtension(types.ExtensionClusterName)
+			if err != nil {
+				return "", fmt.Errorf("failed to get the cluster name of the event, %v", err)
+			}
+			return httpOptions.Endpoint(fmt.Sprintf("%v", clusterName), sourceID)
+		},
+		sender: func(evt *cloudevents.Event) string {
+			return fmt.Sprintf("%v", evt.Extensions()[types.ExtensionClusterName])
+		},
+	}
+
+	return &options.CloudEventsSourceOptions{
+		CloudEventsOptions: t,
+		SourceID:           sourceID,
+	}, t, nil
+}
+
+// NewHTTPAgentOptions returns the CloudEvents agent options that POST the status events to the ingest URL of the
+// source, the spec events are received by the handler of the returned transport.
+func NewHTTPAgentOptions(httpOptions *HTTPOptions, ingestURL, clusterName, agentID string) (*options.CloudEventsAgentOptions, *HTTPTransport, error) {
+	if err := validateEndpoint(ingestURL); err != nil {
+		return nil, nil, fmt.Errorf("invalid ingest URL, %v", err)
+	}
+	if err := httpOptions.validateAgent(); err != nil {
+		return nil, nil, err
+	}
+
+	client, err := httpOptions.Client()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to build HTTP client, %v", err)
+	}
+
+	authenticator, err := httpOptions.ingestAuthenticator()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to build HTTP ingest authenticator, %v", err)
+	}
+
+	t := &HTTPTransport{
+		client:        client,
+		contentMode:   httpOptions.ContentMode,
+		authenticator: authenticator,
+		maxBodySize:   httpOptions.MaxBodySize,
+		errorChan:     make(chan error),
+		target: func(evtCtx cloudevents.EventContext) (string, error) {
+			return ingestURL, nil
+		},
+		sender: func(evt *cloudevents.Event) string {
+			return evt.Source()
+		},
+	}
+
+	return &options.CloudEventsAgentOptions{
+		CloudEventsOptions: t,
+		AgentID:            agentID,
+		ClusterName:        clusterName,
+	}, t, nil
+}
+
+func (t *HTTPTransport) WithContext(ctx context.Context, evtCtx cloudevents.EventContext) (context.Context, error) {
+	target, err := t.target(evtCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = cecontext.WithTarget(ctx, target)
+	if t.contentMode == HTTPContentModeStructured {
+		return binding.WithForceStructured(ctx), nil
+	}
+	return binding.WithForceBinary(ctx), nil
+}
+
+func (t *HTTPTransport) Protocol(ctx context.Context) (options.CloudEventsProtocol, error) {
+	sender, err := cehttp.New(cehttp.WithClient(*t.client))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &httpProtocol{
+		sender:   sender,
+		incoming: make(chan binding.Message),
+		closed:   make(chan struct{}),
+	}
+
+	// the handler delivers the received events to the latest protocol, the client creates a new protocol when it
+	// reconnects
+	t.lock.Lock()
+	t.receiver = p
+	t.lock.Unlock()
+
+	return p, nil
+}
+
+func (t *HTTPTransport) ErrorChan() <-chan error {
+	return t.errorChan
+}
+
+// Handler returns the HTTP handler that receives the events in binary or structured content mode. A request must
+// carry the ingest token or a client cert that is issued to the sender of its event, and is answered once its event
+// is handled, or with 503 if the client is not connected.
+func (t *HTTPTransport) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		commonName, err := t.authenticator.authenticate(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		req.Body = http.MaxBytesReader(w, req.Body, t.maxBodySize)
+
+		t.lock.RLock()
+		receiver := t.receiver
+		t.lock.RUnlock()
+		if receiver == nil {
+			http.Error(w, "the client is not connected", http.StatusServiceUnavailable)
+			return
+		}
+
+		m := cehttp.NewMessageFromHttpRequest(req)
+		if m.ReadEncoding() == binding.EncodingUnknown {
+			http.Error(w, binding.ErrUnknownEncoding.Error(), http.StatusUnsupportedMediaType)
+			return
+		}
+
+		// validate the event before it's queued, so an invalid event is rejected to its sender
+		evt, err := binding.ToEvent(req.Context(), m)
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				http.Error(w, fmt.Sprintf("the request body exceeds %d bytes", maxBytesErr.Limit),
+					http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, fmt.Sprintf("invalid cloudevent, %v", err), http.StatusBadRequest)
+			return
+		}
+
+		// the client cert is only valid for the events of its own cluster or source
+		if commonName != "" && commonName != t.sender(evt) {
+			http.Error(w, fmt.Sprintf("the client cert of %s can't send the event of %s", commonName, t.sender(evt)),
+				http.StatusForbidden)
+			return
+		}
+
+		if err := receiver.deliver(req.Context(), evt); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// httpProtocol sends the events with the CloudEvents HTTP sender and receives the events that are delivered by the
+// transport handler.
+type httpProtocol struct {
+	sender   *cehttp.Protocol
+	incoming chan binding.Message
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+var _ options.CloudEventsProtocol = &httpProtocol{}
+
+func (p *httpProtocol) Send(ctx context.Context, m binding.Message, transformers ...binding.Transformer) error {
+	select {
+	case <-p.closed:
+		return io.ErrClosedPipe
+	default:
+	}
+
+	// the client only retries the undelivered events, so a rejected request is reported as undelivered
+	if err := p.sender.Send(ctx, m, transformers...); err != nil && !protocol.IsACK(err) {
+		return fmt.Errorf("failed to post event to %s, %v", cecontext.TargetFrom(ctx), err)
+	}
+	return nil
+}
+
+func (p *httpProtocol) Receive(ctx context.Context) (binding.Message, error) {
+	select {
+	case m := <-p.incoming:
+		return m, nil
+	case <-p.closed:
+		return nil, io.EOF
+	case <-ctx.Done():
+		return nil, io.EOF
+	}
+}
+
+func (p *httpProtocol) Close(ctx context.Context) error {
+	p.closeOnce.Do(func() {
+		close(p.closed)
+	})
+	return nil
+}
+
+// deliver queues the event to the receiver and waits until it's handled.
+func (p *httpProtocol) deliver(ctx context.Context, evt *cloudevents.Event) error {
+	handled := make(chan struct{})
+	m := binding.WithFinish(binding.ToMessage(evt), func(error) {
+		close(handled)
+	})
+
+	select {
+	case p.incoming <- m:
+	case <-p.closed:
+		return fmt.Errorf("the client is disconnected")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-handled:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func validateEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("the scheme of %q should be http or https", endpoint)
+	}
+
+	if u.Host == "" {
+		return fmt.Errorf("the host of %q is required", endpoint)
+	}
+	return nil
+}
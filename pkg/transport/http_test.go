@@ -0,0 +1,351 @@
+package transport
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/binding"
+
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/types"
+)
+
+func TestHTTPTransportSendReceive(t *testing.T) {
+	cases := []struct {
+		name                string
+		contentMode         string
+		expectedContentType string
+	}{
+		{
+			name:                "binary",
+			contentMode:         HTTPContentModeBinary,
+			expectedContentType: cloudevents.ApplicationJSON,
+		},
+		{
+			name:                "structured",
+			contentMode:         HTTPContentModeStructured,
+			expectedContentType: cloudevents.ApplicationCloudEventsJSON,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			tokenFile := writeTestToken(t, "token")
+			sourceOptions := NewHTTPOptions()
+			sourceOptions.EndpointTemplate = "https://{{.ClusterName}}.example.com/cloudevents"
+			sourceOptions.IngestTokenFile = tokenFile
+			_, sourceTransport, err := NewHTTPSourceOptions(sourceOptions, "source")
+			if err != nil {
+				t.Fatal(err)
+			}
+			receiver, err := sourceTransport.Protocol(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			contentTypes := make(chan string, 1)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				contentTypes <- req.Header.Get("Content-Type")
+				sourceTransport.Handler().ServeHTTP(w, req)
+			}))
+			defer server.Close()
+
+			agentOptions := NewHTTPOptions()
+			agentOptions.ContentMode = c.contentMode
+			agentOptions.TokenFile = tokenFile
+			agentOptions.IngestTokenFile = tokenFile
+			_, agentTransport, err := NewHTTPAgentOptions(agentOptions, server.URL, "cluster1", "agent1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			sender, err := agentTransport.Protocol(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			received := make(chan *cloudevents.Event, 1)
+			go func() {
+				m, err := receiver.Receive(ctx)
+				if err != nil {
+					return
+				}
+				evt, err := binding.ToEvent(ctx, m)
+				if err != nil {
+					t.Errorf("unexpected error %v", err)
+				}
+				received <- evt
+				m.Finish(nil)
+			}()
+
+			evt := newHTTPTestEvent("cluster1")
+			sendCtx, err := agentTransport.WithContext(ctx, evt.Context)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := sender.Send(sendCtx, binding.ToMessage(evt)); err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			if contentType := <-contentTypes; !strings.HasPrefix(contentType, c.expectedContentType) {
+				t.Errorf("expected content type %s, but got %s", c.expectedContentType, contentType)
+			}
+			select {
+			case got := <-received:
+				if got.ID() != evt.ID() || string(got.Data()) != string(evt.Data()) {
+					t.Errorf("expected event %v, but got %v", evt, got)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("expected the event is received")
+			}
+		})
+	}
+}
+
+func TestHTTPTransportHandler(t *testing.T) {
+	ca, caKey, caFile := newTestCA(t)
+	cluster1Cert := newTestClientCert(t, ca, caKey, "cluster1")
+
+	cases := []struct {
+		name         string
+		connected    bool
+		token        string
+		clientCert   *x509.Certificate
+		maxBodySize  int64
+		expectedCode int
+	}{
+		{
+			name:         "not connected",
+			token:        "token",
+			expectedCode: http.StatusServiceUnavailable,
+		},
+		{
+			name:         "no credentials",
+			connected:    true,
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "wrong token",
+			connected:    true,
+			token:        "wrong",
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "token",
+			connected:    true,
+			token:        "token",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "client cert of the cluster",
+			connected:    true,
+			clientCert:   cluster1Cert,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "client cert of another cluster",
+			connected:    true,
+			clientCert:   newTestClientCert(t, ca, caKey, "cluster2"),
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "client cert of an unknown CA",
+			connected:    true,
+			clientCert:   newTestClientCert(t, nil, nil, "cluster1"),
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "body too large",
+			connected:    true,
+			token:        "token",
+			maxBodySize:  8,
+			expectedCode: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			httpOptions := NewHTTPOptions()
+			httpOptions.EndpointTemplate = "https://{{.ClusterName}}.example.com/cloudevents"
+			httpOptions.IngestTokenFile = writeTestToken(t, "token")
+			httpOptions.IngestClientCAFile = caFile
+			if c.maxBodySize != 0 {
+				httpOptions.MaxBodySize = c.maxBodySize
+			}
+			_, httpTransport, err := NewHTTPSourceOptions(httpOptions, "source")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.connected {
+				receiver, err := httpTransport.Protocol(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				go func() {
+					if m, err := receiver.Receive(ctx); err == nil {
+						m.Finish(nil)
+					}
+				}()
+			}
+
+			evt := newHTTPTestEvent("cluster1")
+			data, err := evt.MarshalJSON()
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/cloudevents", strings.NewReader(string(data)))
+			req.Header.Set("Content-Type", cloudevents.ApplicationCloudEventsJSON)
+			if c.token != "" {
+				req.Header.Set("Authorization", "Bearer "+c.token)
+			}
+			if c.clientCert != nil {
+				req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{c.clientCert}}
+			}
+
+			w := httptest.NewRecorder()
+			httpTransport.Handler().ServeHTTP(w, req)
+			if w.Code != c.expectedCode {
+				t.Errorf("expected code %d, but got %d: %s", c.expectedCode, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestHTTPOptionsValidate(t *testing.T) {
+	cases := []struct {
+		name        string
+		mutate      func(o *HTTPOptions)
+		expectedErr string
+	}{
+		{
+			name:   "token",
+			mutate: func(o *HTTPOptions) { o.IngestTokenFile = "/token" },
+		},
+		{
+			name:        "no ingest authentication",
+			mutate:      func(o *HTTPOptions) {},
+			expectedErr: "either the HTTP ingest token file or the HTTP ingest client CA file is required",
+		},
+		{
+			name: "invalid max body size",
+			mutate: func(o *HTTPOptions) {
+				o.IngestClientCAFile = "/ca.crt"
+				o.MaxBodySize = 0
+			},
+			expectedErr: "the HTTP max body size should be greater than 0",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			o := NewHTTPOptions()
+			o.EndpointTemplate = "https://{{.ClusterName}}.example.com/cloudevents"
+			c.mutate(o)
+			err := o.Validate()
+			switch {
+			case c.expectedErr == "" && err != nil:
+				t.Errorf("unexpected error %v", err)
+			case c.expectedErr != "" && (err == nil || !strings.Contains(err.Error(), c.expectedErr)):
+				t.Errorf("expected error %q, but got %v", c.expectedErr, err)
+			}
+		})
+	}
+}
+
+func newHTTPTestEvent(clusterName string) *cloudevents.Event {
+	evt := cloudevents.NewEvent()
+	evt.SetID("1")
+	evt.SetSource("agent1")
+	evt.SetType("io.open-cluster-management.works.v1alpha1.manifests.status.update_request")
+	evt.SetExtension(types.ExtensionClusterName, clusterName)
+	if err := evt.SetData(cloudevents.ApplicationJSON, map[string]string{"status": "ok"}); err != nil {
+		panic(err)
+	}
+	return &evt
+}
+
+func writeTestToken(t *testing.T, token string) string {
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newTestCA returns a self-signed CA and the file of its cert.
+func newTestCA(t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "ca.crt")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return ca, key, path
+}
+
+// newTestClientCert issues a client cert of the common name, the cert is self-signed if the CA is nil.
+func newTestClientCert(t *testing.T, ca *x509.Certificate, caKey *ecdsa.PrivateKey, commonName string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if ca == nil {
+		ca, caKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
@@ -0,0 +1,77 @@
+package transport
+
+import (
+	"fmt"
+)
+
+// KafkaOptions holds the options that are used to connect the source to a Kafka cluster. The topics are compatible
+// with the sdk-go Kafka agent, and the events of a cluster are published with the cluster name as the message key,
+// so they land on the same partition and keep their order.
+type KafkaOptions struct {
+	// BootstrapServers is a comma separated list of the Kafka brokers (host:port).
+	BootstrapServers string
+	// GroupID is the consumer group of the source, by default it's the source ID.
+	GroupID string
+
+	// CAFile is the file path to a cert file for the Kafka broker certificate authority, the connection uses TLS
+	// if it's set.
+	CAFile string
+	// ClientCertFile is the file path to a client cert file for mTLS.
+	ClientCertFile string
+	// ClientKeyFile is the file path to a client key file for mTLS.
+	ClientKeyFile string
+
+	// SASLMechanism is the SASL mechanism, PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512, SASL is disabled if it's empty.
+	SASLMechanism string
+	// SASLUsername is the SASL username.
+	SASLUsername string
+	// SASLPassword is the SASL password.
+	SASLPassword string
+}
+
+func NewKafkaOptions() *KafkaOptions {
+	return &KafkaOptions{
+		BootstrapServers: "localhost:9092",
+	}
+}
+
+// Validate validates the Kafka options.
+func (o *KafkaOptions) Validate() error {
+	if o.BootstrapServers == "" {
+		return fmt.Errorf("the Kafka bootstrap servers are required")
+	}
+
+	if (o.ClientCertFile == "") != (o.ClientKeyFile == "") {
+		return fmt.Errorf("either both or none of Kafka client cert file and client key file must be set")
+	}
+
+	if o.ClientCertFile != "" && o.CAFile == "" {
+		return fmt.Errorf("setting Kafka client cert file and client key file requires CA file")
+	}
+
+	switch o.SASLMechanism {
+	case "":
+	case "PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512":
+		if o.SASLUsername == "" || o.SASLPassword == "" {
+			return fmt.Errorf("the Kafka SASL username and password are required for %s", o.SASLMechanism)
+		}
+	default:
+		return fmt.Errorf("unsupported Kafka SASL mechanism %q", o.SASLMechanism)
+	}
+
+	return nil
+}
+
+// securityProtocol returns the Kafka security protocol by the TLS and SASL settings.
+func (o *KafkaOptions) securityProtocol() string {
+	switch {
+	case o.CAFile != "" && o.SASLMechanism != "":
+		return "sasl_ssl"
+	case o.CAFile != "":
+		return "ssl"
+	case o.SASLMechanism != "":
+		return "sasl_plaintext"
+	default:
+		return "plaintext"
+	}
+}
@@ -0,0 +1,85 @@
+//go:build kafka
+
+package transport
+
+import (
+	"context"
+	"fmt"
+
+	confluent "github.com/cloudevents/sdk-go/protocol/kafka_confluent/v2"
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/options"
+	sdkkafka "open-cluster-management.io/sdk-go/pkg/cloudevents/generic/options/kafka"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/types"
+)
+
+// kafkaSourceOptions wraps the sdk-go Kafka source options, it only keys the events of a cluster by the cluster name.
+type kafkaSourceOptions struct {
+	options.CloudEventsOptions
+}
+
+// NewKafkaSourceOptions returns the CloudEvents source options that send and receive events over Kafka.
+func NewKafkaSourceOptions(kafkaOptions *KafkaOptions, sourceID string) (*options.CloudEventsSourceOptions, error) {
+	configMap := kafka.ConfigMap{
+		"bootstrap.servers":       kafkaOptions.BootstrapServers,
+		"security.protocol":       kafkaOptions.securityProtocol(),
+		"socket.keepalive.enable": true,
+		// silence spontaneous disconnection logs, kafka recovers by itself.
+		"log.connection.close":   false,
+		"go.events.channel.size": 1000,
+
+		// producer
+		"acks": "1",
+
+		// consumer
+		"enable.auto.commit": true,
+		// the source may start after the agents send the status, read the events that are not committed yet.
+		"auto.offset.reset": "earliest",
+	}
+
+	if kafkaOptions.GroupID != "" {
+		_ = configMap.SetKey("group.id", kafkaOptions.GroupID)
+	}
+
+	if kafkaOptions.CAFile != "" {
+		_ = configMap.SetKey("ssl.ca.location", kafkaOptions.CAFile)
+	}
+
+	if kafkaOptions.ClientCertFile != "" {
+		_ = configMap.SetKey("ssl.certificate.location", kafkaOptions.ClientCertFile)
+		_ = configMap.SetKey("ssl.key.location", kafkaOptions.ClientKeyFile)
+	}
+
+	if kafkaOptions.SASLMechanism != "" {
+		_ = configMap.SetKey("sasl.mechanisms", kafkaOptions.SASLMechanism)
+		_ = configMap.SetKey("sasl.username", kafkaOptions.SASLUsername)
+		_ = configMap.SetKey("sasl.password", kafkaOptions.SASLPassword)
+	}
+
+	// the sdk-go source options use the source ID as the consumer group if it's not set
+	sourceOptions := sdkkafka.NewSourceOptions(&sdkkafka.KafkaOptions{ConfigMap: configMap}, sourceID)
+	sourceOptions.CloudEventsOptions = &kafkaSourceOptions{CloudEventsOptions: sourceOptions.CloudEventsOptions}
+	return sourceOptions, nil
+}
+
+// WithContext publishes the events to the topics of the sdk-go source options, the events of a cluster are keyed by
+// the cluster name instead of `<source>@<cluster>`, so they land on the same partition and keep their order.
+func (o *kafkaSourceOptions) WithContext(ctx context.Context, evtCtx cloudevents.EventContext) (context.Context, error) {
+	ctx, err := o.CloudEventsOptions.WithContext(ctx, evtCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	clusterName, err := evtCtx.GetExtension(types.ExtensionClusterName)
+	if err != nil {
+		return nil, err
+	}
+
+	if clusterName == types.ClusterAll {
+		// the broadcast resync requests are keyed by the source ID
+		return ctx, nil
+	}
+	return confluent.WithMessageKey(ctx, fmt.Sprintf("%s", clusterName)), nil
+}
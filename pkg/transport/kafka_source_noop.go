@@ -0,0 +1,14 @@
+//go:build !kafka
+
+package transport
+
+import (
+	"fmt"
+
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/options"
+)
+
+// NewKafkaSourceOptions returns an error since the Kafka client requires cgo, build with `-tags=kafka` to enable it.
+func NewKafkaSourceOptions(kafkaOptions *KafkaOptions, sourceID string) (*options.CloudEventsSourceOptions, error) {
+	return nil, fmt.Errorf("kafka transport is not enabled, build with -tags=kafka to enable it")
+}
@@ -0,0 +1,140 @@
+//go:build kafka
+
+package transport
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/types"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/work/payload"
+)
+
+func TestKafkaSourceOptions(t *testing.T) {
+	// the librdkafka mock cluster is a single-node broker stand-in
+	mc, err := kafka.NewMockCluster(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mc.Close()
+
+	// the topics of the sdk-go Kafka options, e.g. `sourceevents.<source>.<cluster>` maps the MQTT topic
+	// `sources/<source>/clusters/<cluster>/sourceevents`
+	sourceEventsTopic := "sourceevents.source1.cluster1"
+	agentEventsTopic := "agentevents.source1.cluster1"
+	for _, topic := range []string{sourceEventsTopic, agentEventsTopic, "sourcebroadcast.source1",
+		"agentbroadcast.cluster1"} {
+		if err := mc.CreateTopic(topic, 3, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	kafkaOptions := NewKafkaOptions()
+	kafkaOptions.BootstrapServers = mc.BootstrapServers()
+	sourceOptions, err := NewKafkaSourceOptions(kafkaOptions, "source1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	protocol, err := sourceOptions.CloudEventsOptions.Protocol(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := cloudevents.NewClient(protocol)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		// the generic client drains the errors, otherwise they block the protocol
+		for range sourceOptions.CloudEventsOptions.ErrorChan() {
+		}
+	}()
+
+	received := make(chan cloudevents.Event, 1)
+	go func() {
+		_ = client.StartReceiver(ctx, func(evt cloudevents.Event) {
+			received <- evt
+		})
+	}()
+
+	// the spec events of a cluster are published to the cluster topic and keyed by the cluster name
+	specEvent := newKafkaTestEvent(types.SubResourceSpec, "cluster1")
+	sendCtx, err := sourceOptions.CloudEventsOptions.WithContext(ctx, specEvent.Context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := client.Send(sendCtx, specEvent); cloudevents.IsUndelivered(result) {
+		t.Fatalf("failed to send the spec event, %v", result)
+	}
+
+	consumer, err := kafka.NewConsumer(&kafka.ConfigMap{
+		"bootstrap.servers": mc.BootstrapServers(),
+		"group.id":          "agent1",
+		"auto.offset.reset": "earliest",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer consumer.Close()
+	if err := consumer.Subscribe(sourceEventsTopic, nil); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := consumer.ReadMessage(10 * time.Second)
+	if err != nil {
+		t.Fatalf("failed to read the spec event, %v", err)
+	}
+	if key := string(msg.Key); key != "cluster1" {
+		t.Errorf("expected the message key cluster1, but got %q", key)
+	}
+
+	// the status events of the cluster are received from the agent topic
+	producer, err := kafka.NewProducer(&kafka.ConfigMap{"bootstrap.servers": mc.BootstrapServers()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer producer.Close()
+	statusEvent := newKafkaTestEvent(types.SubResourceStatus, "cluster1")
+	data, err := statusEvent.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := producer.Produce(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &agentEventsTopic, Partition: kafka.PartitionAny},
+		Key:            []byte("cluster1"),
+		Value:          data,
+		Headers:        []kafka.Header{{Key: "content-type", Value: []byte(cloudevents.ApplicationCloudEventsJSON)}},
+	}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case evt := <-received:
+		if evt.ID() != statusEvent.ID() {
+			t.Errorf("expected the status event %s, but got %s", statusEvent.ID(), evt.ID())
+		}
+	case <-time.After(30 * time.Second):
+		t.Errorf("expected the status event is received by the source")
+	}
+}
+
+func newKafkaTestEvent(subResource types.EventSubResource, clusterName string) cloudevents.Event {
+	evt := cloudevents.NewEvent()
+	evt.SetID(string(subResource) + "-" + clusterName)
+	evt.SetSource("source1")
+	evt.SetType(types.CloudEventsType{
+		CloudEventsDataType: payload.ManifestEventDataType,
+		SubResource:         subResource,
+		Action:              "update_request",
+	}.String())
+	evt.SetExtension(types.ExtensionClusterName, clusterName)
+	evt.SetExtension(types.ExtensionOriginalSource, "source1")
+	_ = evt.SetData(cloudevents.ApplicationJSON, map[string]string{"cluster": clusterName})
+	return evt
+}
@@ -0,0 +1,344 @@
+package transport
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/util/runtime"
+)
+
+// KeyringKey is a PEM encoded key. A public key is derived from its private key if it's not set.
+type KeyringKey struct {
+	ID         string `yaml:"id"`
+	PublicKey  string `yaml:"publicKey,omitempty"`
+	PrivateKey string `yaml:"privateKey,omitempty"`
+}
+
+// KeyringConfig is the keyring file.
+type KeyringConfig struct {
+	// Clusters maps the cluster names to their RSA encryption keys. The source only needs the public keys to
+	// encrypt, and the agent needs the private key of its cluster to decrypt.
+	Clusters map[string][]KeyringKey `yaml:"clusters,omitempty"`
+	// SigningKeys are the Ed25519 private keys that sign the outgoing events, the first key signs.
+	SigningKeys []KeyringKey `yaml:"signingKeys,omitempty"`
+	// VerificationKeys maps the signers to their Ed25519 public keys, the signer of a status event is its cluster
+	// name, and the signer of a spec event is its source ID.
+	VerificationKeys map[string][]KeyringKey `yaml:"verificationKeys,omitempty"`
+}
+
+type encryptionKey struct {
+	id         string
+	publicKey  *rsa.PublicKey
+	privateKey *rsa.PrivateKey
+}
+
+type signingKey struct {
+	id         string
+	publicKey  ed25519.PublicKey
+	privateKey ed25519.PrivateKey
+}
+
+// Keyring holds the keys that are loaded from a keyring file. The first key of a list encrypts or signs the events,
+// and all the keys of a list decrypt or verify the events by their key IDs, so a key is rotated by adding the new
+// key at the top and removing the old key once the events of it are delivered. The file is reloaded when it's
+// modified.
+type Keyring struct {
+	file string
+
+	lock             sync.RWMutex
+	modTime          time.Time
+	clusters         map[string][]encryptionKey
+	signingKeys      []signingKey
+	verificationKeys map[string][]signingKey
+}
+
+// LoadKeyring loads the keyring from a YAML or JSON file.
+func LoadKeyring(file string) (*Keyring, error) {
+	k := &Keyring{file: file}
+	if err := k.reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// NewKeyringKey generates a 2048 bits RSA encryption key with the given ID, it's used to create a keyring for tests.
+func NewKeyringKey(id string) (KeyringKey, error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return KeyringKey{}, err
+	}
+
+	return encodeKeyringKey(id, &privateKey.PublicKey, privateKey)
+}
+
+// NewSigningKey generates an Ed25519 signing key with the given ID, it's used to create a keyring for tests.
+func NewSigningKey(id string) (KeyringKey, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return KeyringKey{}, err
+	}
+
+	return encodeKeyringKey(id, publicKey, privateKey)
+}
+
+func encodeKeyringKey(id string, publicKey, privateKey any) (KeyringKey, error) {
+	publicDER, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return KeyringKey{}, err
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return KeyringKey{}, err
+	}
+
+	return KeyringKey{
+		ID:         id,
+		PublicKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})),
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})),
+	}, nil
+}
+
+// reload loads the keyring file if it's modified since the last load.
+func (k *Keyring) reload() error {
+	info, err := os.Stat(k.file)
+	if err != nil {
+		return fmt.Errorf("failed to stat keyring %s, %v", k.file, err)
+	}
+
+	k.lock.RLock()
+	modified := !info.ModTime().Equal(k.modTime)
+	k.lock.RUnlock()
+	if !modified {
+		return nil
+	}
+
+	data, err := os.ReadFile(k.file)
+	if err != nil {
+		return fmt.Errorf("failed to read keyring %s, %v", k.file, err)
+	}
+
+	config := &KeyringConfig{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return fmt.Errorf("failed to unmarshal keyring %s, %v", k.file, err)
+	}
+
+	clusters := map[string][]encryptionKey{}
+	for clusterName, keys := range config.Clusters {
+		if err := validateKeyIDs(keys); err != nil {
+			return fmt.Errorf("invalid keyring %s: cluster %s, %v", k.file, clusterName, err)
+		}
+		for _, key := range keys {
+			parsed, err := parseEncryptionKey(key)
+			if err != nil {
+				return fmt.Errorf("invalid keyring %s: the key %s of cluster %s, %v", k.file, key.ID, clusterName, err)
+			}
+			clusters[clusterName] = append(clusters[clusterName], parsed)
+		}
+	}
+
+	if err := validateKeyIDs(config.SigningKeys); err != nil {
+		return fmt.Errorf("invalid keyring %s: signing keys, %v", k.file, err)
+	}
+	signingKeys := []signingKey{}
+	for _, key := range config.SigningKeys {
+		parsed, err := parseSigningKey(key)
+		if err != nil {
+			return fmt.Errorf("invalid keyring %s: the signing key %s, %v", k.file, key.ID, err)
+		}
+		if parsed.privateKey == nil {
+			return fmt.Errorf("invalid keyring %s: the signing key %s has no private key", k.file, key.ID)
+		}
+		signingKeys = append(signingKeys, parsed)
+	}
+
+	verificationKeys := map[string][]signingKey{}
+	for signer, keys := range config.VerificationKeys {
+		if err := validateKeyIDs(keys); err != nil {
+			return fmt.Errorf("invalid keyring %s: signer %s, %v", k.file, signer, err)
+		}
+		for _, key := range keys {
+			parsed, err := parseSigningKey(key)
+			if err != nil {
+				return fmt.Errorf("invalid keyring %s: the verification key %s of signer %s, %v", k.file, key.ID, signer, err)
+			}
+			verificationKeys[signer] = append(verificationKeys[signer], parsed)
+		}
+	}
+
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	k.clusters = clusters
+	k.signingKeys = signingKeys
+	k.verificationKeys = verificationKeys
+	k.modTime = info.ModTime()
+	return nil
+}
+
+// refresh reloads the keyring file, a file that fails to reload is ignored until it's fixed, so a partially
+// written file doesn't break the events.
+func (k *Keyring) refresh() {
+	if err := k.reload(); err != nil {
+		runtime.HandleError(err)
+	}
+}
+
+func (k *Keyring) encryptionKeys(clusterName string) []encryptionKey {
+	k.refresh()
+
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	return k.clusters[clusterName]
+}
+
+func (k *Keyring) signingKey() (signingKey, bool) {
+	k.refresh()
+
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	if len(k.signingKeys) == 0 {
+		return signingKey{}, false
+	}
+	return k.signingKeys[0], true
+}
+
+func (k *Keyring) verificationKey(signer, keyID string) (signingKey, bool) {
+	k.refresh()
+
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	for _, key := range k.verificationKeys[signer] {
+		if key.id == keyID {
+			return key, true
+		}
+	}
+	return signingKey{}, false
+}
+
+func validateKeyIDs(keys []KeyringKey) error {
+	ids := map[string]bool{}
+	for i, key := range keys {
+		if key.ID == "" {
+			return fmt.Errorf("the id of the key %d is empty", i)
+		}
+		if ids[key.ID] {
+			return fmt.Errorf("duplicated key %s", key.ID)
+		}
+		ids[key.ID] = true
+	}
+	return nil
+}
+
+func parseEncryptionKey(key KeyringKey) (encryptionKey, error) {
+	parsed := encryptionKey{id: key.ID}
+	if key.PrivateKey != "" {
+		privateKey, err := parsePrivateKey(key.PrivateKey)
+		if err != nil {
+			return parsed, err
+		}
+
+		rsaKey, ok := privateKey.(*rsa.PrivateKey)
+		if !ok {
+			return parsed, fmt.Errorf("the private key is not a RSA key")
+		}
+		parsed.privateKey = rsaKey
+		parsed.publicKey = &rsaKey.PublicKey
+	}
+
+	if key.PublicKey != "" {
+		publicKey, err := parsePublicKey(key.PublicKey)
+		if err != nil {
+			return parsed, err
+		}
+
+		rsaKey, ok := publicKey.(*rsa.PublicKey)
+		if !ok {
+			return parsed, fmt.Errorf("the public key is not a RSA key")
+		}
+		if parsed.publicKey != nil && !parsed.publicKey.Equal(rsaKey) {
+			return parsed, fmt.Errorf("the public key doesn't match the private key")
+		}
+		parsed.publicKey = rsaKey
+	}
+
+	if parsed.publicKey == nil {
+		return parsed, fmt.Errorf("either the public key or the private key is required")
+	}
+	return parsed, nil
+}
+
+func parseSigningKey(key KeyringKey) (signingKey, error) {
+	parsed := signingKey{id: key.ID}
+	if key.PrivateKey != "" {
+		privateKey, err := parsePrivateKey(key.PrivateKey)
+		if err != nil {
+			return parsed, err
+		}
+
+		ed25519Key, ok := privateKey.(ed25519.PrivateKey)
+		if !ok {
+			return parsed, fmt.Errorf("the private key is not an Ed25519 key")
+		}
+		parsed.privateKey = ed25519Key
+		parsed.publicKey = ed25519Key.Public().(ed25519.PublicKey)
+	}
+
+	if key.PublicKey != "" {
+		publicKey, err := parsePublicKey(key.PublicKey)
+		if err != nil {
+			return parsed, err
+		}
+
+		ed25519Key, ok := publicKey.(ed25519.PublicKey)
+		if !ok {
+			return parsed, fmt.Errorf("the public key is not an Ed25519 key")
+		}
+		if parsed.publicKey != nil && !parsed.publicKey.Equal(ed25519Key) {
+			return parsed, fmt.Errorf("the public key doesn't match the private key")
+		}
+		parsed.publicKey = ed25519Key
+	}
+
+	if parsed.publicKey == nil {
+		return parsed, fmt.Errorf("either the public key or the private key is required")
+	}
+	return parsed, nil
+}
+
+// parsePrivateKey parses a PKCS8 private key, or a PKCS1 RSA private key that openssl genrsa generates.
+func parsePrivateKey(data string) (any, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, fmt.Errorf("the private key is not PEM encoded")
+	}
+
+	if rsaKey, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return rsaKey, nil
+	}
+
+	privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key, %v", err)
+	}
+	return privateKey, nil
+}
+
+func parsePublicKey(data string) (any, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, fmt.Errorf("the public key is not PEM encoded")
+	}
+
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key, %v", err)
+	}
+	return publicKey, nil
+}
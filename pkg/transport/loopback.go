@@ -0,0 +1,157 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/cloudevents/sdk-go/v2/binding"
+	"github.com/google/uuid"
+
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/options"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/options/fake"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/types"
+)
+
+// LoopbackBroker is an in-memory CloudEvents transport, the sources and agents that are connected to the same
+// broker exchange the events in process with the same routing as the gRPC broker. It's used to run the source
+// client against a fake agent without a real broker.
+type LoopbackBroker struct {
+	sync.RWMutex
+	endpoints map[string]*loopbackProtocol
+}
+
+func NewLoopbackBroker() *LoopbackBroker {
+	return &LoopbackBroker{
+		endpoints: make(map[string]*loopbackProtocol),
+	}
+}
+
+// NewLoopbackSourceOptions returns the CloudEvents source options that send and receive events over the broker.
+func NewLoopbackSourceOptions(broker *LoopbackBroker, sourceID string) *options.CloudEventsSourceOptions {
+	return fake.NewSourceOptions(broker.connect(sourceID, ""), sourceID)
+}
+
+// NewLoopbackAgentOptions returns the CloudEvents agent options that send and receive events over the broker.
+func NewLoopbackAgentOptions(broker *LoopbackBroker, clusterName, agentID string) *options.CloudEventsAgentOptions {
+	return fake.NewAgentOptions(broker.connect(types.SourceAll, clusterName), clusterName, agentID)
+}
+
+func (b *LoopbackBroker) connect(source, clusterName string) *loopbackProtocol {
+	p := &loopbackProtocol{
+		id:          uuid.New().String(),
+		broker:      b,
+		source:      source,
+		clusterName: clusterName,
+		notify:      make(chan struct{}, 1),
+		closed:      make(chan struct{}),
+	}
+
+	b.Lock()
+	defer b.Unlock()
+	b.endpoints[p.id] = p
+	return p
+}
+
+func (b *LoopbackBroker) disconnect(id string) {
+	b.Lock()
+	defer b.Unlock()
+	delete(b.endpoints, id)
+}
+
+func (b *LoopbackBroker) publish(ctx context.Context, m binding.Message) error {
+	evt, err := binding.ToEvent(ctx, m)
+	if err != nil {
+		return err
+	}
+
+	toAgents, err := routeToAgents(*evt)
+	if err != nil {
+		return err
+	}
+
+	b.RLock()
+	defer b.RUnlock()
+
+	for _, endpoint := range b.endpoints {
+		if !subscribed(*evt, toAgents, endpoint.source, endpoint.clusterName) {
+			continue
+		}
+
+		// each endpoint receives its own copy of the event
+		received := evt.Clone()
+		endpoint.deliver(binding.ToMessage(&received))
+	}
+
+	return nil
+}
+
+// loopbackProtocol is the CloudEvents protocol of an endpoint connected to the loopback broker. The received
+// messages are queued without bound, so a handler can publish while handling an event without a deadlock.
+type loopbackProtocol struct {
+	id          string
+	broker      *LoopbackBroker
+	source      string
+	clusterName string
+
+	lock    sync.Mutex
+	pending []binding.Message
+	notify  chan struct{}
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+var _ options.CloudEventsProtocol = &loopbackProtocol{}
+
+func (p *loopbackProtocol) Send(ctx context.Context, m binding.Message, transformers ...binding.Transformer) error {
+	defer m.Finish(nil)
+
+	select {
+	case <-p.closed:
+		return io.ErrClosedPipe
+	default:
+	}
+
+	return p.broker.publish(ctx, m)
+}
+
+func (p *loopbackProtocol) Receive(ctx context.Context) (binding.Message, error) {
+	for {
+		p.lock.Lock()
+		if len(p.pending) != 0 {
+			m := p.pending[0]
+			p.pending = p.pending[1:]
+			p.lock.Unlock()
+			return m, nil
+		}
+		p.lock.Unlock()
+
+		select {
+		case <-p.notify:
+		case <-p.closed:
+			return nil, io.EOF
+		case <-ctx.Done():
+			return nil, io.EOF
+		}
+	}
+}
+
+func (p *loopbackProtocol) Close(ctx context.Context) error {
+	p.closeOnce.Do(func() {
+		p.broker.disconnect(p.id)
+		close(p.closed)
+	})
+	return nil
+}
+
+func (p *loopbackProtocol) deliver(m binding.Message) {
+	p.lock.Lock()
+	p.pending = append(p.pending, m)
+	p.lock.Unlock()
+
+	select {
+	case p.notify <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,323 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/options/cert"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/options/mqtt"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/types"
+)
+
+// MQTTOptions holds the options that are used to connect the source to an MQTT broker, they are mapped onto the
+// sdk-go MQTT options.
+type MQTTOptions struct {
+	// BrokerHost is the address of the MQTT broker (host:port).
+	BrokerHost string
+
+	// CAFile is the file path to a cert file for the MQTT broker certificate authority. The connection uses TLS if
+	// it's set or the client cert is set, the system cert pool is used if it's not set.
+	CAFile string
+	// ClientCertFile is the file path to a client cert file for mTLS, the client cert is reloaded when it's
+	// rotated.
+	ClientCertFile string
+	// ClientKeyFile is the file path to a client key file for mTLS.
+	ClientKeyFile string
+
+	// Username is the username for the basic authentication.
+	Username string
+	// Password is the password for the basic authentication.
+	Password string
+
+	// KeepAlive is the interval that the client pings the broker.
+	KeepAlive time.Duration
+	// PubQoS is the QoS to publish the events.
+	PubQoS int
+	// SubQoS is the QoS to subscribe the events.
+	SubQoS int
+	// DialTimeout is the timeout to establish the TCP connection.
+	DialTimeout time.Duration
+
+	// Topics are the templates of the MQTT topics, the templates are rendered with the source ID, e.g.
+	// `sources/{{.SourceID}}/clusters/+/sourceevents`.
+	Topics types.Topics
+	// SharedSubscriptionGroup is the MQTT v5 shared subscription group of the agent events. The source replicas in
+	// the same group share the agent events subscription, so each agent event is delivered to one of them.
+	SharedSubscriptionGroup string
+}
+
+// topicData is the data to render the topic templates.
+type topicData struct {
+	SourceID string
+}
+
+// sharedSubscriptionGroupPattern is the pattern of the shared subscription group that the sdk-go topic patterns
+// accept.
+var sharedSubscriptionGroupPattern = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+func NewMQTTOptions() *MQTTOptions {
+	return &MQTTOptions{
+		BrokerHost:  "localhost:1883",
+		KeepAlive:   60 * time.Second,
+		PubQoS:      1,
+		SubQoS:      1,
+		DialTimeout: 5 * time.Second,
+		Topics: types.Topics{
+			SourceEvents: "sources/{{.SourceID}}/clusters/+/sourceevents",
+			AgentEvents:  "sources/{{.SourceID}}/clusters/+/agentevents",
+		},
+	}
+}
+
+// Validate validates the MQTT options.
+func (o *MQTTOptions) Validate() error {
+	if o.BrokerHost == "" {
+		return fmt.Errorf("the MQTT broker host is required")
+	}
+
+	if (o.ClientCertFile == "") != (o.ClientKeyFile == "") {
+		return fmt.Errorf("either both or none of MQTT client cert file and client key file must be set")
+	}
+
+	if o.Password != "" && o.Username == "" {
+		return fmt.Errorf("setting MQTT password requires username")
+	}
+
+	if o.DialTimeout <= 0 {
+		return fmt.Errorf("the MQTT dial timeout %v should be greater than 0", o.DialTimeout)
+	}
+
+	if o.KeepAlive < time.Second || o.KeepAlive > math.MaxUint16*time.Second {
+		return fmt.Errorf("the MQTT keepalive %v should be between 1s and %ds", o.KeepAlive, math.MaxUint16)
+	}
+
+	for name, qos := range map[string]int{"publish": o.PubQoS, "subscribe": o.SubQoS} {
+		if qos < 0 || qos > 2 {
+			return fmt.Errorf("the MQTT %s QoS %d should be 0, 1 or 2", name, qos)
+		}
+	}
+
+	if o.SharedSubscriptionGroup != "" && !sharedSubscriptionGroupPattern.MatchString(o.SharedSubscriptionGroup) {
+		return fmt.Errorf("invalid MQTT shared subscription group %q, it should match `%s`",
+			o.SharedSubscriptionGroup, sharedSubscriptionGroupPattern)
+	}
+
+	return validateTopicTemplates(&o.Topics)
+}
+
+// SourceTopics renders the topic templates with the given source ID, and subscribes the agent events with the
+// shared subscription group if it's set.
+func (o *MQTTOptions) SourceTopics(sourceID string) (*types.Topics, error) {
+	data := topicData{SourceID: sourceID}
+	topics := &types.Topics{}
+	for _, topic := range []struct {
+		template string
+		rendered *string
+	}{
+		{o.Topics.SourceEvents, &topics.SourceEvents},
+		{o.Topics.AgentEvents, &topics.AgentEvents},
+		{o.Topics.SourceBroadcast, &topics.SourceBroadcast},
+		{o.Topics.AgentBroadcast, &topics.AgentBroadcast},
+	} {
+		if topic.template == "" {
+			continue
+		}
+
+		tmpl, err := template.New("topic").Option("missingkey=error").Parse(topic.template)
+		if err != nil {
+			return nil, fmt.Errorf("invalid topic template %q, %v", topic.template, err)
+		}
+
+		var rendered strings.Builder
+		if err := tmpl.Execute(&rendered, data); err != nil {
+			return nil, fmt.Errorf("failed to render topic template %q, %v", topic.template, err)
+		}
+		*topic.rendered = rendered.String()
+	}
+
+	if o.SharedSubscriptionGroup != "" && !strings.HasPrefix(topics.AgentEvents, "$share/") {
+		topics.AgentEvents = fmt.Sprintf("$share/%s/%s", o.SharedSubscriptionGroup, topics.AgentEvents)
+	}
+
+	if err := validateTopics(topics); err != nil {
+		return nil, err
+	}
+
+	return topics, nil
+}
+
+// ClientID returns the MQTT client ID of the source. The replicas that share the subscription must connect with
+// different client IDs, so the host name and the process ID are added to the client ID.
+func (o *MQTTOptions) ClientID(sourceID string) string {
+	if o.SharedSubscriptionGroup == "" {
+		return fmt.Sprintf("%s-client", sourceID)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = uuid.New().String()
+	}
+	return fmt.Sprintf("%s-%s-%d", sourceID, hostname, os.Getpid())
+}
+
+// BuildMQTTOptions builds the sdk-go MQTT options of the given source, the client cert rotation of the dialer is
+// stopped once the context is done.
+func (o *MQTTOptions) BuildMQTTOptions(ctx context.Context, sourceID string) (*mqtt.MQTTOptions, error) {
+	dialer, err := o.Dialer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	topics, err := o.SourceTopics(sourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mqtt.MQTTOptions{
+		Topics:    *topics,
+		Username:  o.Username,
+		Password:  o.Password,
+		KeepAlive: uint16(o.KeepAlive / time.Second),
+		PubQoS:    o.PubQoS,
+		SubQoS:    o.SubQoS,
+		Dialer:    dialer,
+	}, nil
+}
+
+// Dialer returns the MQTT dialer to connect to the broker. If the client cert is set, the dialer's connection is
+// closed once the cert files are rotated, so the client reconnects with the new cert. The rotation is stopped once
+// the context is done.
+func (o *MQTTOptions) Dialer(ctx context.Context) (*mqtt.MQTTDialer, error) {
+	dialer := &mqtt.MQTTDialer{
+		BrokerHost: o.BrokerHost,
+		Timeout:    o.DialTimeout,
+	}
+
+	if o.CAFile == "" && o.ClientCertFile == "" {
+		return dialer, nil
+	}
+
+	certPool, err := x509.SystemCertPool()
+	if err != nil {
+		return nil, err
+	}
+
+	if o.CAFile != "" {
+		caPEM, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok := certPool.AppendCertsFromPEM(caPEM); !ok {
+			return nil, fmt.Errorf("invalid CA %s", o.CAFile)
+		}
+	}
+
+	dialer.TLSConfig = &tls.Config{
+		RootCAs:    certPool,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if o.ClientCertFile != "" {
+		loadCert := cert.CachingCertificateLoader(o.ClientCertFile, o.ClientKeyFile)
+		dialer.TLSConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return loadCert()
+		}
+
+		// periodically reload the client cert and close the connection if it's changed
+		go rotateClientCert(ctx, loadCert, dialer)
+	}
+
+	return dialer, nil
+}
+
+// rotateClientCert reloads the client cert every cert.CertCallbackRefreshDuration until the context is done, and
+// closes the connection once the cert is changed. The sdk-go cert.StartClientCertRotating can't be stopped, so it's
+// not used.
+func rotateClientCert(ctx context.Context, loadCert func() (*tls.Certificate, error), conn cert.Connection) {
+	var current *tls.Certificate
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		reloaded, err := loadCert()
+		if err != nil {
+			log.Printf("Failed to reload the MQTT client cert: %v", err)
+			return
+		}
+		if current != nil && !certsEqual(current, reloaded) {
+			log.Printf("The MQTT client cert is rotated, closing the connection")
+			if err := conn.Close(); err != nil {
+				log.Printf("Failed to close the MQTT connection: %v", err)
+			}
+		}
+		current = reloaded
+	}, cert.CertCallbackRefreshDuration)
+}
+
+// certsEqual returns whether the two certs have the same chain.
+func certsEqual(a, b *tls.Certificate) bool {
+	if len(a.Certificate) != len(b.Certificate) {
+		return false
+	}
+	for i := range a.Certificate {
+		if !bytes.Equal(a.Certificate[i], b.Certificate[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateTopics validates the topics with the patterns that the sdk-go MQTT options require.
+func validateTopics(topics *types.Topics) error {
+	var errs []error
+	if !regexp.MustCompile(types.SourceEventsTopicPattern).MatchString(topics.SourceEvents) {
+		errs = append(errs, fmt.Errorf("invalid source events topic %q, it should match `%s`",
+			topics.SourceEvents, types.SourceEventsTopicPattern))
+	}
+
+	if !regexp.MustCompile(types.AgentEventsTopicPattern).MatchString(topics.AgentEvents) {
+		errs = append(errs, fmt.Errorf("invalid agent events topic %q, it should match `%s`",
+			topics.AgentEvents, types.AgentEventsTopicPattern))
+	}
+
+	if topics.SourceBroadcast != "" && !regexp.MustCompile(types.SourceBroadcastTopicPattern).MatchString(topics.SourceBroadcast) {
+		errs = append(errs, fmt.Errorf("invalid source broadcast topic %q, it should match `%s`",
+			topics.SourceBroadcast, types.SourceBroadcastTopicPattern))
+	}
+
+	if topics.AgentBroadcast != "" && !regexp.MustCompile(types.AgentBroadcastTopicPattern).MatchString(topics.AgentBroadcast) {
+		errs = append(errs, fmt.Errorf("invalid agent broadcast topic %q, it should match `%s`",
+			topics.AgentBroadcast, types.AgentBroadcastTopicPattern))
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// validateTopicTemplates validates the topic templates can be parsed.
+func validateTopicTemplates(topics *types.Topics) error {
+	if topics.SourceEvents == "" || topics.AgentEvents == "" {
+		return fmt.Errorf("the source events and agent events topics are required")
+	}
+
+	var errs []error
+	for _, topic := range []string{topics.SourceEvents, topics.AgentEvents, topics.SourceBroadcast, topics.AgentBroadcast} {
+		if _, err := template.New("topic").Parse(topic); err != nil {
+			errs = append(errs, fmt.Errorf("invalid topic template %q, %v", topic, err))
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
@@ -0,0 +1,262 @@
+package transport
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"sigs.k8s.io/yaml"
+
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/options/mqtt"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/types"
+)
+
+// EmbeddedBrokerOptions holds the options of the in-process MQTT broker.
+type EmbeddedBrokerOptions struct {
+	// Address is the address that the broker listens on.
+	Address string
+
+	// TLSCertFile is the file path to the broker cert file, the broker serves TLS if it's set.
+	TLSCertFile string
+	// TLSKeyFile is the file path to the broker key file.
+	TLSKeyFile string
+
+	// CredentialsFile is the file path to a YAML or JSON map from the cluster name to its password. If it's set,
+	// the agent of a cluster must connect with the cluster name as the username, and it can only access the topics
+	// of its own cluster. Otherwise, the broker allows all clients.
+	CredentialsFile string
+}
+
+func NewEmbeddedBrokerOptions() *EmbeddedBrokerOptions {
+	return &EmbeddedBrokerOptions{
+		Address: ":1883",
+	}
+}
+
+// Validate validates the embedded broker options.
+func (o *EmbeddedBrokerOptions) Validate() error {
+	if o.Address == "" {
+		return fmt.Errorf("the embedded broker address is required")
+	}
+
+	if (o.TLSCertFile == "") != (o.TLSKeyFile == "") {
+		return fmt.Errorf("either both or none of embedded broker TLS cert file and key file must be set")
+	}
+
+	return nil
+}
+
+// EmbeddedBroker is an in-process MQTT broker, so that a single source binary provides both the source and the
+// broker.
+type EmbeddedBroker struct {
+	server  *mochi.Server
+	address string
+	tls     bool
+
+	// SourceUsername and SourcePassword are the credentials of the source, the password is generated when the
+	// broker is created.
+	SourceUsername string
+	SourcePassword string
+}
+
+// NewEmbeddedBroker creates the broker for the given source, the ACL of the source and the clusters is derived from
+// the rendered topics of the source.
+func NewEmbeddedBroker(opts *EmbeddedBrokerOptions, sourceID string, topics *types.Topics) (*EmbeddedBroker, error) {
+	server := mochi.New(&mochi.Options{
+		Logger: slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn})),
+	})
+
+	broker := &EmbeddedBroker{
+		server:         server,
+		address:        opts.Address,
+		tls:            opts.TLSCertFile != "",
+		SourceUsername: sourceID,
+	}
+
+	if opts.CredentialsFile == "" {
+		if err := server.AddHook(new(auth.AllowHook), nil); err != nil {
+			return nil, fmt.Errorf("failed to add auth hook, %v", err)
+		}
+	} else {
+		ledger, err := broker.loadLedger(opts.CredentialsFile, sourceID, topics)
+		if err != nil {
+			return nil, err
+		}
+		if err := server.AddHook(new(auth.Hook), &auth.Options{Ledger: ledger}); err != nil {
+			return nil, fmt.Errorf("failed to add auth hook, %v", err)
+		}
+	}
+
+	config := &listeners.Config{}
+	if opts.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.TLSCertFile, opts.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load embedded broker certificate, %v", err)
+		}
+		config.TLSConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+	}
+
+	if err := server.AddListener(listeners.NewTCP("tcp", opts.Address, config)); err != nil {
+		return nil, fmt.Errorf("failed to listen on %s, %v", opts.Address, err)
+	}
+
+	return broker, nil
+}
+
+// Start starts serving the clients, it doesn't block.
+func (b *EmbeddedBroker) Start() error {
+	log.Printf("Starting embedded MQTT broker")
+	return b.server.Serve()
+}
+
+// Stop closes the broker and disconnects all the clients.
+func (b *EmbeddedBroker) Stop() error {
+	return b.server.Close()
+}
+
+// Dialer returns the MQTT dialer for the source to connect to the broker over the loopback interface.
+func (b *EmbeddedBroker) Dialer() *mqtt.MQTTDialer {
+	host, port, err := net.SplitHostPort(b.address)
+	if err != nil || host == "" || net.ParseIP(host).IsUnspecified() {
+		host = "localhost"
+	}
+
+	dialer := &mqtt.MQTTDialer{
+		BrokerHost: net.JoinHostPort(host, port),
+		Timeout:    5 * time.Second,
+	}
+	if b.tls {
+		// the source connects to the broker in its own process, the broker certificate is not verified
+		dialer.TLSConfig = &tls.Config{
+			InsecureSkipVerify: true,
+			MinVersion:         tls.VersionTLS12,
+		}
+	}
+	return dialer
+}
+
+// loadLedger builds the auth ledger from the cluster credentials file and the generated source credentials.
+func (b *EmbeddedBroker) loadLedger(credentialsFile, sourceID string, topics *types.Topics) (*auth.Ledger, error) {
+	data, err := os.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedded broker credentials file, %v", err)
+	}
+
+	credentials := map[string]string{}
+	if err := yaml.Unmarshal(data, &credentials); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal embedded broker credentials file, %v", err)
+	}
+
+	password := make([]byte, 16)
+	if _, err := rand.Read(password); err != nil {
+		return nil, fmt.Errorf("failed to generate source password, %v", err)
+	}
+	b.SourcePassword = hex.EncodeToString(password)
+
+	users := auth.Users{
+		sourceID: auth.UserRule{
+			Username: auth.RString(sourceID),
+			Password: auth.RString(b.SourcePassword),
+			ACL:      sourceACL(topics),
+		},
+	}
+	for clusterName, clusterPassword := range credentials {
+		if clusterName == sourceID {
+			return nil, fmt.Errorf("the cluster name %s conflicts with the source ID", clusterName)
+		}
+		if clusterPassword == "" {
+			return nil, fmt.Errorf("the password of cluster %s is empty", clusterName)
+		}
+
+		users[clusterName] = auth.UserRule{
+			Username: auth.RString(clusterName),
+			Password: auth.RString(clusterPassword),
+			ACL:      clusterACL(topics, clusterName),
+		}
+	}
+
+	return &auth.Ledger{
+		Users: users,
+		// deny the topics that are not allowed by the user ACL
+		ACL: auth.ACLRules{
+			{Filters: auth.Filters{"#": auth.Deny}},
+		},
+	}, nil
+}
+
+// sourceACL allows the source to publish the spec events and subscribe the status events on its topics, the replicas
+// of the source may share the subscription of the status events.
+func sourceACL(topics *types.Topics) auth.Filters {
+	acl := auth.Filters{
+		auth.RString(unshared(topics.SourceEvents)): auth.WriteOnly,
+		auth.RString(unshared(topics.AgentEvents)):  auth.ReadOnly,
+		auth.RString(shared(topics.AgentEvents)):    auth.ReadOnly,
+	}
+	if topics.SourceBroadcast != "" {
+		acl[auth.RString(unshared(topics.SourceBroadcast))] = auth.WriteOnly
+	}
+	if topics.AgentBroadcast != "" {
+		acl[auth.RString(unshared(topics.AgentBroadcast))] = auth.ReadOnly
+		acl[auth.RString(shared(topics.AgentBroadcast))] = auth.ReadOnly
+	}
+	return acl
+}
+
+// clusterACL allows the agent of the cluster to subscribe the spec events and publish the status events of its own
+// cluster, so it can't send the spec events to itself. The source segment of the topics is a wildcard, so the agents
+// can subscribe the spec events of all sources.
+func clusterACL(topics *types.Topics, clusterName string) auth.Filters {
+	acl := auth.Filters{
+		auth.RString(topicOf(topics.SourceEvents, clusterName)): auth.ReadOnly,
+		auth.RString(topicOf(topics.AgentEvents, clusterName)):  auth.WriteOnly,
+	}
+	if topics.SourceBroadcast != "" {
+		acl[auth.RString(topicOf(topics.SourceBroadcast, ""))] = auth.ReadOnly
+	}
+	if topics.AgentBroadcast != "" {
+		acl[auth.RString(topicOf(topics.AgentBroadcast, ""))] = auth.WriteOnly
+	}
+	return acl
+}
+
+// topicOf returns the topic filter of the cluster from the rendered topic of the source, the topic follows the sdk-go
+// topic layout, e.g. `sources/<source>/clusters/+/sourceevents` of cluster1 is `sources/+/clusters/cluster1/sourceevents`,
+// and the broadcast topic `sources/<source>/sourcebroadcast` is `sources/+/sourcebroadcast`.
+func topicOf(topic, clusterName string) string {
+	segments := strings.Split(unshared(topic), "/")
+	segments[1] = "+"
+	if clusterName != "" && len(segments) == 5 {
+		segments[3] = clusterName
+	}
+	return strings.Join(segments, "/")
+}
+
+// unshared returns the topic without its shared subscription prefix `$share/<group>/`.
+func unshared(topic string) string {
+	if !strings.HasPrefix(topic, "$share/") {
+		return topic
+	}
+	segments := strings.SplitN(topic, "/", 3)
+	if len(segments) != 3 {
+		return topic
+	}
+	return segments[2]
+}
+
+// shared returns the shared subscription filter of the topic in any group.
+func shared(topic string) string {
+	return "$share/+/" + unshared(topic)
+}
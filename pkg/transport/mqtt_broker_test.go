@@ -0,0 +1,259 @@
+package transport
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/packets"
+
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/types"
+)
+
+func TestEmbeddedBrokerLedger(t *testing.T) {
+	cases := []struct {
+		name     string
+		topics   types.Topics
+		username string
+		topic    string
+		write    bool
+		expected bool
+	}{
+		{
+			name:     "source publishes spec events",
+			username: "source",
+			topic:    "sources/source/clusters/cluster1/sourceevents",
+			write:    true,
+			expected: true,
+		},
+		{
+			name:     "source subscribes status events",
+			username: "source",
+			topic:    "sources/source/clusters/+/agentevents",
+			expected: true,
+		},
+		{
+			name:     "source replicas share status events",
+			username: "source",
+			topic:    "$share/group1/sources/source/clusters/+/agentevents",
+			expected: true,
+		},
+		{
+			name:     "source can't publish status events",
+			username: "source",
+			topic:    "sources/source/clusters/cluster1/agentevents",
+			write:    true,
+		},
+		{
+			name:     "source can't access the topics of another source",
+			username: "source",
+			topic:    "sources/other/clusters/cluster1/sourceevents",
+			write:    true,
+		},
+		{
+			name:     "cluster subscribes its spec events",
+			username: "cluster1",
+			topic:    "sources/+/clusters/cluster1/sourceevents",
+			expected: true,
+		},
+		{
+			name:     "cluster publishes its status events",
+			username: "cluster1",
+			topic:    "sources/source/clusters/cluster1/agentevents",
+			write:    true,
+			expected: true,
+		},
+		{
+			name:     "cluster can't publish spec events",
+			username: "cluster1",
+			topic:    "sources/source/clusters/cluster1/sourceevents",
+			write:    true,
+		},
+		{
+			name:     "cluster can't subscribe status events",
+			username: "cluster1",
+			topic:    "sources/source/clusters/cluster1/agentevents",
+		},
+		{
+			name:     "cluster can't access another cluster",
+			username: "cluster1",
+			topic:    "sources/source/clusters/cluster2/sourceevents",
+		},
+		{
+			name: "source of the topic templates",
+			topics: types.Topics{
+				SourceEvents: "tenants/source/clusters/+/sourceevents",
+				AgentEvents:  "tenants/source/clusters/+/agentevents",
+			},
+			username: "source",
+			topic:    "tenants/source/clusters/cluster1/sourceevents",
+			write:    true,
+			expected: true,
+		},
+		{
+			name: "cluster of the topic templates",
+			topics: types.Topics{
+				SourceEvents: "tenants/source/clusters/+/sourceevents",
+				AgentEvents:  "tenants/source/clusters/+/agentevents",
+			},
+			username: "cluster1",
+			topic:    "tenants/source/clusters/cluster1/agentevents",
+			write:    true,
+			expected: true,
+		},
+		{
+			name:     "unknown user",
+			username: "unknown",
+			topic:    "sources/source/clusters/cluster1/sourceevents",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			topics := c.topics
+			if topics.SourceEvents == "" {
+				topics = types.Topics{
+					SourceEvents: "sources/source/clusters/+/sourceevents",
+					AgentEvents:  "$share/group1/sources/source/clusters/+/agentevents",
+				}
+			}
+
+			broker := &EmbeddedBroker{}
+			ledger, err := broker.loadLedger(writeTestCredentials(t, "cluster1: password1\ncluster2: password2\n"),
+				"source", &topics)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cl := &mochi.Client{Properties: mochi.ClientProperties{Username: []byte(c.username)}}
+			if _, ok := ledger.ACLOk(cl, c.topic, c.write); ok != c.expected {
+				t.Errorf("expected the access of %s to %s (write %v) is %v, but got %v",
+					c.username, c.topic, c.write, c.expected, ok)
+			}
+		})
+	}
+}
+
+func TestEmbeddedBrokerCredentials(t *testing.T) {
+	cases := []struct {
+		name        string
+		credentials string
+		expectedErr string
+	}{
+		{
+			name:        "clusters",
+			credentials: "cluster1: password1\n",
+		},
+		{
+			name:        "empty password",
+			credentials: "cluster1: \"\"\n",
+			expectedErr: "the password of cluster cluster1 is empty",
+		},
+		{
+			name:        "conflicts with the source",
+			credentials: "source: password1\n",
+			expectedErr: "the cluster name source conflicts with the source ID",
+		},
+		{
+			name:        "invalid file",
+			credentials: "- cluster1\n",
+			expectedErr: "failed to unmarshal embedded broker credentials file",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			broker := &EmbeddedBroker{SourceUsername: "source"}
+			ledger, err := broker.loadLedger(writeTestCredentials(t, c.credentials), "source", &types.Topics{
+				SourceEvents: "sources/source/clusters/+/sourceevents",
+				AgentEvents:  "sources/source/clusters/+/agentevents",
+			})
+			switch {
+			case c.expectedErr == "" && err != nil:
+				t.Fatalf("unexpected error %v", err)
+			case c.expectedErr != "" && (err == nil || !strings.Contains(err.Error(), c.expectedErr)):
+				t.Fatalf("expected error %q, but got %v", c.expectedErr, err)
+			case c.expectedErr != "":
+				return
+			}
+
+			// the source connects with the generated password, and the clusters with their own passwords
+			for username, password := range map[string]string{"source": broker.SourcePassword, "cluster1": "password1"} {
+				if !authOk(ledger, username, password) {
+					t.Errorf("expected %s is authenticated", username)
+				}
+				if authOk(ledger, username, "wrong") {
+					t.Errorf("expected %s with a wrong password is rejected", username)
+				}
+			}
+			if broker.SourcePassword == "" {
+				t.Errorf("expected the source password is generated")
+			}
+		})
+	}
+}
+
+func TestEmbeddedBrokerDialer(t *testing.T) {
+	cases := []struct {
+		name         string
+		address      string
+		tls          bool
+		expectedHost string
+	}{
+		{
+			name:         "unspecified host",
+			address:      ":0",
+			expectedHost: "localhost:0",
+		},
+		{
+			name:         "loopback",
+			address:      "127.0.0.1:0",
+			tls:          true,
+			expectedHost: "127.0.0.1:0",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			opts := NewEmbeddedBrokerOptions()
+			opts.Address = c.address
+			broker, err := NewEmbeddedBroker(opts, "source", &types.Topics{
+				SourceEvents: "sources/source/clusters/+/sourceevents",
+				AgentEvents:  "sources/source/clusters/+/agentevents",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer broker.Stop()
+			broker.tls = c.tls
+
+			dialer := broker.Dialer()
+			if dialer.BrokerHost != c.expectedHost {
+				t.Errorf("expected broker host %s, but got %s", c.expectedHost, dialer.BrokerHost)
+			}
+			if (dialer.TLSConfig != nil) != c.tls {
+				t.Errorf("expected TLS %v, but got %v", c.tls, dialer.TLSConfig)
+			}
+		})
+	}
+}
+
+func writeTestCredentials(t *testing.T, credentials string) string {
+	path := filepath.Join(t.TempDir(), "credentials.yaml")
+	if err := os.WriteFile(path, []byte(credentials), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func authOk(ledger *auth.Ledger, username, password string) bool {
+	cl := &mochi.Client{Properties: mochi.ClientProperties{Username: []byte(username)}}
+	_, ok := ledger.AuthOk(cl, packets.Packet{Connect: packets.ConnectParams{
+		Username: []byte(username),
+		Password: []byte(password),
+	}})
+	return ok
+}
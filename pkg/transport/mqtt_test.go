@@ -0,0 +1,100 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/options/cert"
+)
+
+func TestMQTTOptionsValidate(t *testing.T) {
+	cases := []struct {
+		name        string
+		mutate      func(o *MQTTOptions)
+		expectedErr string
+	}{
+		{
+			name:   "default",
+			mutate: func(o *MQTTOptions) {},
+		},
+		{
+			name:        "zero dial timeout",
+			mutate:      func(o *MQTTOptions) { o.DialTimeout = 0 },
+			expectedErr: "the MQTT dial timeout 0s should be greater than 0",
+		},
+		{
+			name:        "negative dial timeout",
+			mutate:      func(o *MQTTOptions) { o.DialTimeout = -time.Second },
+			expectedErr: "the MQTT dial timeout -1s should be greater than 0",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			o := NewMQTTOptions()
+			c.mutate(o)
+			err := o.Validate()
+			switch {
+			case c.expectedErr == "" && err != nil:
+				t.Fatalf("unexpected error %v", err)
+			case c.expectedErr != "" && (err == nil || !strings.Contains(err.Error(), c.expectedErr)):
+				t.Fatalf("expected error %q, but got %v", c.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestRotateClientCert(t *testing.T) {
+	refreshDuration := cert.CertCallbackRefreshDuration
+	cert.CertCallbackRefreshDuration = time.Millisecond
+	defer func() { cert.CertCallbackRefreshDuration = refreshDuration }()
+
+	var reloads atomic.Int32
+	loadCert := func() (*tls.Certificate, error) {
+		// the cert is rotated on the third reload
+		if reloads.Add(1) < 3 {
+			return &tls.Certificate{Certificate: [][]byte{[]byte("cert1")}}, nil
+		}
+		return &tls.Certificate{Certificate: [][]byte{[]byte("cert2")}}, nil
+	}
+	conn := &testConnection{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		rotateClientCert(ctx, loadCert, conn)
+		close(stopped)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for conn.closed.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the connection is closed once the cert is rotated")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// the rotation is stopped with the context
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the rotation is stopped once the context is done")
+	}
+	if closed := conn.closed.Load(); closed != 1 {
+		t.Errorf("expected the connection is closed once, but got %d", closed)
+	}
+}
+
+type testConnection struct {
+	closed atomic.Int32
+}
+
+func (c *testConnection) Close() error {
+	c.closed.Add(1)
+	return nil
+}
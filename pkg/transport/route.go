@@ -0,0 +1,46 @@
+package transport
+
+import (
+	"fmt"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/types"
+)
+
+// routeToAgents returns true if the event is sent from a source to the agents, that is a spec event or a status resync
+// request, otherwise the event is sent from an agent to the sources.
+func routeToAgents(evt cloudevents.Event) (bool, error) {
+	eventType, err := types.ParseCloudEventsType(evt.Type())
+	if err != nil {
+		return false, fmt.Errorf("failed to parse cloud event type %s, %v", evt.Type(), err)
+	}
+
+	toAgents := eventType.SubResource == types.SubResourceSpec
+	if eventType.Action == types.ResyncRequestAction {
+		// a source requests the status of an agent, an agent requests the spec of a source
+		toAgents = !toAgents
+	}
+	return toAgents, nil
+}
+
+// subscribed returns true if the subscriber of the given source and cluster name receives the event. The agents
+// subscribe with their cluster name, and the sources subscribe with their source ID only.
+func subscribed(evt cloudevents.Event, toAgents bool, source, clusterName string) bool {
+	if toAgents {
+		// a resync request without cluster name is broadcast
+		eventClusterName := fmt.Sprintf("%v", evt.Extensions()[types.ExtensionClusterName])
+		if clusterName == "" || (eventClusterName != types.ClusterAll && clusterName != eventClusterName) {
+			return false
+		}
+		return source == types.SourceAll || source == evt.Source()
+	}
+
+	if clusterName != "" {
+		return false
+	}
+	if originalSource, ok := evt.Extensions()[types.ExtensionOriginalSource]; ok {
+		return fmt.Sprintf("%v", originalSource) == source
+	}
+	return true
+}
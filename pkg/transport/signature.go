@@ -0,0 +1,215 @@
+package transport
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cloudeventstypes "github.com/cloudevents/sdk-go/v2/types"
+
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/types"
+)
+
+const (
+	// ExtensionSignatureKeyID is the CloudEvents extension that carries the ID of the key that signs the event.
+	ExtensionSignatureKeyID = "signaturekeyid"
+	// ExtensionSignature is the CloudEvents extension that carries the Ed25519 signature of the event in base64.
+	ExtensionSignature = "signature"
+
+	// signatureMaxAge is the freshness window of a signed event, an event whose time is out of the window from now
+	// is rejected, so a captured event can't be replayed later.
+	signatureMaxAge = 5 * time.Minute
+)
+
+// SignatureRejectedFunc is called when a received event is rejected because it's not signed or its signature
+// can't be verified, it's used to audit the rejected events.
+type SignatureRejectedFunc func(evt cloudevents.Event, err error)
+
+// Sign signs the event with the current signing key of the keyring. The signature covers the attributes, the
+// extensions and the data of the event as it's sent, so the event must not be changed after it's signed. The time
+// of the event is set to now if it's not set, so the signed event is only valid within the freshness window.
+func (k *Keyring) Sign(evt *cloudevents.Event) error {
+	key, ok := k.signingKey()
+	if !ok {
+		return fmt.Errorf("no signing key in the keyring")
+	}
+
+	if evt.Time().IsZero() {
+		evt.SetTime(time.Now())
+	}
+	evt.SetExtension(ExtensionSignature, nil)
+	evt.SetExtension(ExtensionSignatureKeyID, key.id)
+	canonical, err := canonicalEvent(evt)
+	if err != nil {
+		return err
+	}
+
+	evt.SetExtension(ExtensionSignature, base64.StdEncoding.EncodeToString(ed25519.Sign(key.privateKey, canonical)))
+	return nil
+}
+
+// Verify verifies the signature of the event with the keys of its signer. The signer of a status event is its
+// cluster, so an agent can't forge the status of the other clusters, and the signer of a spec event is its source.
+// The signed time of the event must be within the freshness window, and a status event must have a signed sequence
+// ID, so the order of the replayed status can be checked.
+func (k *Keyring) Verify(evt *cloudevents.Event) error {
+	extensions := evt.Extensions()
+	if _, ok := extensions[ExtensionSignature]; !ok {
+		return fmt.Errorf("the event is not signed")
+	}
+
+	if evt.Time().IsZero() {
+		return fmt.Errorf("the signed event has no time")
+	}
+	if age := time.Since(evt.Time()); age > signatureMaxAge || age < -signatureMaxAge {
+		return fmt.Errorf("the signed event time %s is out of the freshness window %v",
+			cloudeventstypes.FormatTime(evt.Time()), signatureMaxAge)
+	}
+
+	keyID, err := cloudeventstypes.ToString(extensions[ExtensionSignatureKeyID])
+	if err != nil {
+		return fmt.Errorf("failed to get signaturekeyid extension: %v", err)
+	}
+	encodedSignature, err := cloudeventstypes.ToString(extensions[ExtensionSignature])
+	if err != nil {
+		return fmt.Errorf("failed to get signature extension: %v", err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return fmt.Errorf("failed to decode signature extension: %v", err)
+	}
+
+	signer, status, err := eventSigner(evt)
+	if err != nil {
+		return err
+	}
+	if _, ok := extensions[types.ExtensionStatusUpdateSequenceID]; status && !ok {
+		return fmt.Errorf("the signed status event has no sequence ID")
+	}
+
+	key, ok := k.verificationKey(signer, keyID)
+	if !ok {
+		return fmt.Errorf("no verification key %s of the signer %s", keyID, signer)
+	}
+
+	signed := evt.Clone()
+	signed.SetExtension(ExtensionSignature, nil)
+	canonical, err := canonicalEvent(&signed)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(key.publicKey, canonical, signature) {
+		return fmt.Errorf("the signature of the event doesn't match the key %s of the signer %s", keyID, signer)
+	}
+	return nil
+}
+
+// eventSigner returns the signer of the event, and whether the event is a status event.
+func eventSigner(evt *cloudevents.Event) (string, bool, error) {
+	eventType, err := types.ParseCloudEventsType(evt.Type())
+	if err != nil {
+		return "", false, fmt.Errorf("failed to parse cloud event type %s, %v", evt.Type(), err)
+	}
+
+	if eventType.SubResource != types.SubResourceStatus {
+		return evt.Source(), false, nil
+	}
+
+	clusterName, err := cloudeventstypes.ToString(evt.Extensions()[types.ExtensionClusterName])
+	if err != nil {
+		return "", true, fmt.Errorf("failed to get clustername extension: %v", err)
+	}
+	return clusterName, true, nil
+}
+
+// canonicalEvent returns the canonical form of the event that is signed. The attributes and the extensions are
+// sorted by their names and formatted in the CloudEvents canonical string format, so the form doesn't change with
+// the content mode of the transport. Each name and value is prefixed with its length, so the form can't be
+// ambiguous.
+func canonicalEvent(evt *cloudevents.Event) ([]byte, error) {
+	attributes := map[string]string{
+		"specversion":     evt.SpecVersion(),
+		"id":              evt.ID(),
+		"source":          evt.Source(),
+		"type":            evt.Type(),
+		"subject":         evt.Subject(),
+		"datacontenttype": evt.DataContentType(),
+		"dataschema":      evt.DataSchema(),
+	}
+	if !evt.Time().IsZero() {
+		attributes["time"] = cloudeventstypes.FormatTime(evt.Time())
+	}
+	for name, value := range evt.Extensions() {
+		formatted, err := cloudeventstypes.Format(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to format extension %s, %v", name, err)
+		}
+		attributes["ext:"+name] = formatted
+	}
+
+	names := []string{}
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%d:%s%d:%s", len(name), name, len(attributes[name]), attributes[name])
+	}
+	digest := sha256.Sum256(evt.Data())
+	buf.Write(digest[:])
+	return buf.Bytes(), nil
+}
+
+// SignatureCodec signs the encoded events and verifies the received events before they are decoded, the events
+// that are not signed or mis-signed are rejected. It wraps the other codecs, so the events are signed as they're
+// sent.
+type SignatureCodec[T generic.ResourceObject] struct {
+	generic.Codec[T]
+	keyring    *Keyring
+	onRejected SignatureRejectedFunc
+}
+
+func NewSignatureCodec[T generic.ResourceObject](
+	codec generic.Codec[T],
+	keyring *Keyring,
+	onRejected SignatureRejectedFunc,
+) *SignatureCodec[T] {
+	return &SignatureCodec[T]{Codec: codec, keyring: keyring, onRejected: onRejected}
+}
+
+func (c *SignatureCodec[T]) Encode(source string, eventType types.CloudEventsType, obj T) (*cloudevents.Event, error) {
+	evt, err := c.Codec.Encode(source, eventType, obj)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.keyring.Sign(evt); err != nil {
+		return nil, err
+	}
+	return evt, nil
+}
+
+func (c *SignatureCodec[T]) Decode(evt *cloudevents.Event) (T, error) {
+	if err := c.keyring.Verify(evt); err != nil {
+		if c.onRejected != nil {
+			c.onRejected(*evt, err)
+		}
+
+		var obj T
+		return obj, fmt.Errorf("rejected event %s, %v", evt.ID(), err)
+	}
+
+	verified := evt.Clone()
+	verified.SetExtension(ExtensionSignature, nil)
+	verified.SetExtension(ExtensionSignatureKeyID, nil)
+	return c.Codec.Decode(&verified)
+}
@@ -0,0 +1,124 @@
+package transport
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"gopkg.in/yaml.v2"
+
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/generic/types"
+	"open-cluster-management.io/sdk-go/pkg/cloudevents/work/payload"
+)
+
+func TestVerifyStatusEvent(t *testing.T) {
+	signingKey, err := NewSigningKey("cluster1-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	agentKeyring := writeTestKeyring(t, KeyringConfig{SigningKeys: []KeyringKey{signingKey}})
+	sourceKeyring := writeTestKeyring(t, KeyringConfig{
+		VerificationKeys: map[string][]KeyringKey{"cluster1": {{ID: signingKey.ID, PublicKey: signingKey.PublicKey}}},
+	})
+
+	cases := []struct {
+		name        string
+		event       func() cloudevents.Event
+		tamper      func(evt *cloudevents.Event)
+		expectedErr string
+	}{
+		{
+			name:  "fresh status",
+			event: newSignatureTestEvent,
+		},
+		{
+			name: "stale status",
+			event: func() cloudevents.Event {
+				evt := newSignatureTestEvent()
+				evt.SetTime(time.Now().Add(-10 * time.Minute))
+				return evt
+			},
+			expectedErr: "out of the freshness window",
+		},
+		{
+			name:  "replayed status with a new time",
+			event: newSignatureTestEvent,
+			tamper: func(evt *cloudevents.Event) {
+				evt.SetTime(evt.Time().Add(time.Minute))
+			},
+			expectedErr: "doesn't match",
+		},
+		{
+			name:  "replayed status with a new sequence ID",
+			event: newSignatureTestEvent,
+			tamper: func(evt *cloudevents.Event) {
+				evt.SetExtension(types.ExtensionStatusUpdateSequenceID, "2")
+			},
+			expectedErr: "doesn't match",
+		},
+		{
+			name: "status without sequence ID",
+			event: func() cloudevents.Event {
+				evt := newSignatureTestEvent()
+				evt.SetExtension(types.ExtensionStatusUpdateSequenceID, nil)
+				return evt
+			},
+			expectedErr: "no sequence ID",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			evt := c.event()
+			if err := agentKeyring.Sign(&evt); err != nil {
+				t.Fatal(err)
+			}
+			if c.tamper != nil {
+				c.tamper(&evt)
+			}
+
+			err := sourceKeyring.Verify(&evt)
+			switch {
+			case c.expectedErr == "" && err != nil:
+				t.Errorf("unexpected error %v", err)
+			case c.expectedErr != "" && (err == nil || !strings.Contains(err.Error(), c.expectedErr)):
+				t.Errorf("expected error %q, but got %v", c.expectedErr, err)
+			}
+		})
+	}
+}
+
+func newSignatureTestEvent() cloudevents.Event {
+	evt := cloudevents.NewEvent()
+	evt.SetID("1")
+	evt.SetSource("cluster1-agent")
+	evt.SetType(types.CloudEventsType{
+		CloudEventsDataType: payload.ManifestEventDataType,
+		SubResource:         types.SubResourceStatus,
+		Action:              "update_request",
+	}.String())
+	evt.SetExtension(types.ExtensionClusterName, "cluster1")
+	evt.SetExtension(types.ExtensionStatusUpdateSequenceID, "1")
+	_ = evt.SetData(cloudevents.ApplicationJSON, map[string]string{"status": "applied"})
+	return evt
+}
+
+func writeTestKeyring(t *testing.T, config KeyringConfig) *Keyring {
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "keyring.yaml")
+	if err := os.WriteFile(file, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	keyring, err := LoadKeyring(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyring
+}
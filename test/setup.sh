@@ -23,6 +23,8 @@ nodes:
     hostPort: 30080
   - containerPort: 31883
     hostPort: 31883
+  - containerPort: 30092
+    hostPort: 30092
 EOF
 export KUBECONFIG=${ROOT_DIR}/test/.kubeconfig
 